@@ -0,0 +1,129 @@
+// Package apierror is the JSON error envelope of the HTTP API, every failed response has a Body and the
+// clients decode it back into an *Error wrapping the Go error the server answered with
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"youtube_service/logging"
+	"youtube_service/validation"
+)
+
+// codes of the errors, they only depend on the HTTP status
+const (
+	CodeInvalidArgument  = "invalid_argument"
+	CodeUnauthenticated  = "unauthenticated"
+	CodePermissionDenied = "permission_denied"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeNotAcceptable    = "not_acceptable"
+	CodeConflict         = "conflict"
+	CodeUnprocessable    = "unprocessable"
+	CodeRateLimited      = "rate_limited"
+	CodeUnavailable      = "unavailable"
+	CodeInternal         = "internal"
+	CodeUnknown          = "unknown"
+)
+
+var codes = map[int]string{
+	http.StatusBadRequest:          CodeInvalidArgument,
+	http.StatusUnauthorized:        CodeUnauthenticated,
+	http.StatusForbidden:           CodePermissionDenied,
+	http.StatusNotFound:            CodeNotFound,
+	http.StatusMethodNotAllowed:    CodeMethodNotAllowed,
+	http.StatusNotAcceptable:       CodeNotAcceptable,
+	http.StatusConflict:            CodeConflict,
+	http.StatusUnprocessableEntity: CodeUnprocessable,
+	http.StatusTooManyRequests:     CodeRateLimited,
+	http.StatusServiceUnavailable:  CodeUnavailable,
+	http.StatusInternalServerError: CodeInternal,
+}
+
+// CodeFor returns the code of the errors answered with status
+func CodeFor(status int) string {
+	if code, ok := codes[status]; ok {
+		return code
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeUnknown
+}
+
+// Error is the error of a failed response, Details are the fields rejected by the validation
+type Error struct {
+	Code      string                  `json:"code"`
+	Message   string                  `json:"message"`
+	Details   []validation.FieldError `json:"details,omitempty"`
+	RequestID string                  `json:"requestId,omitempty"`
+	// Status is the HTTP status of the response
+	Status int `json:"-"`
+	// Err is the error answered, on the client side the known error with the same message or the
+	// *validation.Error of the details
+	Err error `json:"-"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Body is the body of a failed response
+type Body struct {
+	Error *Error `json:"error"`
+}
+
+// New returns the Error of err answered with status to the request of ctx
+func New(ctx context.Context, status int, err error) *Error {
+	e := &Error{
+		Code:      CodeFor(status),
+		Message:   err.Error(),
+		RequestID: logging.RequestIDFromContext(ctx),
+		Status:    status,
+		Err:       err,
+	}
+	var invalid *validation.Error
+	if errors.As(err, &invalid) {
+		e.Details = invalid.Fields
+	}
+	return e
+}
+
+// Write answers the request of ctx with status and the Body of err
+func Write(ctx context.Context, w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Body{Error: New(ctx, status, err)})
+}
+
+// Decode reads the Body of the failed response resp, see FromResponse
+func Decode(resp *http.Response, known ...error) *Error {
+	var body Body
+	json.NewDecoder(resp.Body).Decode(&body)
+	return FromResponse(resp, body.Error, known...)
+}
+
+// FromResponse completes e, the error decoded from the failed response resp, with its status and the
+// Go error it stands for: the *validation.Error of its details or the error of known with its message.
+// A nil e, e.g. when a proxy answered, gets the code of the status and the status text as message.
+func FromResponse(resp *http.Response, e *Error, known ...error) *Error {
+	if e == nil {
+		e = &Error{Code: CodeFor(resp.StatusCode), Message: http.StatusText(resp.StatusCode)}
+	}
+	e.Status = resp.StatusCode
+	if e.RequestID == "" {
+		e.RequestID = resp.Header.Get(logging.RequestIDHeader)
+	}
+	if len(e.Details) > 0 {
+		e.Err = &validation.Error{Fields: e.Details}
+		return e
+	}
+	for _, err := range known {
+		if err.Error() == e.Message {
+			e.Err = err
+			break
+		}
+	}
+	return e
+}
@@ -0,0 +1,77 @@
+package apierror
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"youtube_service/logging"
+	"youtube_service/validation"
+)
+
+var errKnown = errors.New("known error")
+
+func TestRoundTrip(t *testing.T) {
+	invalid := validation.NewError("videoName", validation.RuleRequired, "is missing")
+	tests := []struct {
+		name    string
+		status  int
+		err     error
+		want    *Error
+		wantErr error
+	}{
+		{
+			name:    "known",
+			status:  http.StatusNotFound,
+			err:     errKnown,
+			want:    &Error{Code: CodeNotFound, Message: "known error", RequestID: "req1", Status: http.StatusNotFound},
+			wantErr: errKnown,
+		},
+		{
+			name:    "validation",
+			status:  http.StatusBadRequest,
+			err:     invalid,
+			want:    &Error{Code: CodeInvalidArgument, Message: invalid.Error(), Details: invalid.Fields, RequestID: "req1", Status: http.StatusBadRequest},
+			wantErr: invalid,
+		},
+		{
+			name:   "unknown",
+			status: http.StatusTeapot,
+			err:    errors.New("short and stout"),
+			want:   &Error{Code: CodeUnknown, Message: "short and stout", RequestID: "req1", Status: http.StatusTeapot},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			Write(logging.ContextWithRequestID(context.Background(), "req1"), w, tt.status, tt.err)
+			got := Decode(w.Result(), errKnown)
+			if !reflect.DeepEqual(got.Err, tt.wantErr) {
+				t.Errorf("Err = %#v, want %#v", got.Err, tt.wantErr)
+			}
+			got.Err = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+// the responses of a proxy have no envelope
+func TestDecode_noEnvelope(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusBadGateway,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("<html>bad gateway</html>")),
+	}
+	resp.Header.Set(logging.RequestIDHeader, "req1")
+	got := Decode(resp)
+	want := &Error{Code: CodeInternal, Message: "Bad Gateway", RequestID: "req1", Status: http.StatusBadGateway}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode() = %#v, want %#v", got, want)
+	}
+}
@@ -0,0 +1,39 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	model "youtube_service/model"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var ErrUnknownSink = errors.New("unknown audit sink")
+
+// Log is an append-only log of the mutations
+type Log interface {
+	Append(ctx context.Context, entry model.AuditEntry) error
+	// Query returns the newest entries matching filter first, at most filter.Limit of them
+	Query(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, error)
+}
+
+// sinks of the audit log
+const (
+	SinkNone  = ""
+	SinkRedis = "redis"
+	SinkFile  = "file"
+)
+
+// NewLog returns the Log of sink, the redis stream key and its length or the file path are used
+// by their sink only, there is no Log for SinkNone
+func NewLog(sink string, client *redis.Client, key string, maxLen int64, path string) (Log, error) {
+	switch sink {
+	case SinkNone:
+		return nil, nil
+	case SinkRedis:
+		return NewRedisLog(client, key, maxLen), nil
+	case SinkFile:
+		return NewFileLog(path)
+	}
+	return nil, ErrUnknownSink
+}
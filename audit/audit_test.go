@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+	model "youtube_service/model"
+)
+
+func TestFileLog(t *testing.T) {
+	log, err := NewFileLog(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	for i, entry := range []model.AuditEntry{
+		{Method: "PostVideo", VideoID: "video1", Subject: "alice"},
+		{Method: "ViewVideo", VideoID: "video1", Subject: "bob"},
+		{Method: "PostVideo", VideoID: "video2", Subject: "alice"},
+		{Method: "PostVideo", VideoID: "video3", Subject: "bob"},
+	} {
+		entry.Time = start.Add(time.Duration(i) * time.Hour)
+		if err := log.Append(context.Background(), entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter model.AuditFilter
+		want   []string
+	}{
+		{name: "newest first", filter: model.AuditFilter{}, want: []string{"4", "3", "2", "1"}},
+		{name: "by method with a limit", filter: model.AuditFilter{Method: "PostVideo", Limit: 2}, want: []string{"4", "3"}},
+		{name: "by subject", filter: model.AuditFilter{Subject: "alice"}, want: []string{"3", "1"}},
+		{name: "by video", filter: model.AuditFilter{VideoID: "video1"}, want: []string{"2", "1"}},
+		{name: "by time", filter: model.AuditFilter{Since: start.Add(time.Hour), Until: start.Add(2 * time.Hour)}, want: []string{"3", "2"}},
+		{name: "no match", filter: model.AuditFilter{Method: "ImportViews"}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := log.Query(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, entry := range entries {
+				got = append(got, entry.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Query() ids = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreviousID(t *testing.T) {
+	tests := map[string]string{
+		"1686000000000-5": "1686000000000-4",
+		"1686000000000-0": "1685999999999-18446744073709551615",
+	}
+	for id, want := range tests {
+		if got := previousID(id); got != want {
+			t.Errorf("previousID(%q) = %q, want %q", id, got, want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	model "youtube_service/model"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// number of stream entries read per XREVRANGE while querying
+const queryPageSize = 200
+
+type redisLog struct {
+	client *redis.Client
+	key    string
+	maxLen int64
+}
+
+// NewRedisLog returns a Log appending to the redis stream key, trimmed to about maxLen entries
+func NewRedisLog(client *redis.Client, key string, maxLen int64) Log {
+	return &redisLog{client: client, key: key, maxLen: maxLen}
+}
+
+func (l *redisLog) Append(ctx context.Context, entry model.AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return l.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: l.key,
+		MaxLen: l.maxLen,
+		Approx: true,
+		Values: []interface{}{"entry", data},
+	}).Err()
+}
+
+// Query walks the stream backwards from the until time, the stream ids start with the append time in ms
+func (l *redisLog) Query(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, error) {
+	end, start := "+", "-"
+	if !filter.Until.IsZero() {
+		end = strconv.FormatInt(filter.Until.UnixMilli(), 10)
+	}
+	if !filter.Since.IsZero() {
+		start = strconv.FormatInt(filter.Since.UnixMilli(), 10)
+	}
+	var entries []model.AuditEntry
+	for {
+		messages, err := l.client.XRevRangeN(ctx, l.key, end, start, queryPageSize).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, message := range messages {
+			data, _ := message.Values["entry"].(string)
+			var entry model.AuditEntry
+			if err := json.Unmarshal([]byte(data), &entry); err != nil {
+				return nil, err
+			}
+			entry.ID = message.ID
+			if filter.Matches(entry) {
+				entries = append(entries, entry)
+				if len(entries) == filter.Limit {
+					return entries, nil
+				}
+			}
+		}
+		if len(messages) < queryPageSize {
+			return entries, nil
+		}
+		end = previousID(messages[len(messages)-1].ID)
+	}
+}
+
+// previousID returns the stream id right before id, XREVRANGE has no exclusive bound before redis 6.2
+func previousID(id string) string {
+	ms, seq, _ := strings.Cut(id, "-")
+	if seq != "0" {
+		n, _ := strconv.ParseUint(seq, 10, 64)
+		return ms + "-" + strconv.FormatUint(n-1, 10)
+	}
+	n, _ := strconv.ParseUint(ms, 10, 64)
+	return strconv.FormatUint(n-1, 10) + "-18446744073709551615"
+}
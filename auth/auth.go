@@ -0,0 +1,295 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	kitjwt "github.com/go-kit/kit/auth/jwt"
+	"github.com/go-kit/kit/endpoint"
+	kitgrpc "github.com/go-kit/kit/transport/grpc"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/golang-jwt/jwt/v4"
+	"google.golang.org/grpc/metadata"
+)
+
+// APIKeyHeader carries the static API keys
+const APIKeyHeader = "X-API-Key"
+
+// scopes of the routes, admin is granted every scope
+const (
+	ScopeRead   = "read"
+	ScopeIngest = "ingest"
+	ScopeAdmin  = "admin"
+)
+
+var (
+	ErrUnauthenticated = errors.New("missing or invalid credentials")
+	ErrForbidden       = errors.New("insufficient scope")
+)
+
+// APIKey is a static key and the scopes it is granted
+type APIKey struct {
+	Name   string   `json:"name"`
+	Key    string   `json:"key"`
+	Scopes []string `json:"scopes"`
+}
+
+// Config configures the accepted credentials, the HS256 secrets are looked up by the kid of the
+// token and the one under "" is used for the tokens without a kid
+type Config struct {
+	Enabled     bool              `json:"enabled"`
+	HMACSecrets map[string]string `json:"hmacSecrets"`
+	// JWKSFile is a local JSON Web Key Set with the RSA keys of the RS256 tokens
+	JWKSFile string   `json:"jwksFile"`
+	Issuer   string   `json:"issuer"`
+	Audience string   `json:"audience"`
+	APIKeys  []APIKey `json:"apiKeys"`
+}
+
+// Principal is the authenticated caller
+type Principal struct {
+	Subject string
+	Scopes  []string
+}
+
+// HasScope is true when the principal was granted scope or admin
+func (p Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+type claims struct {
+	jwt.RegisteredClaims
+	// space separated scopes, as in OAuth
+	Scope string `json:"scope"`
+}
+
+// Authenticator validates the JWTs and API keys put in the context by HTTPToContext
+type Authenticator struct {
+	hmacSecrets map[string][]byte
+	rsaKeys     map[string]*rsa.PublicKey
+	apiKeys     []APIKey
+	issuer      string
+	audience    string
+}
+
+// NewAuthenticator returns an Authenticator for conf, reading its JWKS file
+func NewAuthenticator(conf Config) (*Authenticator, error) {
+	a := &Authenticator{
+		hmacSecrets: map[string][]byte{},
+		rsaKeys:     map[string]*rsa.PublicKey{},
+		apiKeys:     conf.APIKeys,
+		issuer:      conf.Issuer,
+		audience:    conf.Audience,
+	}
+	for kid, secret := range conf.HMACSecrets {
+		a.hmacSecrets[kid] = []byte(secret)
+	}
+	if conf.JWKSFile != "" {
+		keys, err := readJWKS(conf.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		a.rsaKeys = keys
+	}
+	return a, nil
+}
+
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// readJWKS returns the RSA keys of a JSON Web Key Set file by kid
+func readJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set jwks
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, key := range set.Keys {
+		if key.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, err
+		}
+		keys[key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return keys, nil
+}
+
+// Authenticate returns the principal of the credentials in ctx, an API key is preferred over a token
+func (a *Authenticator) Authenticate(ctx context.Context) (Principal, error) {
+	if key, _ := ctx.Value(apiKeyContextKey).(string); key != "" {
+		return a.authenticateAPIKey(key)
+	}
+	if token, _ := ctx.Value(kitjwt.JWTContextKey).(string); token != "" {
+		return a.authenticateToken(token)
+	}
+	return Principal{}, ErrUnauthenticated
+}
+
+func (a *Authenticator) authenticateAPIKey(key string) (Principal, error) {
+	for _, k := range a.apiKeys {
+		if subtle.ConstantTimeCompare([]byte(k.Key), []byte(key)) == 1 {
+			return Principal{Subject: k.Name, Scopes: k.Scopes}, nil
+		}
+	}
+	return Principal{}, ErrUnauthenticated
+}
+
+func (a *Authenticator) authenticateToken(token string) (Principal, error) {
+	var c claims
+	_, err := jwt.ParseWithClaims(token, &c, a.keyFor, jwt.WithValidMethods([]string{"HS256", "RS256"}))
+	//a token without an expiry would be valid forever
+	if err != nil || c.ExpiresAt == nil {
+		return Principal{}, ErrUnauthenticated
+	}
+	if a.issuer != "" && !c.VerifyIssuer(a.issuer, true) {
+		return Principal{}, ErrUnauthenticated
+	}
+	if a.audience != "" && !c.VerifyAudience(a.audience, true) {
+		return Principal{}, ErrUnauthenticated
+	}
+	return Principal{Subject: c.Subject, Scopes: strings.Fields(c.Scope)}, nil
+}
+
+// keyFor returns the key of the kid and signing method of a token
+func (a *Authenticator) keyFor(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if secret, ok := a.hmacSecrets[kid]; ok {
+			return secret, nil
+		}
+	case *jwt.SigningMethodRSA:
+		if key, ok := a.rsaKeys[kid]; ok {
+			return key, nil
+		}
+	}
+	return nil, ErrUnauthenticated
+}
+
+// Middleware lets through the requests whose credentials are granted scope
+func (a *Authenticator) Middleware(scope string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			principal, err := a.Authenticate(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if !principal.HasScope(scope) {
+				return nil, ErrForbidden
+			}
+			return next(context.WithValue(ctx, principalContextKey, principal), request)
+		}
+	}
+}
+
+type contextKey int
+
+const (
+	apiKeyContextKey contextKey = iota
+	principalContextKey
+)
+
+// PrincipalFromContext returns the caller authenticated by Middleware
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey).(Principal)
+	return principal, ok
+}
+
+// HTTPToContext moves the bearer token and the API key of a request to the context
+func HTTPToContext() kithttp.RequestFunc {
+	fromAuthHeader := kitjwt.HTTPToContext()
+	return func(ctx context.Context, r *http.Request) context.Context {
+		ctx = fromAuthHeader(ctx, r)
+		if key := r.Header.Get(APIKeyHeader); key != "" {
+			ctx = context.WithValue(ctx, apiKeyContextKey, key)
+		}
+		return ctx
+	}
+}
+
+// ContextToHTTP forwards the bearer token of the context, so a request made while serving
+// another one carries the credentials of its caller
+func ContextToHTTP() kithttp.RequestFunc {
+	return kitjwt.ContextToHTTP()
+}
+
+// GRPCToContext moves the bearer token and the API key of the request metadata to the context
+func GRPCToContext() kitgrpc.ServerRequestFunc {
+	fromAuthMetadata := kitjwt.GRPCToContext()
+	return func(ctx context.Context, md metadata.MD) context.Context {
+		ctx = fromAuthMetadata(ctx, md)
+		if keys := md.Get(APIKeyHeader); len(keys) > 0 && keys[0] != "" {
+			ctx = context.WithValue(ctx, apiKeyContextKey, keys[0])
+		}
+		return ctx
+	}
+}
+
+// ContextToGRPC forwards the bearer token of the context in the request metadata
+func ContextToGRPC() kitgrpc.ClientRequestFunc {
+	return kitjwt.ContextToGRPC()
+}
+
+// BearerToken sets token on every client request
+func BearerToken(token string) kithttp.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		r.Header.Set("Authorization", "Bearer "+token)
+		return ctx
+	}
+}
+
+// WithAPIKey sets key on every client request
+func WithAPIKey(key string) kithttp.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		r.Header.Set(APIKeyHeader, key)
+		return ctx
+	}
+}
+
+// NewHS256Token signs a token for subject with scopes, valid for ttl
+func NewHS256Token(kid string, secret []byte, subject string, scopes []string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+		Scope: strings.Join(scopes, " "),
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	return token.SignedString(secret)
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestMiddleware(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	set, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "rsa1",
+		"n":   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+	}}})
+	if err := os.WriteFile(jwksFile, set, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	authenticator, err := NewAuthenticator(Config{
+		Enabled:     true,
+		HMACSecrets: map[string]string{"hs1": "secret"},
+		JWKSFile:    jwksFile,
+		APIKeys:     []APIKey{{Name: "ingester", Key: "key1", Scopes: []string{ScopeIngest}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hsToken := func(kid, secret string, scopes []string, ttl time.Duration) string {
+		token, err := NewHS256Token(kid, []byte(secret), "alice", scopes, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	rsToken := func(scope string, expiresAt *jwt.NumericDate) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims{
+			RegisteredClaims: jwt.RegisteredClaims{Subject: "bob", ExpiresAt: expiresAt},
+			Scope:            scope,
+		})
+		token.Header["kid"] = "rsa1"
+		signed, err := token.SignedString(rsaKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name    string
+		scope   string
+		token   string
+		apiKey  string
+		want    string
+		wantErr error
+	}{
+		{name: "hs256 token", scope: ScopeRead, token: hsToken("hs1", "secret", []string{ScopeRead}, time.Minute), want: "alice"},
+		{name: "admin has every scope", scope: ScopeIngest, token: hsToken("hs1", "secret", []string{ScopeAdmin}, time.Minute), want: "alice"},
+		{name: "rs256 token from the jwks", scope: ScopeIngest, token: rsToken("read ingest", jwt.NewNumericDate(time.Now().Add(time.Minute))), want: "bob"},
+		{name: "api key", scope: ScopeIngest, apiKey: "key1", want: "ingester"},
+		{name: "missing scope", scope: ScopeAdmin, apiKey: "key1", wantErr: ErrForbidden},
+		{name: "no credentials", scope: ScopeRead, wantErr: ErrUnauthenticated},
+		{name: "unknown api key", scope: ScopeRead, apiKey: "key2", wantErr: ErrUnauthenticated},
+		{name: "wrong secret", scope: ScopeRead, token: hsToken("hs1", "other", []string{ScopeRead}, time.Minute), wantErr: ErrUnauthenticated},
+		{name: "unknown kid", scope: ScopeRead, token: hsToken("hs2", "secret", []string{ScopeRead}, time.Minute), wantErr: ErrUnauthenticated},
+		{name: "expired token", scope: ScopeRead, token: hsToken("hs1", "secret", []string{ScopeRead}, -time.Minute), wantErr: ErrUnauthenticated},
+		{name: "token without an expiry", scope: ScopeRead, token: rsToken("read", nil), wantErr: ErrUnauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/getViews", nil)
+			if tt.token != "" {
+				BearerToken(tt.token)(context.Background(), r)
+			}
+			if tt.apiKey != "" {
+				WithAPIKey(tt.apiKey)(context.Background(), r)
+			}
+			ctx := HTTPToContext()(context.Background(), r)
+
+			var got Principal
+			e := authenticator.Middleware(tt.scope)(func(ctx context.Context, request interface{}) (interface{}, error) {
+				got, _ = PrincipalFromContext(ctx)
+				return nil, nil
+			})
+			if _, err := e(ctx, nil); err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got.Subject != tt.want {
+				t.Errorf("principal = %q, want %q", got.Subject, tt.want)
+			}
+		})
+	}
+}
@@ -1,9 +1,14 @@
 package client
 
 import (
+	"context"
+	"errors"
 	"io"
+	"net/http"
 	"time"
 
+	"youtube_service/apierror"
+	"youtube_service/idempotency"
 	service "youtube_service/service"
 
 	consulapi "github.com/hashicorp/consul/api"
@@ -13,12 +18,19 @@ import (
 	"github.com/go-kit/kit/sd"
 	"github.com/go-kit/kit/sd/consul"
 	"github.com/go-kit/kit/sd/lb"
+	httptransport "github.com/go-kit/kit/transport/http"
 )
 
 // New returns a service that's load-balanced over instances of profilesvc found
 // in the provided Consul server. The mechanism of looking up profilesvc
-// instances in Consul is hard-coded into the client.
-func New(consulAddr string, logger log.Logger) (service.Service, error) {
+// instances in Consul is hard-coded into the client. The options are given to every
+// request, e.g. httptransport.ClientBefore(auth.BearerToken(token)) to authenticate.
+// The calls failing on the transport, with a 5xx or a 429 are retried on the next instance, the
+// retries of a view or a new video send the same Idempotency-Key so they are applied once,
+// a key set with idempotency.ContextWithKey is used instead of a new one. The imports are not
+// retried, their body is read as it is sent so a retry would only send what is left of it, and neither
+// are the exports whose rows may already be handed over.
+func New(consulAddr string, logger log.Logger, options ...httptransport.ClientOption) (service.Service, error) {
 	apiclient, err := consulapi.NewClient(&consulapi.Config{
 		Address: consulAddr,
 	})
@@ -42,51 +54,143 @@ func New(consulAddr string, logger log.Logger) (service.Service, error) {
 		endpoints service.Endpoints
 	)
 	{
-		factory := factoryFor(service.MakeViewVideoEndpoint)
+		factory := factoryFor(options, failing(service.MakeViewVideoEndpoint))
 		endpointer := sd.NewEndpointer(instancer, factory, logger)
 		balancer := lb.NewRoundRobin(endpointer)
-		retry := lb.Retry(retryMax, retryTimeout, balancer)
-		endpoints.ViewVideoEndpoint = retry
+		retry := retrying(retryMax, retryTimeout, balancer)
+		endpoints.ViewVideoEndpoint = idempotency.EndpointMiddleware()(retry)
 	}
 	{
-		factory := factoryFor(service.MakeGetTopNVideosEndpoint)
+		factory := factoryFor(options, failing(service.MakeGetTopNVideosEndpoint))
 		endpointer := sd.NewEndpointer(instancer, factory, logger)
 		balancer := lb.NewRoundRobin(endpointer)
-		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		retry := retrying(retryMax, retryTimeout, balancer)
 		endpoints.GetTopNVideosEndpoint = retry
 
 	}
 	{
-		factory := factoryFor(service.MakeGetTopNVideosTodayEndpoint)
+		factory := factoryFor(options, failing(service.MakeGetTopNVideosTodayEndpoint))
 		endpointer := sd.NewEndpointer(instancer, factory, logger)
 		balancer := lb.NewRoundRobin(endpointer)
-		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		retry := retrying(retryMax, retryTimeout, balancer)
 		endpoints.GetTopNVideosTodayEndpoint = retry
 	}
 	{
-		factory := factoryFor(service.MakeGetViewsEndpoint)
+		factory := factoryFor(options, failing(service.MakeGetViewsEndpoint))
 		endpointer := sd.NewEndpointer(instancer, factory, logger)
 		balancer := lb.NewRoundRobin(endpointer)
-		retry := lb.Retry(retryMax, retryTimeout, balancer)
+		retry := retrying(retryMax, retryTimeout, balancer)
 		endpoints.GetViewsEndpoint = retry
 	}
 	{
-		factory := factoryFor(service.MakePostVideoEndpoint)
+		factory := factoryFor(options, failing(service.MakePostVideoEndpoint))
 		endpointer := sd.NewEndpointer(instancer, factory, logger)
 		balancer := lb.NewRoundRobin(endpointer)
-		retry := lb.Retry(retryMax, retryTimeout, balancer)
-		endpoints.PostVideoEndpoint = retry
+		retry := retrying(retryMax, retryTimeout, balancer)
+		endpoints.PostVideoEndpoint = idempotency.EndpointMiddleware()(retry)
+	}
+	{
+		factory := factoryFor(options, service.MakeImportViewsEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		endpoints.ImportViewsEndpoint = idempotency.EndpointMiddleware()(once(balancer))
+	}
+	{
+		factory := factoryFor(options, service.MakeExportVideosEndpoint)
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		endpoints.ExportVideosEndpoint = once(balancer)
+	}
+	{
+		factory := factoryFor(options, failing(service.MakeGetViewHistoryEndpoint))
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := retrying(retryMax, retryTimeout, balancer)
+		endpoints.GetViewHistoryEndpoint = retry
+	}
+	{
+		factory := factoryFor(options, failing(service.MakeGetLeaderboardDiffEndpoint))
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := retrying(retryMax, retryTimeout, balancer)
+		endpoints.GetLeaderboardDiffEndpoint = retry
+	}
+	{
+		factory := factoryFor(options, failing(service.MakeGetAuditEntriesEndpoint))
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := retrying(retryMax, retryTimeout, balancer)
+		endpoints.GetAuditEntriesEndpoint = retry
+	}
+	{
+		factory := factoryFor(options, failing(service.MakeGetVideoStatsEndpoint))
+		endpointer := sd.NewEndpointer(instancer, factory, logger)
+		balancer := lb.NewRoundRobin(endpointer)
+		retry := retrying(retryMax, retryTimeout, balancer)
+		endpoints.GetVideoStatsEndpoint = retry
 	}
 
 	return endpoints, nil
 }
 
-func factoryFor(makeEndpoint func(service.Service) endpoint.Endpoint) sd.Factory {
+func factoryFor(options []httptransport.ClientOption, makeEndpoint func(service.Service) endpoint.Endpoint) sd.Factory {
 	return func(instance string) (endpoint.Endpoint, io.Closer, error) {
-		service, err := service.MakeClientEndpoints(instance)
+		service, err := service.MakeClientEndpoints(instance, options...)
 		if err != nil {
 			return nil, nil, err
 		}
 		return makeEndpoint(service), nil, nil
 	}
 }
+
+// failing makes endpoints returning the error answered in their response as their error, so the retries see it
+func failing(makeEndpoint func(service.Service) endpoint.Endpoint) func(service.Service) endpoint.Endpoint {
+	return func(s service.Service) endpoint.Endpoint {
+		e := makeEndpoint(s)
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			response, err := e(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+			if err := service.ResponseError(response); err != nil {
+				return nil, err
+			}
+			return response, nil
+		}
+	}
+}
+
+// retrying calls the instances of balancer until one answers, up to max times within timeout, the
+// errors answered with a status below 500 but 429 are final. The error of the last call is returned.
+func retrying(max int, timeout time.Duration, balancer lb.Balancer) endpoint.Endpoint {
+	e := lb.RetryWithCallback(timeout, balancer, func(n int, err error) (bool, error) {
+		return n < max && retryable(err), nil
+	})
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		response, err := e(ctx, request)
+		var retryErr lb.RetryError
+		if errors.As(err, &retryErr) {
+			return nil, retryErr.Final
+		}
+		return response, err
+	}
+}
+
+// once calls a single instance of balancer
+func once(balancer lb.Balancer) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		e, err := balancer.Endpoint()
+		if err != nil {
+			return nil, err
+		}
+		return e(ctx, request)
+	}
+}
+
+func retryable(err error) bool {
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Status >= http.StatusInternalServerError || apiErr.Status == http.StatusTooManyRequests
+	}
+	return !errors.Is(err, context.Canceled)
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+	"youtube_service/apierror"
+	db "youtube_service/repository"
+	service "youtube_service/service"
+
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/kit/sd/lb"
+)
+
+func TestRetrying(t *testing.T) {
+	unavailable := &apierror.Error{Status: http.StatusServiceUnavailable, Message: "unavailable"}
+	notFound := &apierror.Error{Status: http.StatusNotFound, Message: "not found", Err: db.ErrUnknown}
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{name: "answered", errs: []error{nil}, wantCalls: 1},
+		{name: "unavailable instance", errs: []error{unavailable, nil}, wantCalls: 2},
+		{name: "refused connection", errs: []error{errors.New("connection refused"), nil}, wantCalls: 2},
+		{name: "client error is final", errs: []error{notFound, nil}, wantCalls: 1, wantErr: db.ErrUnknown},
+		{name: "every try failed", errs: []error{unavailable, unavailable, unavailable, nil}, wantCalls: 3, wantErr: unavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			var instances sd.FixedEndpointer
+			for range tt.errs {
+				instances = append(instances, func(ctx context.Context, request interface{}) (interface{}, error) {
+					err := tt.errs[calls]
+					calls++
+					return "ok", err
+				})
+			}
+			_, err := retrying(3, time.Second, lb.NewRoundRobin(instances))(context.Background(), nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// the errors the service endpoints answer in their responses are returned as errors to be retried
+func TestFailing(t *testing.T) {
+	endpoints := service.Endpoints{GetViewsEndpoint: failing(service.MakeGetViewsEndpoint)(&fakeService{})}
+	if views, err := endpoints.GetViews(context.Background(), "video1"); views != 5 || err != nil {
+		t.Errorf("GetViews() = %d, %v, want 5", views, err)
+	}
+	if _, err := endpoints.GetViews(context.Background(), "video2"); err != db.ErrUnknown {
+		t.Errorf("GetViews() error = %v, want db.ErrUnknown", err)
+	}
+}
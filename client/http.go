@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	service "youtube_service/service"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+// DefaultTimeout bounds every call of the NewHTTP clients without WithTimeout
+const DefaultTimeout = 10 * time.Second
+
+// Option sets an optional setting of NewHTTP
+type Option func(*options)
+
+type options struct {
+	httpClient    *http.Client
+	timeout       time.Duration
+	clientOptions []httptransport.ClientOption
+}
+
+// WithHTTPClient sends the requests with c instead of http.DefaultClient, e.g. for TLS or a proxy
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *options) { o.httpClient = c }
+}
+
+// WithTimeout bounds every call, a zero d leaves them to the context of the caller. The export is
+// only bounded by its context as its response is read while the videos are handed to the caller.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) { o.timeout = d }
+}
+
+// WithClientOptions are given to every request, e.g. httptransport.ClientBefore(auth.BearerToken(token))
+func WithClientOptions(clientOptions ...httptransport.ClientOption) Option {
+	return func(o *options) { o.clientOptions = append(o.clientOptions, clientOptions...) }
+}
+
+// NewHTTP returns a service calling the HTTP API at baseURL, e.g. http://localhost:8080 or
+// https://example.com/youtube when the API is served under a path. The calls carry the request id,
+// the credentials and the Idempotency-Key of their context and are cancelled with it, the failed
+// calls return the error of the service wrapped in an *apierror.Error.
+func NewHTTP(baseURL string, opts ...Option) (service.Service, error) {
+	o := options{timeout: DefaultTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	clientOptions := o.clientOptions
+	if o.httpClient != nil {
+		clientOptions = append(clientOptions[:len(clientOptions):len(clientOptions)], httptransport.SetClient(o.httpClient))
+	}
+	endpoints, err := service.MakeClientEndpoints(baseURL, clientOptions...)
+	if err != nil {
+		return nil, err
+	}
+	if o.timeout > 0 {
+		timeout := timeoutMiddleware(o.timeout)
+		endpoints.ViewVideoEndpoint = timeout(endpoints.ViewVideoEndpoint)
+		endpoints.GetTopNVideosEndpoint = timeout(endpoints.GetTopNVideosEndpoint)
+		endpoints.GetTopNVideosTodayEndpoint = timeout(endpoints.GetTopNVideosTodayEndpoint)
+		endpoints.GetViewsEndpoint = timeout(endpoints.GetViewsEndpoint)
+		endpoints.PostVideoEndpoint = timeout(endpoints.PostVideoEndpoint)
+		endpoints.ImportViewsEndpoint = timeout(endpoints.ImportViewsEndpoint)
+		endpoints.GetViewHistoryEndpoint = timeout(endpoints.GetViewHistoryEndpoint)
+		endpoints.GetLeaderboardDiffEndpoint = timeout(endpoints.GetLeaderboardDiffEndpoint)
+		endpoints.GetAuditEntriesEndpoint = timeout(endpoints.GetAuditEntriesEndpoint)
+		endpoints.GetVideoStatsEndpoint = timeout(endpoints.GetVideoStatsEndpoint)
+	}
+	return endpoints, nil
+}
+
+func timeoutMiddleware(d time.Duration) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+			return next(ctx, request)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"youtube_service/apierror"
+	"youtube_service/auth"
+	"youtube_service/logging"
+	model "youtube_service/model"
+	db "youtube_service/repository"
+	service "youtube_service/service"
+
+	kitlog "github.com/go-kit/kit/log"
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+// fakeService records the arguments of its calls and the request id of their context
+type fakeService struct {
+	mu        sync.Mutex
+	calls     []string
+	requestID string
+	block     chan struct{}
+}
+
+func (s *fakeService) record(ctx context.Context, call string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, call)
+	s.requestID = logging.RequestIDFromContext(ctx)
+}
+
+var top = []model.ResultRedis{{VideoID: "video1", ViewCount: 5}, {VideoID: "video2", ViewCount: 3}}
+
+func (s *fakeService) ViewVideo(ctx context.Context, videoName string) error {
+	s.record(ctx, "ViewVideo "+videoName)
+	if s.block != nil {
+		select {
+		case <-s.block:
+		case <-ctx.Done():
+		}
+	}
+	return nil
+}
+
+func (s *fakeService) GetTopNVideos(ctx context.Context, n int, isLifeTime bool) ([]model.ResultRedis, error) {
+	s.record(ctx, "GetTopNVideos")
+	return top[:n], nil
+}
+
+func (s *fakeService) GetTopNVideosInWindow(ctx context.Context, n int, window string) ([]model.ResultRedis, error) {
+	s.record(ctx, "GetTopNVideosInWindow "+window)
+	return top[:n], nil
+}
+
+func (s *fakeService) GetViews(ctx context.Context, videoName string) (int, error) {
+	s.record(ctx, "GetViews "+videoName)
+	if videoName != "video1" {
+		return 0, db.ErrUnknown
+	}
+	return 5, nil
+}
+
+func (s *fakeService) PostVideo(ctx context.Context, videoName string) error {
+	s.record(ctx, "PostVideo "+videoName)
+	return nil
+}
+
+func (s *fakeService) ImportViews(ctx context.Context, r io.Reader, opts service.ImportOptions) (service.ImportReport, error) {
+	body, _ := io.ReadAll(r)
+	s.record(ctx, "ImportViews "+opts.Format+" "+string(body))
+	return service.ImportReport{DryRun: opts.DryRun, Processed: 1, Imported: 1, LastLine: 1}, nil
+}
+
+func (s *fakeService) ExportVideos(ctx context.Context, isLifeTime bool, each func(model.ResultRedis) error) error {
+	s.record(ctx, "ExportVideos")
+	for _, video := range top {
+		if err := each(video); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fakeService) GetViewHistory(ctx context.Context, videoName string, from, to time.Time, granularity string) ([]model.HistoryPoint, error) {
+	s.record(ctx, "GetViewHistory "+videoName+" "+granularity)
+	return []model.HistoryPoint{{Time: from, Views: 2}}, nil
+}
+
+func (s *fakeService) GetLeaderboardDiff(ctx context.Context, window string, n int) (model.LeaderboardDiff, error) {
+	s.record(ctx, "GetLeaderboardDiff "+window)
+	return model.LeaderboardDiff{Window: window, NewEntries: []model.RankChange{{VideoID: "video1"}}}, nil
+}
+
+func (s *fakeService) GetAuditEntries(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, error) {
+	s.record(ctx, "GetAuditEntries "+filter.Method+" "+filter.VideoID)
+	return []model.AuditEntry{{Method: filter.Method, VideoID: filter.VideoID}}, nil
+}
+
+func (s *fakeService) GetVideoStats(ctx context.Context, videoNames []string, window string) ([]model.VideoStats, error) {
+	s.record(ctx, "GetVideoStats "+strings.Join(videoNames, ",")+" "+window)
+	return []model.VideoStats{{VideoID: videoNames[0], ViewCount: 5, Rank: 1}}, nil
+}
+
+// adminKey is granted every scope by the servers of newServer
+const adminKey = "admin-key"
+
+// newServer serves the API of s under /api like behind a reverse proxy
+func newServer(t *testing.T, s service.Service) *httptest.Server {
+	authenticator, err := auth.NewAuthenticator(auth.Config{
+		Enabled: true,
+		APIKeys: []auth.APIKey{{Name: "admin", Key: adminKey, Scopes: []string{auth.ScopeAdmin}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(http.StripPrefix("/api", service.MakeHandler(s, kitlog.NewNopLogger(), service.WithAuthenticator(authenticator))))
+}
+
+func TestNewHTTP(t *testing.T) {
+	fake := &fakeService{}
+	server := newServer(t, fake)
+	defer server.Close()
+	client, err := NewHTTP(server.URL+"/api/", WithClientOptions(httptransport.ClientBefore(auth.WithAPIKey(adminKey))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := logging.ContextWithRequestID(context.Background(), "req1")
+	from := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	check := func(name string, err error, got, want interface{}, call string) {
+		t.Helper()
+		if err != nil {
+			t.Errorf("%s: err = %v", name, err)
+			return
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %+v, want %+v", name, got, want)
+		}
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		if last := fake.calls[len(fake.calls)-1]; last != call || fake.requestID != "req1" {
+			t.Errorf("%s called %q with request id %q, want %q with req1", name, last, fake.requestID, call)
+		}
+	}
+
+	err = client.ViewVideo(ctx, "video 1")
+	check("ViewVideo", err, nil, nil, "ViewVideo video 1")
+	err = client.PostVideo(ctx, "video/2")
+	check("PostVideo", err, nil, nil, "PostVideo video/2")
+	views, err := client.GetViews(ctx, "video1")
+	check("GetViews", err, views, 5, "GetViews video1")
+	videos, err := client.GetTopNVideos(ctx, 1, true)
+	check("GetTopNVideos lifetime", err, videos, top[:1], "GetTopNVideosInWindow lifetime")
+	videos, err = client.GetTopNVideos(ctx, 2, false)
+	check("GetTopNVideos today", err, videos, top, "GetTopNVideos")
+	videos, err = client.GetTopNVideosInWindow(ctx, 1, "7d")
+	check("GetTopNVideosInWindow", err, videos, top[:1], "GetTopNVideosInWindow 7d")
+	report, err := client.ImportViews(ctx, strings.NewReader("video1,5\n"), service.ImportOptions{Format: service.FormatCSV, DryRun: true})
+	check("ImportViews", err, report, service.ImportReport{DryRun: true, Processed: 1, Imported: 1, LastLine: 1}, "ImportViews csv video1,5\n")
+	var exported []model.ResultRedis
+	err = client.ExportVideos(ctx, true, func(video model.ResultRedis) error {
+		exported = append(exported, video)
+		return nil
+	})
+	check("ExportVideos", err, exported, top, "ExportVideos")
+	history, err := client.GetViewHistory(ctx, "video 1", from, from.Add(48*time.Hour), service.GranularityHour)
+	check("GetViewHistory", err, history, []model.HistoryPoint{{Time: from, Views: 2}}, "GetViewHistory video 1 hour")
+	history, err = client.GetViewHistory(ctx, "channel/video1", from, from.Add(48*time.Hour), service.GranularityDay)
+	check("GetViewHistory with a slash", err, history, []model.HistoryPoint{{Time: from, Views: 2}}, "GetViewHistory channel/video1 day")
+	diff, err := client.GetLeaderboardDiff(ctx, "today", 10)
+	check("GetLeaderboardDiff", err, diff.NewEntries, []model.RankChange{{VideoID: "video1"}}, "GetLeaderboardDiff today")
+	entries, err := client.GetAuditEntries(ctx, model.AuditFilter{Method: "PostVideo", VideoID: "video1", Since: from})
+	check("GetAuditEntries", err, entries, []model.AuditEntry{{Method: "PostVideo", VideoID: "video1"}}, "GetAuditEntries PostVideo video1")
+	stats, err := client.GetVideoStats(ctx, []string{"video 1", "video2"}, "today")
+	check("GetVideoStats", err, stats, []model.VideoStats{{VideoID: "video 1", ViewCount: 5, Rank: 1}}, "GetVideoStats video 1,video2 today")
+
+	_, err = client.GetViews(ctx, "video3")
+	var apiErr *apierror.Error
+	if !errors.Is(err, db.ErrUnknown) || !errors.As(err, &apiErr) || apiErr.RequestID != "req1" {
+		t.Errorf("GetViews(video3) err = %#v, want db.ErrUnknown of req1", err)
+	}
+}
+
+func TestNewHTTP_options(t *testing.T) {
+	fake := &fakeService{block: make(chan struct{})}
+	defer close(fake.block)
+	server := newServer(t, fake)
+	defer server.Close()
+
+	var requests int
+	httpClient := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		requests++
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+	client, err := NewHTTP(server.URL+"/api", WithHTTPClient(httpClient), WithTimeout(50*time.Millisecond), WithClientOptions(httptransport.ClientBefore(auth.WithAPIKey(adminKey))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ViewVideo(context.Background(), "video1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the timeout", err)
+	}
+	if requests != 1 {
+		t.Errorf("requests = %d, want 1 sent with the custom client", requests)
+	}
+
+	//the context of the caller is kept
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.GetViews(ctx, "video1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want the cancellation", err)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
@@ -1,8 +1,14 @@
 package config
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"time"
+	"youtube_service/auth"
+	"youtube_service/ratelimit"
+	"youtube_service/validation"
 
 	"github.com/hashicorp/consul/api"
 )
@@ -10,43 +16,333 @@ import (
 type Config struct {
 	RedisURL string `json:"redisURL"`
 	RedisKey string `json:"redisKey"`
+	//HourlyBuckets keeps per-hour view counts next to the per-day ones
+	HourlyBuckets bool `json:"hourlyBuckets"`
+	//RollingRefreshSeconds is how often the 24h and 7d leaderboards are rebuilt from the hourly buckets
+	RollingRefreshSeconds int `json:"rollingRefreshSeconds"`
+	//SnapshotSeconds is how often the top of every window is saved for the leaderboard changes
+	SnapshotSeconds int `json:"snapshotSeconds"`
+	//TraceExporter is where the spans go, "stdout", "otlp" or empty to only propagate the trace headers
+	TraceExporter string `json:"traceExporter"`
+	//TraceEndpoint is the host:port of the OTLP/HTTP collector
+	TraceEndpoint string `json:"traceEndpoint"`
+	//LogFormat is "logfmt" or "json"
+	LogFormat string `json:"logFormat"`
+	//LogLevel is the lowest level logged, "debug", "info", "warn" or "error"
+	LogLevel string `json:"logLevel"`
+	//RateLimits are the token buckets of the view ingestion per API key, per client IP and per video,
+	//they are reloaded while running when the consul key changes
+	RateLimits ratelimit.Limits `json:"rateLimits"`
+	//RedisTimeoutMillis is the timeout of every redis call but the exports
+	RedisTimeoutMillis int `json:"redisTimeoutMillis"`
+	//BreakerFailures is the number of failed redis calls in a row opening the circuit breaker
+	BreakerFailures int `json:"breakerFailures"`
+	//BreakerOpenSeconds is how long the breaker stays open before trying redis again
+	BreakerOpenSeconds int `json:"breakerOpenSeconds"`
+	//WriteBufferSize is the number of videos whose writes are kept while the breaker is open
+	WriteBufferSize int `json:"writeBufferSize"`
+	//CacheTTLMillis is how long the leaderboards are cached by the service and by the clients
+	CacheTTLMillis int `json:"cacheTTLMillis"`
+	//Auth asks for a JWT or an API key on every route but /metrics and /health when it is enabled
+	Auth auth.Config `json:"auth"`
+	//AuditSink is where the mutations are recorded, "redis", "file" or empty to not record them
+	AuditSink string `json:"auditSink"`
+	//AuditFile is the JSON lines file of the file sink
+	AuditFile string `json:"auditFile"`
+	//AuditMaxEntries is about the number of entries kept in the redis stream
+	AuditMaxEntries int `json:"auditMaxEntries"`
+	//AuditViewSampleRate is the share of the views recorded, a negative rate records none
+	AuditViewSampleRate float64 `json:"auditViewSampleRate"`
+	//VideoIDRules are how the video IDs of the requests and of the imports are normalised and checked
+	VideoIDRules validation.Rules `json:"videoIDRules"`
+	//IdempotencyTTLSeconds is how long the responses of the writes with an Idempotency-Key are replayed
+	IdempotencyTTLSeconds int `json:"idempotencyTTLSeconds"`
+	//HTTPAddr is where the HTTP API, the health and the metrics are served
+	HTTPAddr string `json:"httpAddr"`
+	//GRPCAddr is where the gRPC transport listens
+	GRPCAddr string `json:"grpcAddr"`
+	//LiveCountsMaxRate is how many view count updates per second a live counter connection gets at most
+	LiveCountsMaxRate float64 `json:"liveCountsMaxRate"`
+	//EventBroker is where the views and the new videos are published, "redis", "nats", "kafka" or empty to not publish them
+	EventBroker string `json:"eventBroker"`
+	//EventTopic is the redis stream, the NATS subject or the Kafka topic of the events, "<redisKey>.events" by default
+	EventTopic string `json:"eventTopic"`
+	//EventBrokerAddr is the host:port of the NATS server or the URL of the Kafka REST Proxy
+	EventBrokerAddr string `json:"eventBrokerAddr"`
+	//EventMaxEntries is about the number of events kept in the redis stream
+	EventMaxEntries int `json:"eventMaxEntries"`
+	//EventBatchSize is the most events sent together
+	EventBatchSize int `json:"eventBatchSize"`
+	//EventFlushMillis is how long an event waits for its batch to fill up
+	EventFlushMillis int `json:"eventFlushMillis"`
+	//EventBufferSize is the number of events waiting for a batch, the next ones go to the outbox
+	EventBufferSize int `json:"eventBufferSize"`
+	//EventRetrySeconds is how often the events which failed to be sent are sent again
+	EventRetrySeconds int `json:"eventRetrySeconds"`
+	//EventTimeoutMillis is the timeout of every send to the broker
+	EventTimeoutMillis int `json:"eventTimeoutMillis"`
+	//ConsumeSource is the queue of the views applied in consume mode, "redis" or "nats" for JetStream
+	ConsumeSource string `json:"consumeSource"`
+	//ConsumeTopic is the redis stream or the JetStream stream of the views, "<redisKey>.views" by default
+	ConsumeTopic string `json:"consumeTopic"`
+	//ConsumeGroup is the redis consumer group or the JetStream durable consumer shared by the instances
+	ConsumeGroup string `json:"consumeGroup"`
+	//ConsumeBrokerAddr is the host:port of the NATS server
+	ConsumeBrokerAddr string `json:"consumeBrokerAddr"`
+	//ConsumeDeadLetters is the redis stream or the NATS subject of the views which cannot be applied, "<consumeTopic>.dead" by default
+	ConsumeDeadLetters string `json:"consumeDeadLetters"`
+	//ConsumeConcurrency is the number of views applied at the same time
+	ConsumeConcurrency int `json:"consumeConcurrency"`
+	//ConsumeBatchSize is the most views fetched at once
+	ConsumeBatchSize int `json:"consumeBatchSize"`
+	//ConsumeMaxDeliveries is how many times a failing view is tried before it goes to the dead letters
+	ConsumeMaxDeliveries int `json:"consumeMaxDeliveries"`
+	//ConsumeAckWaitSeconds is how long a view delivered to an instance waits for its ack before it is delivered again
+	ConsumeAckWaitSeconds int `json:"consumeAckWaitSeconds"`
+	//ConsumeLagSeconds is how often the lag of the consumer is measured
+	ConsumeLagSeconds int `json:"consumeLagSeconds"`
+	//ConsumeTimeoutMillis is the timeout of every view applied and every call to the queue
+	ConsumeTimeoutMillis int `json:"consumeTimeoutMillis"`
+	//ConsumeDedupSeconds is how long the IDs of the applied views are kept to drop the views delivered again
+	ConsumeDedupSeconds int `json:"consumeDedupSeconds"`
 }
 
 const (
 	defaultRedisKey = "videos"
 	defaultRedisURL = "localhost:6379"
+
+	defaultRollingRefreshSeconds = 60
+	defaultSnapshotSeconds       = 300
+	defaultTraceEndpoint         = "localhost:4318"
+	defaultLogFormat             = "logfmt"
+	defaultLogLevel              = "info"
+	defaultRedisTimeoutMillis    = 500
+	defaultBreakerFailures       = 5
+	defaultBreakerOpenSeconds    = 30
+	defaultWriteBufferSize       = 10000
+	defaultCacheTTLMillis        = 1000
+	defaultAuditFile             = "audit.log"
+	defaultAuditMaxEntries       = 100000
+	defaultAuditViewSampleRate   = 0.01
+	defaultIdempotencyTTLSeconds = 24 * 60 * 60
+	defaultHTTPAddr              = ":8080"
+	defaultGRPCAddr              = ":9090"
+	defaultLiveCountsMaxRate     = 4
+	defaultEventMaxEntries       = 1000000
+	defaultEventBatchSize        = 100
+	defaultEventFlushMillis      = 200
+	defaultEventBufferSize       = 10000
+	defaultEventRetrySeconds     = 10
+	defaultEventTimeoutMillis    = 2000
+	defaultConsumeGroup          = "youtube_service"
+	defaultConsumeConcurrency    = 8
+	defaultConsumeBatchSize      = 100
+	defaultConsumeMaxDeliveries  = 5
+	defaultConsumeAckWaitSeconds = 30
+	defaultConsumeLagSeconds     = 15
+	defaultConsumeTimeoutMillis  = 5000
+	defaultConsumeDedupSeconds   = 86400
+
+	watchRetryInterval = 5 * time.Second
 )
 
-func SetConfigs(pair *api.KVPair) *Config {
+// Rejection is a field of the configs which failed its validation, the field keeps its previous value
+type Rejection struct {
+	Field string
+	Err   error
+}
+
+func (r Rejection) Error() string {
+	return fmt.Sprintf("config %s rejected: %v", r.Field, r.Err)
+}
+
+var errMissing = errors.New("is missing")
+
+// SetConfigs reads the configs from the consul pair, the defaults are used when there is no pair
+// and in place of the rejected fields
+func SetConfigs(pair *api.KVPair) (*Config, []Rejection, error) {
+	return ReloadConfigs(pair, defaultConfig())
+}
 
+// ReloadConfigs reads the configs from the consul pair over the last good ones, which are kept
+// when there is no pair, and every field failing its validation keeps its value in last
+func ReloadConfigs(pair *api.KVPair, last *Config) (*Config, []Rejection, error) {
 	if pair == nil {
-		return &Config{
-			RedisURL: defaultRedisURL,
-			RedisKey: defaultRedisKey,
-		}
+		return last, nil, nil
 	}
 
 	var config Config
 	err := json.Unmarshal(pair.Value, &config)
 	if err != nil {
-		log.Fatalf("Failed to unmarshal JSON: %v", err)
+		return nil, nil, err
 	}
 
-	if !isValid(&config) {
-		return &Config{
-			RedisURL: defaultRedisURL,
-			RedisKey: defaultRedisKey,
-		}
+	rejected := validate(&config, last)
+	setDefaults(&config)
+	return &config, rejected, nil
+}
+
+func defaultConfig() *Config {
+	config := &Config{
+		RedisURL: defaultRedisURL,
+		RedisKey: defaultRedisKey,
 	}
-	return &config
+	setDefaults(config)
+	return config
 }
 
-func isValid(conf *Config) bool {
-	if conf.RedisKey == "" {
-		return false
+// filling the optional configs which are not set
+func setDefaults(conf *Config) {
+	if conf.RollingRefreshSeconds <= 0 {
+		conf.RollingRefreshSeconds = defaultRollingRefreshSeconds
+	}
+	if conf.SnapshotSeconds <= 0 {
+		conf.SnapshotSeconds = defaultSnapshotSeconds
+	}
+	if conf.TraceEndpoint == "" {
+		conf.TraceEndpoint = defaultTraceEndpoint
+	}
+	if conf.LogFormat == "" {
+		conf.LogFormat = defaultLogFormat
+	}
+	if conf.LogLevel == "" {
+		conf.LogLevel = defaultLogLevel
+	}
+	if conf.RedisTimeoutMillis <= 0 {
+		conf.RedisTimeoutMillis = defaultRedisTimeoutMillis
+	}
+	if conf.BreakerFailures <= 0 {
+		conf.BreakerFailures = defaultBreakerFailures
+	}
+	if conf.BreakerOpenSeconds <= 0 {
+		conf.BreakerOpenSeconds = defaultBreakerOpenSeconds
+	}
+	if conf.WriteBufferSize <= 0 {
+		conf.WriteBufferSize = defaultWriteBufferSize
+	}
+	if conf.CacheTTLMillis <= 0 {
+		conf.CacheTTLMillis = defaultCacheTTLMillis
+	}
+	if conf.IdempotencyTTLSeconds <= 0 {
+		conf.IdempotencyTTLSeconds = defaultIdempotencyTTLSeconds
+	}
+	if conf.HTTPAddr == "" {
+		conf.HTTPAddr = defaultHTTPAddr
+	}
+	if conf.GRPCAddr == "" {
+		conf.GRPCAddr = defaultGRPCAddr
+	}
+	if conf.LiveCountsMaxRate <= 0 {
+		conf.LiveCountsMaxRate = defaultLiveCountsMaxRate
+	}
+	if conf.AuditFile == "" {
+		conf.AuditFile = defaultAuditFile
+	}
+	if conf.AuditMaxEntries <= 0 {
+		conf.AuditMaxEntries = defaultAuditMaxEntries
+	}
+	if conf.AuditViewSampleRate == 0 {
+		conf.AuditViewSampleRate = defaultAuditViewSampleRate
 	}
+	if conf.EventTopic == "" {
+		conf.EventTopic = conf.RedisKey + ".events"
+	}
+	if conf.EventMaxEntries <= 0 {
+		conf.EventMaxEntries = defaultEventMaxEntries
+	}
+	if conf.EventBatchSize <= 0 {
+		conf.EventBatchSize = defaultEventBatchSize
+	}
+	if conf.EventFlushMillis <= 0 {
+		conf.EventFlushMillis = defaultEventFlushMillis
+	}
+	if conf.EventBufferSize <= 0 {
+		conf.EventBufferSize = defaultEventBufferSize
+	}
+	if conf.EventRetrySeconds <= 0 {
+		conf.EventRetrySeconds = defaultEventRetrySeconds
+	}
+	if conf.EventTimeoutMillis <= 0 {
+		conf.EventTimeoutMillis = defaultEventTimeoutMillis
+	}
+	if conf.ConsumeTopic == "" {
+		conf.ConsumeTopic = conf.RedisKey + ".views"
+	}
+	if conf.ConsumeGroup == "" {
+		conf.ConsumeGroup = defaultConsumeGroup
+	}
+	if conf.ConsumeDeadLetters == "" {
+		conf.ConsumeDeadLetters = conf.ConsumeTopic + ".dead"
+	}
+	if conf.ConsumeConcurrency <= 0 {
+		conf.ConsumeConcurrency = defaultConsumeConcurrency
+	}
+	if conf.ConsumeBatchSize <= 0 {
+		conf.ConsumeBatchSize = defaultConsumeBatchSize
+	}
+	if conf.ConsumeMaxDeliveries <= 0 {
+		conf.ConsumeMaxDeliveries = defaultConsumeMaxDeliveries
+	}
+	if conf.ConsumeAckWaitSeconds <= 0 {
+		conf.ConsumeAckWaitSeconds = defaultConsumeAckWaitSeconds
+	}
+	if conf.ConsumeLagSeconds <= 0 {
+		conf.ConsumeLagSeconds = defaultConsumeLagSeconds
+	}
+	if conf.ConsumeTimeoutMillis <= 0 {
+		conf.ConsumeTimeoutMillis = defaultConsumeTimeoutMillis
+	}
+	if conf.ConsumeDedupSeconds <= 0 {
+		conf.ConsumeDedupSeconds = defaultConsumeDedupSeconds
+	}
+}
+
+// validate checks every field on its own, a rejected field is set back to its value in last
+func validate(conf *Config, last *Config) []Rejection {
+	var rejected []Rejection
 	if conf.RedisURL == "" {
-		return false
+		rejected = append(rejected, Rejection{Field: "redisURL", Err: errMissing})
+		conf.RedisURL = last.RedisURL
+	}
+	if conf.RedisKey == "" {
+		rejected = append(rejected, Rejection{Field: "redisKey", Err: errMissing})
+		conf.RedisKey = last.RedisKey
+	}
+	if err := conf.RateLimits.Validate(); err != nil {
+		rejected = append(rejected, Rejection{Field: "rateLimits", Err: err})
+		conf.RateLimits = last.RateLimits
+	}
+	return rejected
+}
+
+// WatchConfigs blocks on the consul key from waitIndex and calls onChange with every new version read
+// over last until ctx is done, with the fields it rejected. The versions which fail to unmarshal are
+// passed to onError and the last good version is kept.
+func WatchConfigs(ctx context.Context, kv *api.KV, key string, waitIndex uint64, last *Config, onChange func(*Config, []Rejection), onError func(error)) {
+	for ctx.Err() == nil {
+		pair, meta, err := kv.Get(key, (&api.QueryOptions{WaitIndex: waitIndex}).WithContext(ctx))
+		if err != nil {
+			if ctx.Err() == nil {
+				onError(err)
+				time.Sleep(watchRetryInterval)
+			}
+			continue
+		}
+		//the index goes back when the key is recreated, starting over avoids blocking forever
+		if meta.LastIndex < waitIndex {
+			waitIndex = 0
+			continue
+		}
+		if meta.LastIndex == waitIndex {
+			continue
+		}
+		waitIndex = meta.LastIndex
+		config, rejected, err := ReloadConfigs(pair, last)
+		if err != nil {
+			onError(err)
+			continue
+		}
+		last = config
+		onChange(config, rejected)
 	}
-	return true
 }
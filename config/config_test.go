@@ -0,0 +1,57 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"youtube_service/ratelimit"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func TestReloadConfigs(t *testing.T) {
+	last := defaultConfig()
+	last.RedisURL = "redis:6379"
+	last.RateLimits = ratelimit.Limits{PerIP: ratelimit.Limit{Rate: 10}}
+
+	tests := []struct {
+		name         string
+		value        string
+		wantURL      string
+		wantKey      string
+		wantLimits   ratelimit.Limits
+		wantRejected []string
+	}{
+		{name: "valid", value: `{"redisURL": "other:6379", "redisKey": "views", "rateLimits": {"perIP": {"rate": 5}}}`,
+			wantURL: "other:6379", wantKey: "views", wantLimits: ratelimit.Limits{PerIP: ratelimit.Limit{Rate: 5}}},
+		//the other fields are still applied
+		{name: "missing redis settings", value: `{"rateLimits": {"perIP": {"rate": 5}}}`,
+			wantURL: "redis:6379", wantKey: defaultRedisKey, wantLimits: ratelimit.Limits{PerIP: ratelimit.Limit{Rate: 5}}, wantRejected: []string{"redisURL", "redisKey"}},
+		{name: "malformed trusted proxy", value: `{"redisURL": "other:6379", "redisKey": "views", "rateLimits": {"perIP": {"rate": 5}, "trustedProxies": ["10.0.0.0/33"]}}`,
+			wantURL: "other:6379", wantKey: "views", wantLimits: last.RateLimits, wantRejected: []string{"rateLimits"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rejected, err := ReloadConfigs(&api.KVPair{Value: []byte(tt.value)}, last)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.RedisURL != tt.wantURL || got.RedisKey != tt.wantKey || !reflect.DeepEqual(got.RateLimits, tt.wantLimits) {
+				t.Errorf("ReloadConfigs() = %q %q %+v, want %q %q %+v", got.RedisURL, got.RedisKey, got.RateLimits, tt.wantURL, tt.wantKey, tt.wantLimits)
+			}
+			var fields []string
+			for _, r := range rejected {
+				fields = append(fields, r.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantRejected) {
+				t.Errorf("rejected = %v, want %v", fields, tt.wantRejected)
+			}
+		})
+	}
+
+	if got, _, err := ReloadConfigs(nil, last); err != nil || got != last {
+		t.Errorf("ReloadConfigs(nil) = %p, %v, want the last configs", got, err)
+	}
+	if _, _, err := ReloadConfigs(&api.KVPair{Value: []byte(`{`)}, last); err == nil {
+		t.Error("ReloadConfigs() of malformed json = nil error")
+	}
+}
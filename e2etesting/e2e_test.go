@@ -9,7 +9,9 @@ import (
 )
 
 func Test_service_PostVideo(t *testing.T) {
-	mux, _ := setup.SetUp()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mux, _ := setup.SetUp(ctx)
 	testServer := httptest.NewServer(mux)
 	defer testServer.Close()
 
@@ -28,7 +30,9 @@ func Test_service_PostVideo(t *testing.T) {
 
 func Test_service_ViewVideo(t *testing.T) {
 
-	mux, _ := setup.SetUp()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mux, _ := setup.SetUp(ctx)
 	testServer := httptest.NewServer(mux)
 	defer testServer.Close()
 
@@ -45,7 +49,9 @@ func Test_service_ViewVideo(t *testing.T) {
 }
 
 func Test_service_GetTopNVideos(t *testing.T) {
-	mux, _ := setup.SetUp()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mux, _ := setup.SetUp(ctx)
 	testServer := httptest.NewServer(mux)
 	defer testServer.Close()
 
@@ -65,7 +71,9 @@ func Test_service_GetTopNVideos(t *testing.T) {
 }
 
 func Test_service_GetViews(t *testing.T) {
-	mux, _ := setup.SetUp()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mux, _ := setup.SetUp(ctx)
 	testServer := httptest.NewServer(mux)
 	defer testServer.Close()
 
@@ -0,0 +1,274 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+	"youtube_service/logging"
+
+	log1 "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-kit/kit/metrics"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	"github.com/go-redis/redis/v8"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ErrUnknownSource = errors.New("unknown event source")
+	// ErrDuplicate is returned by a Handler for an event it already applied, the event is acked and skipped
+	ErrDuplicate = errors.New("duplicate event")
+	errMalformed = errors.New("malformed event")
+)
+
+// Message is an event read from a queue, it is delivered again until it is acked
+type Message struct {
+	Event Event
+	// Deliveries is the number of times the message was delivered, this one included
+	Deliveries int
+	// Err is why the message could not be decoded into an event
+	Err error
+
+	// id is the stream entry id or the ack subject of the message, data its body
+	id   string
+	data []byte
+}
+
+// Lag is how far a consumer is behind its queue
+type Lag struct {
+	// Pending are the messages delivered but not acked yet
+	Pending int64
+	// Undelivered are the messages not delivered yet, -1 when the queue cannot tell
+	Undelivered int64
+}
+
+// Source is a queue read by a group of consumers, every message goes to one of them
+type Source interface {
+	// Fetch returns up to n messages, the ones delivered to a consumer which did not ack them in time
+	// first, it waits a little for them and returns none when there is nothing to read
+	Fetch(ctx context.Context, n int) ([]Message, error)
+	Ack(ctx context.Context, msg Message) error
+	// DeadLetter moves msg aside with why it could not be applied and acks it
+	DeadLetter(ctx context.Context, msg Message, reason error) error
+	Lag(ctx context.Context) (Lag, error)
+}
+
+// sources of the events
+const (
+	SourceRedis     = "redis"
+	SourceJetStream = "nats"
+)
+
+// NewSource returns the Source of source, topic is the redis stream or the JetStream stream read by the
+// consumer group or the durable consumer group, addr is the NATS server host:port and the messages not
+// acked within ackWait are delivered again
+func NewSource(source string, client *redis.Client, topic, group, consumer, deadLetters, addr string, ackWait, timeout time.Duration) (Source, error) {
+	switch source {
+	case SourceRedis:
+		return NewRedisSource(client, topic, group, consumer, deadLetters, ackWait), nil
+	case SourceJetStream:
+		return NewJetStreamSource(addr, topic, group, deadLetters, ackWait, timeout), nil
+	}
+	return nil, ErrUnknownSource
+}
+
+// Handler applies an event, a failed event is delivered again unless the error is Permanent
+type Handler func(ctx context.Context, event Event) error
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as the error of an event which would fail again, the event goes to the dead letters
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// ConsumerOptions are the concurrency and the retries of a Consumer
+type ConsumerOptions struct {
+	// Concurrency is the number of events applied at the same time
+	Concurrency int
+	// BatchSize is the most messages fetched at once
+	BatchSize int
+	// MaxDeliveries is how many times a failing event is tried before it goes to the dead letters
+	MaxDeliveries int
+	// LagInterval is how often the lag of the queue is measured
+	LagInterval time.Duration
+	// Timeout of every event applied and every call to the queue
+	Timeout time.Duration
+}
+
+// ConsumerMetrics are the counts of the messages per result and the lag of the queue per state
+type ConsumerMetrics struct {
+	Messages metrics.Counter
+	Lag      metrics.Gauge
+}
+
+// NewPrometheusConsumerMetrics returns the ConsumerMetrics registered in registerer
+func NewPrometheusConsumerMetrics(registerer stdprometheus.Registerer) ConsumerMetrics {
+	messages := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{
+		Namespace: "api",
+		Subsystem: "youtube_service",
+		Name:      "consumed_messages_total",
+		Help:      "Number of messages consumed per result: applied, skipped, retried or dead_lettered.",
+	}, []string{"result"})
+	lag := stdprometheus.NewGaugeVec(stdprometheus.GaugeOpts{
+		Namespace: "api",
+		Subsystem: "youtube_service",
+		Name:      "consumer_lag",
+		Help:      "Number of messages of the queue not acked yet per state: pending or undelivered.",
+	}, []string{"state"})
+	registerer.MustRegister(messages, lag)
+	return ConsumerMetrics{
+		Messages: kitprometheus.NewCounter(messages),
+		Lag:      kitprometheus.NewGauge(lag),
+	}
+}
+
+// results of the consumed messages
+const (
+	resultApplied      = "applied"
+	resultSkipped      = "skipped"
+	resultRetried      = "retried"
+	resultDeadLettered = "dead_lettered"
+)
+
+// the wait before fetching again after the queue failed
+const fetchRetryInterval = time.Second
+
+// Consumer applies the view events of a Source with a Handler, the other events are skipped
+type Consumer struct {
+	source  Source
+	handle  Handler
+	opts    ConsumerOptions
+	metrics ConsumerMetrics
+	logger  log1.Logger
+}
+
+// NewConsumer returns a Consumer of source, Run has to be called
+func NewConsumer(source Source, handle Handler, opts ConsumerOptions, metrics ConsumerMetrics, logger log1.Logger) *Consumer {
+	return &Consumer{
+		source:  source,
+		handle:  handle,
+		opts:    opts,
+		metrics: metrics,
+		logger:  logger,
+	}
+}
+
+// Run fetches and applies the messages until ctx is done, the messages already fetched are applied
+// before it returns
+func (c *Consumer) Run(ctx context.Context) {
+	messages := make(chan Message)
+	var workers sync.WaitGroup
+	for i := 0; i < c.opts.Concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for msg := range messages {
+				c.process(msg)
+			}
+		}()
+	}
+	go c.measureLag(ctx)
+	defer func() {
+		close(messages)
+		workers.Wait()
+	}()
+	for ctx.Err() == nil {
+		batch, err := c.source.Fetch(ctx, c.opts.BatchSize)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			level.Warn(c.logger).Log("msg", "Failed to fetch events", "err", err)
+			select {
+			case <-time.After(fetchRetryInterval):
+			case <-ctx.Done():
+			}
+			continue
+		}
+		//the fetched messages are handed over even while stopping, they would wait for a redelivery otherwise
+		for _, msg := range batch {
+			messages <- msg
+		}
+	}
+}
+
+// process applies msg and acks it, a failed event is left to be delivered again or moved to the dead letters
+func (c *Consumer) process(msg Message) {
+	requestID := msg.Event.RequestID
+	if requestID == "" {
+		requestID = "event-" + msg.Event.ID
+	}
+	ctx, cancel := context.WithTimeout(logging.ContextWithRequestID(context.Background(), requestID), c.opts.Timeout)
+	defer cancel()
+	logger := logging.WithContext(ctx, c.logger)
+
+	if msg.Err != nil {
+		c.deadLetter(ctx, logger, msg, msg.Err)
+		return
+	}
+	if msg.Event.Type != TypeView {
+		c.ack(ctx, logger, msg, resultSkipped)
+		return
+	}
+	err := c.handle(ctx, msg.Event)
+	var permanent *permanentError
+	switch {
+	case err == nil:
+		c.ack(ctx, logger, msg, resultApplied)
+	case errors.Is(err, ErrDuplicate):
+		c.ack(ctx, logger, msg, resultSkipped)
+	case errors.As(err, &permanent) || msg.Deliveries >= c.opts.MaxDeliveries:
+		c.deadLetter(ctx, logger, msg, err)
+	default:
+		level.Warn(logger).Log("msg", "Failed to apply event, it will be delivered again", "event", msg.Event.ID, "deliveries", msg.Deliveries, "err", err)
+		c.metrics.Messages.With("result", resultRetried).Add(1)
+	}
+}
+
+// ack acks msg, a failed ack only delivers it again
+func (c *Consumer) ack(ctx context.Context, logger log1.Logger, msg Message, result string) {
+	if err := c.source.Ack(ctx, msg); err != nil {
+		level.Warn(logger).Log("msg", "Failed to ack event", "event", msg.Event.ID, "err", err)
+	}
+	c.metrics.Messages.With("result", result).Add(1)
+}
+
+func (c *Consumer) deadLetter(ctx context.Context, logger log1.Logger, msg Message, reason error) {
+	level.Error(logger).Log("msg", "Moving event to the dead letters", "event", msg.Event.ID, "deliveries", msg.Deliveries, "reason", reason)
+	if err := c.source.DeadLetter(ctx, msg, reason); err != nil {
+		level.Error(logger).Log("msg", "Failed to move event to the dead letters", "event", msg.Event.ID, "err", err)
+	}
+	c.metrics.Messages.With("result", resultDeadLettered).Add(1)
+}
+
+// measureLag sets the lag gauges every LagInterval until ctx is done
+func (c *Consumer) measureLag(ctx context.Context) {
+	ticker := time.NewTicker(c.opts.LagInterval)
+	defer ticker.Stop()
+	for {
+		lagCtx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+		lag, err := c.source.Lag(lagCtx)
+		cancel()
+		if err != nil {
+			level.Warn(c.logger).Log("msg", "Failed to measure the consumer lag", "err", err)
+		} else {
+			c.metrics.Lag.With("state", "pending").Set(float64(lag.Pending))
+			if lag.Undelivered >= 0 {
+				c.metrics.Lag.With("state", "undelivered").Set(float64(lag.Undelivered))
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
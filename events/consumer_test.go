@@ -0,0 +1,275 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeSource hands out its messages once and records what happened to them
+type fakeSource struct {
+	mu       sync.Mutex
+	messages []Message
+	acked    []string
+	dead     []string
+	lag      Lag
+}
+
+func (s *fakeSource) Fetch(ctx context.Context, n int) ([]Message, error) {
+	s.mu.Lock()
+	messages := s.messages
+	s.messages = nil
+	s.mu.Unlock()
+	if len(messages) == 0 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return messages, nil
+}
+
+func (s *fakeSource) Ack(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.acked = append(s.acked, msg.id)
+	return nil
+}
+
+func (s *fakeSource) DeadLetter(ctx context.Context, msg Message, reason error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dead = append(s.dead, msg.id)
+	return nil
+}
+
+func (s *fakeSource) Lag(ctx context.Context) (Lag, error) {
+	return s.lag, nil
+}
+
+// gathered returns the values of the metrics of registry by name and label value
+func gathered(t *testing.T, registry *prometheus.Registry) map[string]float64 {
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			name := family.GetName() + "{" + metric.GetLabel()[0].GetValue() + "}"
+			if metric.GetCounter() != nil {
+				values[name] = metric.GetCounter().GetValue()
+			} else {
+				values[name] = metric.GetGauge().GetValue()
+			}
+		}
+	}
+	return values
+}
+
+func TestConsumer(t *testing.T) {
+	view := func(id, videoID string, deliveries int) Message {
+		return Message{Event: Event{ID: id, Type: TypeView, VideoID: videoID}, Deliveries: deliveries, id: id}
+	}
+	source := &fakeSource{
+		messages: []Message{
+			view("applied", "video1", 1),
+			view("duplicate", "seen", 1),
+			view("retried", "down", 1),
+			view("exhausted", "down", 3),
+			view("rejected", "bad id", 1),
+			{Event: Event{ID: "posted", Type: TypeVideoPosted, VideoID: "video1"}, Deliveries: 1, id: "posted"},
+			{Event: Event{ID: "malformed"}, Deliveries: 1, Err: errMalformed, id: "malformed"},
+		},
+		lag: Lag{Pending: 2, Undelivered: 5},
+	}
+	var mu sync.Mutex
+	var applied []string
+	handle := func(ctx context.Context, event Event) error {
+		switch event.VideoID {
+		case "down":
+			return errors.New("redis is down")
+		case "bad id":
+			return Permanent(errors.New("invalid video id"))
+		case "seen":
+			return ErrDuplicate
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		applied = append(applied, event.VideoID)
+		return nil
+	}
+	registry := prometheus.NewRegistry()
+	c := NewConsumer(source, handle, ConsumerOptions{
+		Concurrency:   3,
+		BatchSize:     10,
+		MaxDeliveries: 3,
+		LagInterval:   time.Hour,
+		Timeout:       time.Second,
+	}, NewPrometheusConsumerMetrics(registry), kitlog.NewNopLogger())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	c.Run(ctx)
+
+	sort.Strings(source.acked)
+	sort.Strings(source.dead)
+	if want := []string{"applied", "duplicate", "posted"}; !reflect.DeepEqual(source.acked, want) {
+		t.Errorf("acked = %v, want %v", source.acked, want)
+	}
+	if want := []string{"exhausted", "malformed", "rejected"}; !reflect.DeepEqual(source.dead, want) {
+		t.Errorf("dead letters = %v, want %v", source.dead, want)
+	}
+	if want := []string{"video1"}; !reflect.DeepEqual(applied, want) {
+		t.Errorf("applied = %v, want %v", applied, want)
+	}
+	want := map[string]float64{
+		"api_youtube_service_consumed_messages_total{applied}":       1,
+		"api_youtube_service_consumed_messages_total{skipped}":       2,
+		"api_youtube_service_consumed_messages_total{retried}":       1,
+		"api_youtube_service_consumed_messages_total{dead_lettered}": 3,
+		"api_youtube_service_consumer_lag{pending}":                  2,
+		"api_youtube_service_consumer_lag{undelivered}":              5,
+	}
+	if got := gathered(t, registry); !reflect.DeepEqual(got, want) {
+		t.Errorf("metrics = %v, want %v", got, want)
+	}
+}
+
+func TestRedisMessage(t *testing.T) {
+	event, _ := json.Marshal(Event{ID: "e1", Type: TypeVideoPosted, VideoID: "video1"})
+	tests := []struct {
+		name    string
+		values  map[string]interface{}
+		want    Event
+		wantErr bool
+	}{
+		{name: "event", values: map[string]interface{}{"event": string(event)}, want: Event{ID: "e1", Type: TypeVideoPosted, VideoID: "video1"}},
+		{name: "video id only", values: map[string]interface{}{"videoId": "video2"}, want: Event{ID: "1-0", Type: TypeView, VideoID: "video2"}},
+		{name: "not json", values: map[string]interface{}{"event": "{"}, want: Event{ID: "1-0", Type: TypeView}, wantErr: true},
+		{name: "no video", values: map[string]interface{}{"views": "3"}, want: Event{ID: "1-0", Type: TypeView}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := redisMessage(redis.XMessage{ID: "1-0", Values: tt.values}, 2)
+			if msg.Event != tt.want || (msg.Err != nil) != tt.wantErr || msg.Deliveries != 2 || msg.id != "1-0" {
+				t.Errorf("redisMessage() = %+v, want %+v with error %v", msg, tt.want, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(msg.Err, errMalformed) {
+				t.Errorf("error = %v, want errMalformed", msg.Err)
+			}
+		})
+	}
+}
+
+// jetStream makes the NATS test server a JetStream server delivering the messages of its queue
+type jetStream struct {
+	mu     sync.Mutex
+	queue  []jsMessage
+	acks   map[string]string
+	dead   []string
+	pulled []string
+}
+
+type jsMessage struct {
+	ack  string
+	data string
+}
+
+func (js *jetStream) handle(w natsWriter, subject, reply string, payload []byte) bool {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	switch subject {
+	case "$JS.API.CONSUMER.DURABLE.CREATE.views.youtube_service":
+		w.msg(reply, "", `{"type":"io.nats.jetstream.api.v1.consumer_create_response"}`)
+	case "$JS.API.CONSUMER.INFO.views.youtube_service":
+		w.msg(reply, "", `{"num_pending":4,"num_ack_pending":1}`)
+	case "$JS.API.CONSUMER.MSG.NEXT.views.youtube_service":
+		var request jsPullRequest
+		json.Unmarshal(payload, &request)
+		js.pulled = append(js.pulled, string(payload))
+		for ; len(js.queue) > 0 && request.Batch > 0; request.Batch-- {
+			w.msg(reply, js.queue[0].ack, js.queue[0].data)
+			js.queue = js.queue[1:]
+		}
+		if request.Batch > 0 {
+			w.status(reply, "404 No Messages")
+		}
+	case "views.dead":
+		js.dead = append(js.dead, string(payload))
+	default:
+		if !strings.HasPrefix(subject, "$JS.ACK.") {
+			return false
+		}
+		js.acks[subject] = string(payload)
+	}
+	return true
+}
+
+func TestJetStreamSource(t *testing.T) {
+	server := newNATSServer(t)
+	js := &jetStream{
+		queue: []jsMessage{
+			{ack: "$JS.ACK.views.youtube_service.2.1.1.1686000000000000000.1", data: `{"id":"e1","videoId":"video1"}`},
+			{ack: "$JS.ACK.views.youtube_service.1.2.2.1686000000000000000.0", data: `not json`},
+		},
+		acks: map[string]string{},
+	}
+	server.handler = js.handle
+	source := NewJetStreamSource(server.listener.Addr().String(), "views", "youtube_service", "views.dead", 30*time.Second, time.Second)
+	ctx := context.Background()
+
+	messages, err := source.Fetch(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("Fetch() = %+v, want 2 messages", messages)
+	}
+	if got, want := messages[0].Event, (Event{ID: "e1", Type: TypeView, VideoID: "video1"}); got != want || messages[0].Deliveries != 2 || messages[0].Err != nil {
+		t.Errorf("message = %+v, want %+v delivered twice", messages[0], want)
+	}
+	if messages[1].Event.ID != "2" || !errors.Is(messages[1].Err, errMalformed) {
+		t.Errorf("message = %+v, want a malformed message of sequence 2", messages[1])
+	}
+	if err := source.Ack(ctx, messages[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.DeadLetter(ctx, messages[1], messages[1].Err); err != nil {
+		t.Fatal(err)
+	}
+	lag, err := source.Lag(ctx)
+	if err != nil || lag != (Lag{Pending: 1, Undelivered: 4}) {
+		t.Errorf("Lag() = %+v, %v", lag, err)
+	}
+
+	//an empty queue is long polled
+	messages, err = source.Fetch(ctx, 10)
+	if err != nil || len(messages) != 0 {
+		t.Errorf("Fetch() = %+v, %v, want no messages", messages, err)
+	}
+
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	wantAcks := map[string]string{
+		"$JS.ACK.views.youtube_service.2.1.1.1686000000000000000.1": "+ACK",
+		"$JS.ACK.views.youtube_service.1.2.2.1686000000000000000.0": "+TERM",
+	}
+	if !reflect.DeepEqual(js.acks, wantAcks) {
+		t.Errorf("acks = %v, want %v", js.acks, wantAcks)
+	}
+	if len(js.dead) != 1 || !strings.Contains(js.dead[0], "malformed event") {
+		t.Errorf("dead letters = %v, want the malformed message", js.dead)
+	}
+	if want := []string{`{"batch":10,"no_wait":true}`, `{"batch":10,"no_wait":true}`, `{"batch":10,"expires":1000000000}`}; !reflect.DeepEqual(js.pulled, want) {
+		t.Errorf("pull requests = %v, want %v", js.pulled, want)
+	}
+}
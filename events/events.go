@@ -0,0 +1,77 @@
+// Package events publishes the views and the new videos to a message broker, the events are
+// delivered at least once: a batch which failed to be sent is kept in an Outbox and sent again
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+	"youtube_service/logging"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var ErrUnknownBroker = errors.New("unknown event broker")
+
+// types of the events
+const (
+	TypeView        = "view"
+	TypeVideoPosted = "video_posted"
+)
+
+// Event is a view or a new video, the same event may be delivered more than once and out of order
+// when a batch was sent but could not be removed from the outbox or when a broker delivers it again,
+// the consumer of this service drops the duplicates by ID
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	VideoID   string    `json:"videoId"`
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId,omitempty"`
+}
+
+// NewEvent returns an event of typ for the video happening now, with a random ID and the request id of ctx
+func NewEvent(ctx context.Context, typ, videoID string) Event {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return Event{
+		ID:        hex.EncodeToString(id),
+		Type:      typ,
+		VideoID:   videoID,
+		Time:      time.Now().UTC(),
+		RequestID: logging.RequestIDFromContext(ctx),
+	}
+}
+
+// Sender sends batches of events to a broker, an error means some of them may not have been sent
+type Sender interface {
+	Send(ctx context.Context, events []Event) error
+}
+
+// brokers of the events
+const (
+	BrokerNone  = ""
+	BrokerRedis = "redis"
+	BrokerNATS  = "nats"
+	BrokerKafka = "kafka"
+)
+
+// NewSender returns the Sender of broker, topic is the redis stream, the NATS subject or the Kafka topic,
+// the stream length is used by redis only and addr is the NATS server host:port or the Kafka REST Proxy
+// URL, every send times out after timeout. There is no Sender for BrokerNone.
+func NewSender(broker string, client *redis.Client, topic string, maxLen int64, addr string, timeout time.Duration) (Sender, error) {
+	switch broker {
+	case BrokerNone:
+		return nil, nil
+	case BrokerRedis:
+		return NewRedisSender(client, topic, maxLen), nil
+	case BrokerNATS:
+		return NewNATSSender(addr, topic, timeout), nil
+	case BrokerKafka:
+		return NewKafkaSender(addr, topic, &http.Client{Timeout: timeout}), nil
+	}
+	return nil, ErrUnknownBroker
+}
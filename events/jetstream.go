@@ -0,0 +1,225 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jsResponse is the answer of the JetStream API
+type jsResponse struct {
+	Error *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+	NumPending    int64 `json:"num_pending"`
+	NumAckPending int64 `json:"num_ack_pending"`
+}
+
+type jsPullRequest struct {
+	Batch   int   `json:"batch"`
+	Expires int64 `json:"expires,omitempty"`
+	NoWait  bool  `json:"no_wait,omitempty"`
+}
+
+type deadLetter struct {
+	ID         string `json:"id"`
+	Event      string `json:"event"`
+	Error      string `json:"error"`
+	Deliveries int    `json:"deliveries"`
+}
+
+type jetStreamSource struct {
+	addr        string
+	stream      string
+	durable     string
+	deadLetters string
+	ackWait     time.Duration
+	timeout     time.Duration
+
+	mu   sync.Mutex
+	conn *natsConn
+}
+
+// NewJetStreamSource returns a Source pulling the messages of the JetStream stream of the NATS server at
+// addr with the durable consumer, which is created with explicit acks at the first fetch. Every message
+// is an event as JSON. The messages not acked within ackWait are delivered again and the dead letters
+// are published to the subject deadLetters.
+func NewJetStreamSource(addr, stream, durable, deadLetters string, ackWait, timeout time.Duration) Source {
+	return &jetStreamSource{
+		addr:        addr,
+		stream:      stream,
+		durable:     durable,
+		deadLetters: deadLetters,
+		ackWait:     ackWait,
+		timeout:     timeout,
+	}
+}
+
+// connection returns the open connection, the durable consumer is created or found with the same
+// config when it connects
+func (s *jetStreamSource) connection(ctx context.Context) (*natsConn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil && s.conn.Err() == nil {
+		return s.conn, nil
+	}
+	conn, err := dialNATS(ctx, s.addr, s.timeout)
+	if err != nil {
+		return nil, err
+	}
+	config, _ := json.Marshal(map[string]interface{}{
+		"stream_name": s.stream,
+		"config": map[string]interface{}{
+			"durable_name":   s.durable,
+			"deliver_policy": "all",
+			"ack_policy":     "explicit",
+			"ack_wait":       s.ackWait.Nanoseconds(),
+			"max_deliver":    -1,
+		},
+	})
+	if _, err := s.call(ctx, conn, "$JS.API.CONSUMER.DURABLE.CREATE."+s.stream+"."+s.durable, config); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	s.conn = conn
+	return conn, nil
+}
+
+func (s *jetStreamSource) call(ctx context.Context, conn *natsConn, subject string, data []byte) (jsResponse, error) {
+	var response jsResponse
+	reply, err := conn.call(ctx, subject, data, s.timeout)
+	if err != nil {
+		return response, err
+	}
+	if err := json.Unmarshal(reply.data, &response); err != nil {
+		return response, err
+	}
+	if response.Error != nil {
+		return response, fmt.Errorf("jetstream: %s (%d)", response.Error.Description, response.Error.Code)
+	}
+	return response, nil
+}
+
+// Fetch asks for the messages already there first, then waits for the next ones as long as fetchWait
+func (s *jetStreamSource) Fetch(ctx context.Context, n int) ([]Message, error) {
+	conn, err := s.connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := s.pull(ctx, conn, jsPullRequest{Batch: n, NoWait: true})
+	if err != nil || len(messages) > 0 {
+		return messages, err
+	}
+	return s.pull(ctx, conn, jsPullRequest{Batch: n, Expires: fetchWait.Nanoseconds()})
+}
+
+// pull sends a pull request and reads its messages until the batch is full or the server ends it with a status
+func (s *jetStreamSource) pull(ctx context.Context, conn *natsConn, request jsPullRequest) ([]Message, error) {
+	data, _ := json.Marshal(request)
+	replies, cancel := conn.request("$JS.API.CONSUMER.MSG.NEXT."+s.stream+"."+s.durable, data, request.Batch+1)
+	defer cancel()
+	if err := conn.flush(ctx, s.timeout); err != nil {
+		return nil, err
+	}
+	timer := time.NewTimer(time.Duration(request.Expires) + s.timeout)
+	defer timer.Stop()
+	var messages []Message
+	for len(messages) < request.Batch {
+		select {
+		case msg := <-replies:
+			switch msg.status {
+			case "":
+				messages = append(messages, jetStreamMessage(msg))
+			case "404", "408":
+				//no messages or the request expired
+				return messages, nil
+			default:
+				return messages, fmt.Errorf("jetstream: pull request ended with status %s", msg.status)
+			}
+		case <-timer.C:
+			return messages, nil
+		case <-conn.done:
+			return messages, conn.Err()
+		case <-ctx.Done():
+			return messages, ctx.Err()
+		}
+	}
+	return messages, nil
+}
+
+// jetStreamMessage decodes the event of a message, its reply subject is the ack subject
+// $JS.ACK.[domain.account.]stream.consumer.delivered.streamSeq.consumerSeq.time.pending[.token]
+// and the stream sequence stands for the id of the events without one
+func jetStreamMessage(m natsMsg) Message {
+	msg := Message{Deliveries: 1, id: m.reply, data: m.data}
+	tokens := strings.Split(m.reply, ".")
+	delivered, seq := 4, 5
+	if len(tokens) >= 11 {
+		delivered, seq = 6, 7
+	}
+	if len(tokens) > seq {
+		msg.Deliveries, _ = strconv.Atoi(tokens[delivered])
+		msg.Event.ID = tokens[seq]
+	}
+	var event Event
+	if err := json.Unmarshal(m.data, &event); err != nil {
+		msg.Err = fmt.Errorf("%w: %v", errMalformed, err)
+		return msg
+	}
+	if event.ID == "" {
+		event.ID = msg.Event.ID
+	}
+	if event.Type == "" {
+		event.Type = TypeView
+	}
+	msg.Event = event
+	if event.VideoID == "" {
+		msg.Err = fmt.Errorf("%w: no videoId", errMalformed)
+	}
+	return msg
+}
+
+func (s *jetStreamSource) Ack(ctx context.Context, msg Message) error {
+	return s.ack(ctx, msg, "+ACK")
+}
+
+// ack publishes the ack of msg and waits for the server to get it
+func (s *jetStreamSource) ack(ctx context.Context, msg Message, ack string) error {
+	conn, err := s.connection(ctx)
+	if err != nil {
+		return err
+	}
+	conn.publish(msg.id, "", []byte(ack))
+	return conn.flush(ctx, s.timeout)
+}
+
+// DeadLetter publishes msg to the dead letters then terminates it so it is not delivered again
+func (s *jetStreamSource) DeadLetter(ctx context.Context, msg Message, reason error) error {
+	conn, err := s.connection(ctx)
+	if err != nil {
+		return err
+	}
+	data, _ := json.Marshal(deadLetter{ID: msg.Event.ID, Event: string(msg.data), Error: reason.Error(), Deliveries: msg.Deliveries})
+	conn.publish(s.deadLetters, "", data)
+	if err := conn.flush(ctx, s.timeout); err != nil {
+		return err
+	}
+	return s.ack(ctx, msg, "+TERM")
+}
+
+func (s *jetStreamSource) Lag(ctx context.Context) (Lag, error) {
+	conn, err := s.connection(ctx)
+	if err != nil {
+		return Lag{}, err
+	}
+	info, err := s.call(ctx, conn, "$JS.API.CONSUMER.INFO."+s.stream+"."+s.durable, nil)
+	if err != nil {
+		return Lag{}, err
+	}
+	return Lag{Pending: info.NumAckPending, Undelivered: info.NumPending}, nil
+}
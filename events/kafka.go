@@ -0,0 +1,82 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type kafkaRecord struct {
+	Key   string `json:"key"`
+	Value Event  `json:"value"`
+}
+
+type kafkaRequest struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaResponse struct {
+	Offsets []struct {
+		Partition int     `json:"partition"`
+		ErrorCode *int    `json:"error_code"`
+		Error     *string `json:"error"`
+	} `json:"offsets"`
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+type kafkaSender struct {
+	url    string
+	client *http.Client
+}
+
+// NewKafkaSender returns a Sender producing the events to the Kafka topic through the Confluent REST Proxy
+// at proxyURL, the records are keyed by video so the events of a video stay in order in their partition
+func NewKafkaSender(proxyURL, topic string, client *http.Client) Sender {
+	return &kafkaSender{
+		url:    strings.TrimSuffix(proxyURL, "/") + "/topics/" + url.PathEscape(topic),
+		client: client,
+	}
+}
+
+func (s *kafkaSender) Send(ctx context.Context, events []Event) error {
+	body := kafkaRequest{Records: make([]kafkaRecord, len(events))}
+	for i, event := range events {
+		body.Records[i] = kafkaRecord{Key: event.VideoID, Value: event}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var answer kafkaResponse
+	json.NewDecoder(resp.Body).Decode(&answer)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kafka rest proxy: %s: %s", resp.Status, answer.Message)
+	}
+	//the records are produced one by one, some of them may have failed
+	for _, offset := range answer.Offsets {
+		if offset.ErrorCode != nil {
+			message := ""
+			if offset.Error != nil {
+				message = *offset.Error
+			}
+			return fmt.Errorf("kafka rest proxy: partition %d: error %d: %s", offset.Partition, *offset.ErrorCode, message)
+		}
+	}
+	return nil
+}
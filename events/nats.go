@@ -0,0 +1,334 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errNATSClosed = errors.New("nats: connection closed")
+
+// the CONNECT options of the NATS client protocol, verbose servers would answer every PUB with +OK and
+// the headers carry the status of the JetStream pull requests
+const natsConnect = `CONNECT {"verbose":false,"pedantic":false,"headers":true,"no_responders":true,"name":"youtube_service","lang":"go","protocol":1}` + "\r\n"
+
+// natsMsg is a MSG or an HMSG of the server, Status is the code of the headers of an HMSG, e.g. 404
+type natsMsg struct {
+	subject string
+	reply   string
+	status  string
+	data    []byte
+}
+
+// natsConn is a connection speaking the text protocol of NATS, the messages of the server are read
+// from the background and handed to the inbox of the request they answer
+type natsConn struct {
+	conn  net.Conn
+	inbox string
+
+	writeMu sync.Mutex
+	w       *bufio.Writer
+
+	mu       sync.Mutex
+	err      error
+	pongs    []chan error
+	requests map[string]chan natsMsg
+	next     int
+	done     chan struct{}
+}
+
+// dialNATS connects to the NATS server at addr and subscribes to the inbox of the requests
+func dialNATS(ctx context.Context, addr string, timeout time.Duration) (*natsConn, error) {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err == nil && !strings.HasPrefix(line, "INFO ") {
+		err = fmt.Errorf("nats: unexpected greeting %q", strings.TrimSpace(line))
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Time{})
+	id := make([]byte, 8)
+	rand.Read(id)
+	c := &natsConn{
+		conn:     conn,
+		inbox:    "_INBOX." + hex.EncodeToString(id),
+		w:        bufio.NewWriter(conn),
+		requests: map[string]chan natsMsg{},
+		done:     make(chan struct{}),
+	}
+	c.w.WriteString(natsConnect)
+	fmt.Fprintf(c.w, "SUB %s.* 1\r\n", c.inbox)
+	go c.read(r)
+	if err := c.flush(ctx, timeout); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// publish buffers a message to subject, it is written by the next flush
+func (c *natsConn) publish(subject, reply string, data []byte) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if reply != "" {
+		fmt.Fprintf(c.w, "PUB %s %s %d\r\n", subject, reply, len(data))
+	} else {
+		fmt.Fprintf(c.w, "PUB %s %d\r\n", subject, len(data))
+	}
+	c.w.Write(data)
+	c.w.WriteString("\r\n")
+}
+
+// flush writes the buffered messages and a PING then waits for the PONG, the server answers it once
+// it processed every message before it or with an -ERR
+func (c *natsConn) flush(ctx context.Context, timeout time.Duration) error {
+	pong := make(chan error, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.pongs = append(c.pongs, pong)
+	c.mu.Unlock()
+	if err := c.write("PING\r\n"); err != nil {
+		c.fail(err)
+		return err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-pong:
+		return err
+	case <-timer.C:
+		c.fail(errors.New("nats: timed out waiting for the server"))
+		return c.Err()
+	case <-ctx.Done():
+		c.fail(ctx.Err())
+		return ctx.Err()
+	}
+}
+
+// request publishes data to subject with a reply subject of the inbox and returns the channel of the
+// replies, up to size of them are kept until they are read
+func (c *natsConn) request(subject string, data []byte, size int) (replies <-chan natsMsg, cancel func()) {
+	ch := make(chan natsMsg, size)
+	c.mu.Lock()
+	c.next++
+	reply := c.inbox + "." + strconv.Itoa(c.next)
+	c.requests[reply] = ch
+	c.mu.Unlock()
+	c.publish(subject, reply, data)
+	return ch, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.requests, reply)
+	}
+}
+
+// call sends a request and waits for its single reply
+func (c *natsConn) call(ctx context.Context, subject string, data []byte, timeout time.Duration) (natsMsg, error) {
+	replies, cancel := c.request(subject, data, 1)
+	defer cancel()
+	if err := c.flush(ctx, timeout); err != nil {
+		return natsMsg{}, err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case msg := <-replies:
+		if msg.status == "503" {
+			return natsMsg{}, fmt.Errorf("nats: no responders for %s", subject)
+		}
+		return msg, nil
+	case <-c.done:
+		return natsMsg{}, c.Err()
+	case <-timer.C:
+		return natsMsg{}, fmt.Errorf("nats: timed out waiting for a reply of %s", subject)
+	case <-ctx.Done():
+		return natsMsg{}, ctx.Err()
+	}
+}
+
+func (c *natsConn) write(s string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.w.WriteString(s)
+	return c.w.Flush()
+}
+
+// Err returns why the connection is closed, nil while it is open
+func (c *natsConn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *natsConn) Close() error {
+	c.fail(errNATSClosed)
+	return nil
+}
+
+// fail closes the connection with err and fails the flushes waiting for their PONG
+func (c *natsConn) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	for _, pong := range c.pongs {
+		pong <- err
+	}
+	c.pongs = nil
+	close(c.done)
+	c.conn.Close()
+}
+
+// read handles the messages of the server until the connection is closed
+func (c *natsConn) read(r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		line = strings.TrimSpace(line)
+		op, args, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(op) {
+		case "PING":
+			if err := c.write("PONG\r\n"); err != nil {
+				c.fail(err)
+				return
+			}
+		case "PONG":
+			c.mu.Lock()
+			if len(c.pongs) > 0 {
+				c.pongs[0] <- nil
+				c.pongs = c.pongs[1:]
+			}
+			c.mu.Unlock()
+		case "-ERR":
+			//the server closes the connection after most errors, a denied publish fails the next flush
+			err := fmt.Errorf("nats: %s", strings.Trim(args, " '"))
+			c.mu.Lock()
+			for _, pong := range c.pongs {
+				pong <- err
+			}
+			c.pongs = nil
+			c.mu.Unlock()
+		case "MSG", "HMSG":
+			msg, err := readNATSMsg(r, strings.ToUpper(op) == "HMSG", strings.Fields(args))
+			if err != nil {
+				c.fail(err)
+				return
+			}
+			c.mu.Lock()
+			if ch, ok := c.requests[msg.subject]; ok {
+				select {
+				case ch <- msg:
+				default:
+					//the request stopped reading, the message is delivered again by the server
+				}
+			}
+			c.mu.Unlock()
+		}
+		//+OK and the INFO updates of the cluster are skipped
+	}
+}
+
+// readNATSMsg reads the payload of the MSG subject sid [reply] size or of the HMSG subject sid [reply]
+// headerSize size, the headers of an HMSG start with the NATS/1.0 status line
+func readNATSMsg(r *bufio.Reader, headers bool, args []string) (natsMsg, error) {
+	sizes := 1
+	if headers {
+		sizes = 2
+	}
+	if len(args) != 2+sizes && len(args) != 3+sizes {
+		return natsMsg{}, fmt.Errorf("nats: malformed message %q", strings.Join(args, " "))
+	}
+	msg := natsMsg{subject: args[0]}
+	if len(args) == 3+sizes {
+		msg.reply = args[2]
+	}
+	size, err := strconv.Atoi(args[len(args)-1])
+	if err != nil {
+		return natsMsg{}, err
+	}
+	headerSize := 0
+	if headers {
+		if headerSize, err = strconv.Atoi(args[len(args)-2]); err != nil || headerSize > size {
+			return natsMsg{}, fmt.Errorf("nats: malformed message %q", strings.Join(args, " "))
+		}
+	}
+	payload := make([]byte, size+2)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return natsMsg{}, err
+	}
+	if headers {
+		status := strings.SplitN(string(payload[:headerSize]), "\r\n", 2)[0]
+		if fields := strings.Fields(status); len(fields) > 1 {
+			msg.status = fields[1]
+		}
+	}
+	msg.data = payload[headerSize:size]
+	return msg, nil
+}
+
+type natsSender struct {
+	addr    string
+	subject string
+	timeout time.Duration
+
+	mu   sync.Mutex
+	conn *natsConn
+}
+
+// NewNATSSender returns a Sender publishing the events to the subject of the NATS server at addr, it
+// speaks the text protocol of NATS directly. A batch is sent once the server answered the PING following
+// it, the events are kept only if a JetStream stream is bound to the subject. The connection is opened
+// on the first send and again after a failure.
+func NewNATSSender(addr, subject string, timeout time.Duration) Sender {
+	return &natsSender{addr: addr, subject: subject, timeout: timeout}
+}
+
+func (s *natsSender) Send(ctx context.Context, events []Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil || s.conn.Err() != nil {
+		conn, err := dialNATS(ctx, s.addr, s.timeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		s.conn.publish(s.subject, "", data)
+	}
+	err := s.conn.flush(ctx, s.timeout)
+	if err != nil {
+		s.conn.Close()
+	}
+	return err
+}
@@ -0,0 +1,196 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var ErrOutboxFull = errors.New("event outbox is full")
+
+// Outbox keeps the events which failed to be sent until they are sent again
+type Outbox interface {
+	Put(ctx context.Context, events []Event) error
+	// Peek returns the oldest events, at most n of them, without removing them
+	Peek(ctx context.Context, n int) ([]Event, error)
+	// Remove drops the events once they are sent, the events not kept are skipped
+	Remove(ctx context.Context, events []Event) error
+}
+
+type redisOutbox struct {
+	client *redis.Client
+	key    string
+}
+
+// NewRedisOutbox returns an Outbox keeping the events in the redis list key, it can be shared by the
+// instances as every event is removed by value
+func NewRedisOutbox(client *redis.Client, key string) Outbox {
+	return &redisOutbox{client: client, key: key}
+}
+
+func (o *redisOutbox) Put(ctx context.Context, events []Event) error {
+	values := make([]interface{}, len(events))
+	for i, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		values[i] = data
+	}
+	return o.client.RPush(ctx, o.key, values...).Err()
+}
+
+func (o *redisOutbox) Peek(ctx context.Context, n int) ([]Event, error) {
+	values, err := o.client.LRange(ctx, o.key, 0, int64(n)-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, 0, len(values))
+	for _, value := range values {
+		var event Event
+		//an entry which is not an event would be peeked forever
+		if err := json.Unmarshal([]byte(value), &event); err != nil {
+			o.client.LRem(ctx, o.key, 1, value)
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (o *redisOutbox) Remove(ctx context.Context, events []Event) error {
+	pipe := o.client.Pipeline()
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		pipe.LRem(ctx, o.key, 1, data)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Lock is held by a single instance at a time, it keeps the instances from sending the events of a
+// shared Outbox together
+type Lock interface {
+	// Acquire takes the lock for ttl, it is false when another instance holds it
+	Acquire(ctx context.Context, ttl time.Duration) (bool, error)
+	// Release drops the lock if it is still held by this instance
+	Release(ctx context.Context) error
+}
+
+// the lock is only deleted when it still has the token of the instance, it may have expired and been taken
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+type redisLock struct {
+	client *redis.Client
+	key    string
+	token  string
+}
+
+// NewRedisLock returns a Lock of the redis key, it is set with SETNX to a token of this instance
+func NewRedisLock(client *redis.Client, key string) Lock {
+	token := make([]byte, 16)
+	rand.Read(token)
+	return &redisLock{client: client, key: key, token: hex.EncodeToString(token)}
+}
+
+func (l *redisLock) Acquire(ctx context.Context, ttl time.Duration) (bool, error) {
+	return l.client.SetNX(ctx, l.key, l.token, ttl).Result()
+}
+
+func (l *redisLock) Release(ctx context.Context) error {
+	return releaseScript.Run(ctx, l.client, []string{l.key}, l.token).Err()
+}
+
+type memoryOutbox struct {
+	maxLen int
+
+	mu     sync.Mutex
+	events []Event
+}
+
+// NewMemoryOutbox returns an Outbox keeping up to maxLen events in memory, they are lost when the
+// instance stops
+func NewMemoryOutbox(maxLen int) Outbox {
+	return &memoryOutbox{maxLen: maxLen}
+}
+
+func (o *memoryOutbox) Put(ctx context.Context, events []Event) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.events)+len(events) > o.maxLen {
+		return ErrOutboxFull
+	}
+	o.events = append(o.events, events...)
+	return nil
+}
+
+func (o *memoryOutbox) Peek(ctx context.Context, n int) ([]Event, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if n > len(o.events) {
+		n = len(o.events)
+	}
+	return append([]Event(nil), o.events[:n]...), nil
+}
+
+func (o *memoryOutbox) Remove(ctx context.Context, events []Event) error {
+	removed := make(map[string]bool, len(events))
+	for _, event := range events {
+		removed[event.ID] = true
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	kept := o.events[:0]
+	for _, event := range o.events {
+		if !removed[event.ID] {
+			kept = append(kept, event)
+		}
+	}
+	o.events = kept
+	return nil
+}
+
+type fallbackOutbox struct {
+	primary  Outbox
+	fallback Outbox
+}
+
+// NewFallbackOutbox returns an Outbox putting the events in primary and in fallback when primary fails,
+// the events of fallback are sent again first
+func NewFallbackOutbox(primary, fallback Outbox) Outbox {
+	return &fallbackOutbox{primary: primary, fallback: fallback}
+}
+
+func (o *fallbackOutbox) Put(ctx context.Context, events []Event) error {
+	if err := o.primary.Put(ctx, events); err != nil {
+		return o.fallback.Put(ctx, events)
+	}
+	return nil
+}
+
+func (o *fallbackOutbox) Peek(ctx context.Context, n int) ([]Event, error) {
+	events, err := o.fallback.Peek(ctx, n)
+	if err != nil || len(events) > 0 {
+		return events, err
+	}
+	return o.primary.Peek(ctx, n)
+}
+
+func (o *fallbackOutbox) Remove(ctx context.Context, events []Event) error {
+	o.fallback.Remove(ctx, events)
+	return o.primary.Remove(ctx, events)
+}
@@ -0,0 +1,174 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	log1 "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// PublisherOptions are the batching and the retries of a Publisher
+type PublisherOptions struct {
+	// BatchSize is the most events sent together
+	BatchSize int
+	// FlushInterval is how long an event waits for its batch to fill up
+	FlushInterval time.Duration
+	// BufferSize is the number of events waiting for a batch, the next ones go to the outbox
+	BufferSize int
+	// RetryInterval is how often the events of the outbox are sent again
+	RetryInterval time.Duration
+	// Timeout of every send and every outbox call
+	Timeout time.Duration
+}
+
+// Publisher sends the events in batches from the background, a batch which failed to be sent is put
+// in the outbox and sent again every RetryInterval so every event is sent at least once
+type Publisher struct {
+	sender Sender
+	outbox Outbox
+	lock   Lock
+	opts   PublisherOptions
+	logger log1.Logger
+	events chan Event
+}
+
+// NewPublisher returns a Publisher sending the events with sender, Run has to be running. The outbox
+// is sent again while holding lock, which can be nil when the outbox is not shared with other instances
+func NewPublisher(sender Sender, outbox Outbox, lock Lock, opts PublisherOptions, logger log1.Logger) *Publisher {
+	return &Publisher{
+		sender: sender,
+		outbox: outbox,
+		lock:   lock,
+		opts:   opts,
+		logger: logger,
+		events: make(chan Event, opts.BufferSize),
+	}
+}
+
+// Publish queues event for the next batch without waiting for it to be sent, the event is put in the
+// outbox when the queue is full
+func (p *Publisher) Publish(ctx context.Context, event Event) {
+	select {
+	case p.events <- event:
+	default:
+		ctx, cancel := context.WithTimeout(ctx, p.opts.Timeout)
+		defer cancel()
+		p.keep(ctx, []Event{event})
+	}
+}
+
+// Run sends the batches once they are full or after FlushInterval and the outbox every RetryInterval
+// until ctx is done, the events still queued are sent before it returns
+func (p *Publisher) Run(ctx context.Context) {
+	batch := make([]Event, 0, p.opts.BatchSize)
+	var flush *time.Timer
+	var flushes <-chan time.Time
+	send := func() {
+		if flush != nil {
+			flush.Stop()
+			flush, flushes = nil, nil
+		}
+		p.send(batch)
+		batch = batch[:0]
+	}
+	retry := time.NewTicker(p.opts.RetryInterval)
+	defer retry.Stop()
+	for {
+		select {
+		case event := <-p.events:
+			batch = append(batch, event)
+			if len(batch) == 1 {
+				flush = time.NewTimer(p.opts.FlushInterval)
+				flushes = flush.C
+			}
+			if len(batch) >= p.opts.BatchSize {
+				send()
+			}
+		case <-flushes:
+			send()
+		case <-retry.C:
+			p.retry()
+		case <-ctx.Done():
+			for {
+				select {
+				case event := <-p.events:
+					batch = append(batch, event)
+					if len(batch) >= p.opts.BatchSize {
+						send()
+					}
+				default:
+					if len(batch) > 0 {
+						send()
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// send sends batch or puts it in the outbox, the context of Run is not used so the last batches
+// are still sent while the instance stops
+func (p *Publisher) send(batch []Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.opts.Timeout)
+	defer cancel()
+	err := p.sender.Send(ctx, batch)
+	if err == nil {
+		return
+	}
+	level.Warn(p.logger).Log("msg", "Failed to send events, keeping them in the outbox", "events", len(batch), "err", err)
+	p.keep(ctx, batch)
+}
+
+// keep puts events in the outbox, they are lost if it fails too
+func (p *Publisher) keep(ctx context.Context, events []Event) {
+	if err := p.outbox.Put(ctx, events); err != nil {
+		level.Error(p.logger).Log("msg", "Failed to keep events in the outbox, they are lost", "events", len(events), "err", err)
+	}
+}
+
+// retry sends the outbox a batch at a time until it is empty or a send fails, only the instance holding
+// the lock sends it so an event is not sent by every instance which peeked it. When the lock cannot be
+// taken the shared outbox cannot be read either and only the events this instance kept in memory are sent.
+func (p *Publisher) retry() {
+	if p.lock != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), p.opts.Timeout)
+		acquired, err := p.lock.Acquire(ctx, p.opts.RetryInterval)
+		cancel()
+		if err == nil && !acquired {
+			return
+		}
+		if err == nil {
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), p.opts.Timeout)
+				defer cancel()
+				p.lock.Release(ctx)
+			}()
+		}
+	}
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), p.opts.Timeout)
+		sent, err := p.retryBatch(ctx)
+		cancel()
+		if err != nil {
+			level.Warn(p.logger).Log("msg", "Failed to send the events of the outbox", "err", err)
+			return
+		}
+		if sent < p.opts.BatchSize {
+			return
+		}
+	}
+}
+
+func (p *Publisher) retryBatch(ctx context.Context) (int, error) {
+	events, err := p.outbox.Peek(ctx, p.opts.BatchSize)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+	if err := p.sender.Send(ctx, events); err != nil {
+		return 0, err
+	}
+	//the events are sent again by the next retry if they are not removed
+	return len(events), p.outbox.Remove(ctx, events)
+}
@@ -0,0 +1,218 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+	"youtube_service/logging"
+
+	kitlog "github.com/go-kit/kit/log"
+)
+
+var errBroker = errors.New("broker is down")
+
+// fakeSender records the batches it sent, it fails while down
+type fakeSender struct {
+	mu      sync.Mutex
+	down    bool
+	batches [][]string
+	sent    chan struct{}
+}
+
+func newFakeSender() *fakeSender {
+	return &fakeSender{sent: make(chan struct{}, 100)}
+}
+
+func (s *fakeSender) Send(ctx context.Context, events []Event) error {
+	s.mu.Lock()
+	defer func() {
+		s.mu.Unlock()
+		s.sent <- struct{}{}
+	}()
+	if s.down {
+		return errBroker
+	}
+	var ids []string
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	s.batches = append(s.batches, ids)
+	return nil
+}
+
+func (s *fakeSender) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+func (s *fakeSender) sentBatches() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]string(nil), s.batches...)
+}
+
+// waitSent waits for n sends, failed or not
+func (s *fakeSender) waitSent(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-s.sent:
+		case <-time.After(time.Second):
+			t.Fatalf("%d sends out of %d", i, n)
+		}
+	}
+}
+
+func event(id string) Event {
+	return Event{ID: id, Type: TypeView, VideoID: "video1"}
+}
+
+func TestPublisher(t *testing.T) {
+	sender := newFakeSender()
+	outbox := NewMemoryOutbox(10)
+	p := NewPublisher(sender, outbox, nil, PublisherOptions{
+		BatchSize:     2,
+		FlushInterval: 20 * time.Millisecond,
+		BufferSize:    10,
+		RetryInterval: time.Hour,
+		Timeout:       time.Second,
+	}, kitlog.NewNopLogger())
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Run(ctx)
+		close(done)
+	}()
+
+	//a full batch is sent right away, the rest after the flush interval
+	for _, id := range []string{"1", "2", "3"} {
+		p.Publish(context.Background(), event(id))
+	}
+	sender.waitSent(t, 2)
+	if got, want := sender.sentBatches(), [][]string{{"1", "2"}, {"3"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("batches = %v, want %v", got, want)
+	}
+
+	//the failed batches are kept and sent again
+	sender.setDown(true)
+	p.Publish(context.Background(), event("4"))
+	sender.waitSent(t, 1)
+	//the batch is put in the outbox right after its send failed
+	var kept []Event
+	for deadline := time.Now().Add(time.Second); len(kept) == 0 && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		kept, _ = outbox.Peek(context.Background(), 10)
+	}
+	if len(kept) != 1 || kept[0].ID != "4" {
+		t.Errorf("outbox = %v, want event 4", kept)
+	}
+	sender.setDown(false)
+	p.retry()
+	sender.waitSent(t, 1)
+	if kept, _ = outbox.Peek(context.Background(), 10); len(kept) != 0 {
+		t.Errorf("outbox = %v after the retry, want it empty", kept)
+	}
+
+	//the queued events are sent when it stops
+	stop()
+	<-done
+	p.Publish(context.Background(), event("5"))
+	go p.Run(ctx)
+	sender.waitSent(t, 1)
+	if got, want := sender.sentBatches(), [][]string{{"1", "2"}, {"3"}, {"4"}, {"5"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("batches = %v, want %v", got, want)
+	}
+}
+
+func TestPublisher_queueFull(t *testing.T) {
+	outbox := NewMemoryOutbox(1)
+	p := NewPublisher(newFakeSender(), outbox, nil, PublisherOptions{BatchSize: 1, BufferSize: 1, Timeout: time.Second}, kitlog.NewNopLogger())
+	for _, id := range []string{"1", "2", "3"} {
+		p.Publish(context.Background(), event(id))
+	}
+	//the first is queued, the second kept in the outbox and the third lost
+	if kept, _ := outbox.Peek(context.Background(), 10); len(kept) != 1 || kept[0].ID != "2" {
+		t.Errorf("outbox = %v, want event 2", kept)
+	}
+}
+
+// fakeLock is held by another instance while taken, it fails while down
+type fakeLock struct {
+	taken, down bool
+	released    int
+}
+
+func (l *fakeLock) Acquire(ctx context.Context, ttl time.Duration) (bool, error) {
+	if l.down {
+		return false, errors.New("redis is down")
+	}
+	return !l.taken, nil
+}
+
+func (l *fakeLock) Release(ctx context.Context) error {
+	l.released++
+	return nil
+}
+
+func TestPublisher_lock(t *testing.T) {
+	tests := []struct {
+		name         string
+		lock         *fakeLock
+		wantSent     bool
+		wantReleased int
+	}{
+		{name: "held by another instance", lock: &fakeLock{taken: true}},
+		{name: "acquired", lock: &fakeLock{}, wantSent: true, wantReleased: 1},
+		{name: "redis is down", lock: &fakeLock{down: true}, wantSent: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender, outbox := newFakeSender(), NewMemoryOutbox(10)
+			outbox.Put(context.Background(), []Event{event("1")})
+			p := NewPublisher(sender, outbox, tt.lock, PublisherOptions{BatchSize: 10, RetryInterval: time.Minute, Timeout: time.Second}, kitlog.NewNopLogger())
+			p.retry()
+			if sent := len(sender.sentBatches()) == 1; sent != tt.wantSent {
+				t.Errorf("outbox sent = %v, want %v", sent, tt.wantSent)
+			}
+			if tt.lock.released != tt.wantReleased {
+				t.Errorf("lock released %d times, want %d", tt.lock.released, tt.wantReleased)
+			}
+		})
+	}
+}
+
+func TestFallbackOutbox(t *testing.T) {
+	primary, fallback := NewMemoryOutbox(1), NewMemoryOutbox(10)
+	outbox := NewFallbackOutbox(primary, fallback)
+	ctx := context.Background()
+	outbox.Put(ctx, []Event{event("1")})
+	outbox.Put(ctx, []Event{event("2"), event("3")})
+
+	//the events of the fallback come first
+	kept, err := outbox.Peek(ctx, 10)
+	if err != nil || len(kept) != 2 || kept[0].ID != "2" {
+		t.Fatalf("Peek() = %v, %v, want the events 2 and 3", kept, err)
+	}
+	outbox.Remove(ctx, kept)
+	kept, err = outbox.Peek(ctx, 10)
+	if err != nil || len(kept) != 1 || kept[0].ID != "1" {
+		t.Errorf("Peek() = %v, %v, want event 1", kept, err)
+	}
+}
+
+func TestNewEvent(t *testing.T) {
+	ctx := logging.ContextWithRequestID(context.Background(), "req1")
+	first, second := NewEvent(ctx, TypeView, "video1"), NewEvent(ctx, TypeView, "video1")
+	if first.ID == "" || first.ID == second.ID {
+		t.Errorf("ids = %q and %q, want two random ids", first.ID, second.ID)
+	}
+	if first.RequestID != "req1" || first.VideoID != "video1" || first.Time.IsZero() {
+		t.Errorf("NewEvent() = %+v", first)
+	}
+	if _, err := NewSender("rabbitmq", nil, "events", 0, "", time.Second); err != ErrUnknownBroker {
+		t.Errorf("NewSender(rabbitmq) error = %v, want ErrUnknownBroker", err)
+	}
+}
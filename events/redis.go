@@ -0,0 +1,218 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type redisSender struct {
+	client *redis.Client
+	stream string
+	maxLen int64
+}
+
+// NewRedisSender returns a Sender adding the events to the redis stream, trimmed to about maxLen entries,
+// every event is an entry with its JSON in the "event" field
+func NewRedisSender(client *redis.Client, stream string, maxLen int64) Sender {
+	return &redisSender{client: client, stream: stream, maxLen: maxLen}
+}
+
+func (s *redisSender) Send(ctx context.Context, events []Event) error {
+	pipe := s.client.Pipeline()
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: s.stream,
+			MaxLen: s.maxLen,
+			Approx: true,
+			Values: []interface{}{"event", data},
+		})
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// the longest a fetch blocks waiting for new entries
+const fetchWait = time.Second
+
+type redisSource struct {
+	client      *redis.Client
+	stream      string
+	group       string
+	consumer    string
+	deadLetters string
+	claimIdle   time.Duration
+
+	// the fields below are only used by Fetch, which is called by one goroutine
+	created   bool
+	lastClaim time.Time
+}
+
+// NewRedisSource returns a Source reading the redis stream as consumer of the consumer group, the group is
+// created at the first fetch and starts from the beginning of the stream. Every entry has an event as JSON
+// in its "event" field or only a "videoId" field for a view. The entries delivered to a consumer which did
+// not ack them within claimIdle are claimed again, which needs redis 6.2, and the dead letters go to the
+// stream deadLetters.
+func NewRedisSource(client *redis.Client, stream, group, consumer, deadLetters string, claimIdle time.Duration) Source {
+	return &redisSource{
+		client:      client,
+		stream:      stream,
+		group:       group,
+		consumer:    consumer,
+		deadLetters: deadLetters,
+		claimIdle:   claimIdle,
+	}
+}
+
+func (s *redisSource) Fetch(ctx context.Context, n int) ([]Message, error) {
+	if !s.created {
+		err := s.client.XGroupCreateMkStream(ctx, s.stream, s.group, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return nil, err
+		}
+		s.created = true
+	}
+	messages, err := s.claim(ctx, n)
+	if err != nil || len(messages) > 0 {
+		return messages, err
+	}
+	streams, err := s.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    s.group,
+		Consumer: s.consumer,
+		Streams:  []string{s.stream, ">"},
+		Count:    int64(n),
+		Block:    fetchWait,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, stream := range streams {
+		for _, entry := range stream.Messages {
+			messages = append(messages, redisMessage(entry, 1))
+		}
+	}
+	return messages, nil
+}
+
+// claim takes over the entries pending for longer than claimIdle, the pending entries are looked
+// up a few times per claimIdle unless the last claim was full
+func (s *redisSource) claim(ctx context.Context, n int) ([]Message, error) {
+	if time.Since(s.lastClaim) < s.claimIdle/4 {
+		return nil, nil
+	}
+	pending, err := s.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: s.stream,
+		Group:  s.group,
+		Idle:   s.claimIdle,
+		Start:  "-",
+		End:    "+",
+		Count:  int64(n),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) < n {
+		s.lastClaim = time.Now()
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+	ids := make([]string, len(pending))
+	deliveries := make(map[string]int, len(pending))
+	for i, entry := range pending {
+		ids[i] = entry.ID
+		deliveries[entry.ID] = int(entry.RetryCount) + 1
+	}
+	//the entries claimed by another consumer in between are not returned
+	claimed, err := s.client.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   s.stream,
+		Group:    s.group,
+		Consumer: s.consumer,
+		MinIdle:  s.claimIdle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]Message, len(claimed))
+	for i, entry := range claimed {
+		messages[i] = redisMessage(entry, deliveries[entry.ID])
+	}
+	return messages, nil
+}
+
+// redisMessage decodes the event of a stream entry, the entry id stands for the id of the events without one
+func redisMessage(entry redis.XMessage, deliveries int) Message {
+	msg := Message{Deliveries: deliveries, id: entry.ID}
+	if data, ok := entry.Values["event"].(string); ok {
+		msg.data = []byte(data)
+		if err := json.Unmarshal(msg.data, &msg.Event); err != nil {
+			msg.Err = fmt.Errorf("%w: %v", errMalformed, err)
+		}
+	} else {
+		msg.data, _ = json.Marshal(entry.Values)
+		msg.Event.VideoID, _ = entry.Values["videoId"].(string)
+	}
+	if msg.Event.ID == "" {
+		msg.Event.ID = entry.ID
+	}
+	if msg.Event.Type == "" {
+		msg.Event.Type = TypeView
+	}
+	if msg.Err == nil && msg.Event.VideoID == "" {
+		msg.Err = fmt.Errorf("%w: no videoId", errMalformed)
+	}
+	return msg
+}
+
+func (s *redisSource) Ack(ctx context.Context, msg Message) error {
+	return s.client.XAck(ctx, s.stream, s.group, msg.id).Err()
+}
+
+func (s *redisSource) DeadLetter(ctx context.Context, msg Message, reason error) error {
+	pipe := s.client.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.deadLetters,
+		Values: []interface{}{"id", msg.id, "event", msg.data, "error", reason.Error(), "deliveries", msg.Deliveries},
+	})
+	pipe.XAck(ctx, s.stream, s.group, msg.id)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Lag reads the pending entries and, since redis 7, the lag of the group
+func (s *redisSource) Lag(ctx context.Context) (Lag, error) {
+	groups, err := s.client.Do(ctx, "xinfo", "groups", s.stream).Slice()
+	if err != nil {
+		return Lag{}, err
+	}
+	for _, group := range groups {
+		fields, _ := group.([]interface{})
+		info := map[string]interface{}{}
+		for i := 0; i+1 < len(fields); i += 2 {
+			key, _ := fields[i].(string)
+			info[key] = fields[i+1]
+		}
+		if info["name"] != s.group {
+			continue
+		}
+		lag := Lag{Undelivered: -1}
+		lag.Pending, _ = info["pending"].(int64)
+		if undelivered, ok := info["lag"].(int64); ok {
+			lag.Undelivered = undelivered
+		}
+		return lag, nil
+	}
+	return Lag{Undelivered: -1}, nil
+}
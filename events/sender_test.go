@@ -0,0 +1,197 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// natsServer is enough of a NATS server for the sender, it answers -ERR to the subject "forbidden"
+// and drops the connection after its first message when drop is set. The messages taken by the
+// handler are not recorded.
+type natsServer struct {
+	listener net.Listener
+	handler  func(w natsWriter, subject, reply string, payload []byte) bool
+
+	mu          sync.Mutex
+	drop        bool
+	connections int
+	messages    []string
+}
+
+func newNATSServer(t *testing.T) *natsServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &natsServer{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+// natsWriter writes the messages of the server to a subscription of the client
+type natsWriter struct {
+	mu   *sync.Mutex
+	conn net.Conn
+}
+
+func (w natsWriter) msg(subject, reply, data string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if reply != "" {
+		fmt.Fprintf(w.conn, "MSG %s 1 %s %d\r\n%s\r\n", subject, reply, len(data), data)
+		return
+	}
+	fmt.Fprintf(w.conn, "MSG %s 1 %d\r\n%s\r\n", subject, len(data), data)
+}
+
+func (w natsWriter) status(subject, status string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	headers := "NATS/1.0 " + status + "\r\n\r\n"
+	fmt.Fprintf(w.conn, "HMSG %s 1 %d %d\r\n%s\r\n", subject, len(headers), len(headers), headers)
+}
+
+func (s *natsServer) serve(conn net.Conn) {
+	defer conn.Close()
+	s.mu.Lock()
+	s.connections++
+	s.mu.Unlock()
+	w := natsWriter{mu: &sync.Mutex{}, conn: conn}
+	fmt.Fprint(conn, "INFO {\"server_id\":\"test\",\"max_payload\":1048576}\r\n")
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "PING":
+			//a server PING in between is answered by the client
+			w.mu.Lock()
+			fmt.Fprint(conn, "PING\r\n")
+			fmt.Fprint(conn, "PONG\r\n")
+			w.mu.Unlock()
+		case "PUB":
+			var size int
+			fmt.Sscan(fields[len(fields)-1], &size)
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			reply := ""
+			if len(fields) == 4 {
+				reply = fields[2]
+			}
+			if s.handler != nil && s.handler(w, fields[1], reply, payload[:size]) {
+				continue
+			}
+			if fields[1] == "forbidden" {
+				fmt.Fprint(conn, "-ERR 'Permissions Violation for Publish to forbidden'\r\n")
+				continue
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, fields[1]+" "+string(payload[:size]))
+			drop := s.drop
+			s.drop = false
+			s.mu.Unlock()
+			if drop {
+				return
+			}
+		}
+	}
+}
+
+func TestNATSSender(t *testing.T) {
+	server := newNATSServer(t)
+	sender := NewNATSSender(server.listener.Addr().String(), "videos.events", time.Second)
+	ctx := context.Background()
+	if err := sender.Send(ctx, []Event{event("1"), event("2")}); err != nil {
+		t.Fatal(err)
+	}
+	server.mu.Lock()
+	server.drop = true
+	server.mu.Unlock()
+	if err := sender.Send(ctx, []Event{event("3")}); err == nil {
+		t.Error("Send() on a dropped connection error = nil")
+	}
+	//the next send connects again
+	if err := sender.Send(ctx, []Event{event("4")}); err != nil {
+		t.Fatal(err)
+	}
+
+	server.mu.Lock()
+	connections, messages := server.connections, server.messages
+	server.mu.Unlock()
+	if connections != 2 {
+		t.Errorf("connections = %d, want 2", connections)
+	}
+	var ids []string
+	for _, message := range messages {
+		subject, data, _ := strings.Cut(message, " ")
+		var e Event
+		if err := json.Unmarshal([]byte(data), &e); err != nil || subject != "videos.events" {
+			t.Fatalf("message %q, %v", message, err)
+		}
+		ids = append(ids, e.ID)
+	}
+	if got := strings.Join(ids, ","); got != "1,2,3,4" {
+		t.Errorf("published = %s, want 1,2,3,4", got)
+	}
+
+	forbidden := NewNATSSender(server.listener.Addr().String(), "forbidden", time.Second)
+	if err := forbidden.Send(ctx, []Event{event("5")}); err == nil || !strings.Contains(err.Error(), "Permissions Violation") {
+		t.Errorf("Send() error = %v, want the -ERR of the server", err)
+	}
+}
+
+func TestKafkaSender(t *testing.T) {
+	var request kafkaRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/topics/videos.events" || r.Header.Get("Content-Type") != "application/vnd.kafka.json.v2+json" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error_code":40401,"message":"Topic not found."}`)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		if request.Records[0].Value.ID == "fail" {
+			fmt.Fprint(w, `{"offsets":[{"partition":null,"offset":null,"error_code":50003,"error":"Timed out"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"offsets":[{"partition":0,"offset":7,"error_code":null,"error":null}]}`)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	if err := NewKafkaSender(server.URL+"/", "videos.events", server.Client()).Send(ctx, []Event{event("1")}); err != nil {
+		t.Fatal(err)
+	}
+	if len(request.Records) != 1 || request.Records[0].Key != "video1" || request.Records[0].Value.ID != "1" {
+		t.Errorf("records = %+v, want event 1 keyed by its video", request.Records)
+	}
+	if err := NewKafkaSender(server.URL, "videos.events", server.Client()).Send(ctx, []Event{event("fail")}); err == nil || !strings.Contains(err.Error(), "Timed out") {
+		t.Errorf("Send() error = %v, want the error of the record", err)
+	}
+	if err := NewKafkaSender(server.URL, "unknown", server.Client()).Send(ctx, []Event{event("1")}); err == nil || !strings.Contains(err.Error(), "Topic not found") {
+		t.Errorf("Send() error = %v, want the error of the proxy", err)
+	}
+}
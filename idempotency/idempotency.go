@@ -0,0 +1,216 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"time"
+	"youtube_service/apierror"
+	"youtube_service/auth"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// headers of the keyed requests and of the replayed responses
+const (
+	Header         = "Idempotency-Key"
+	ReplayedHeader = "Idempotent-Replayed"
+)
+
+// MaxKeyLength is the longest key accepted
+const MaxKeyLength = 255
+
+// errors of the keyed requests which can't run
+var (
+	ErrKeyTooLong = errors.New("Idempotency-Key is longer than 255 characters")
+	ErrInProgress = errors.New("a request with this Idempotency-Key is in progress")
+	ErrKeyReused  = errors.New("Idempotency-Key was used for another request")
+)
+
+// a request holds its key for at most lockTTL, after that a retry runs it again
+const lockTTL = 5 * time.Minute
+
+// Response is what a keyed request answered, Fingerprint is the hash of its query and body
+type Response struct {
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+	Fingerprint string      `json:"fingerprint"`
+}
+
+// HTTPMiddleware runs the requests with an Idempotency-Key once and replays their response to the retries
+// for ttl. The keys are scoped to the credentials, the method and the path of the request, a key reused
+// for another query or body gets a 422 and a retry while the first request runs a 409. The 5xx and 429
+// responses are not kept so they can be retried, without the store the requests just run.
+func HTTPMiddleware(store Store, ttl time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		key := r.Header.Get(Header)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > MaxKeyLength {
+			apierror.Write(ctx, w, http.StatusBadRequest, ErrKeyTooLong)
+			return
+		}
+		storeKey := scopedKey(r, key)
+		reserved, stored, err := store.Reserve(ctx, storeKey, lockTTL)
+		switch {
+		case err != nil:
+			next.ServeHTTP(w, r)
+			return
+		case !reserved && stored == nil:
+			w.Header().Set("Retry-After", "1")
+			apierror.Write(ctx, w, http.StatusConflict, ErrInProgress)
+			return
+		case !reserved:
+			if fingerprint(r, r.Body) != stored.Fingerprint {
+				apierror.Write(ctx, w, http.StatusUnprocessableEntity, ErrKeyReused)
+				return
+			}
+			stored.writeTo(w, true)
+			return
+		}
+
+		//the body is hashed as the handler reads it, the response is held until the rest of the body is
+		//hashed too since flushing it could close the body
+		body := &hashingReader{ReadCloser: r.Body, hash: newFingerprintHash(r)}
+		r.Body = body
+		recorder := &responseRecorder{response: Response{Status: http.StatusOK, Header: http.Header{}}}
+		next.ServeHTTP(recorder, r)
+		io.Copy(io.Discard, body)
+		response := recorder.response
+		response.Fingerprint = hex.EncodeToString(body.hash.Sum(nil))
+
+		if retryable(response.Status) {
+			store.Release(ctx, storeKey)
+		} else if err := store.Save(ctx, storeKey, response, ttl); err != nil {
+			store.Release(ctx, storeKey)
+		}
+		response.writeTo(w, false)
+	})
+}
+
+// retryable tells if a response is not kept so its request can run again, the auth failures are
+// retried once the credentials are fixed
+func retryable(status int) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return true
+	}
+	return status >= http.StatusInternalServerError
+}
+
+// scopedKey keeps callers with other credentials and other routes from replaying each other's responses
+func scopedKey(r *http.Request, key string) string {
+	h := sha256.New()
+	for _, part := range []string{r.Header.Get("Authorization"), r.Header.Get(auth.APIKeyHeader), r.Method, r.URL.Path, key} {
+		io.WriteString(h, part)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func newFingerprintHash(r *http.Request) hash.Hash {
+	h := sha256.New()
+	io.WriteString(h, r.URL.RawQuery)
+	h.Write([]byte{0})
+	return h
+}
+
+func fingerprint(r *http.Request, body io.Reader) string {
+	h := newFingerprintHash(r)
+	if body != nil {
+		io.Copy(h, body)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type hashingReader struct {
+	io.ReadCloser
+	hash hash.Hash
+}
+
+func (r *hashingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.hash.Write(p[:n])
+	return n, err
+}
+
+// responseRecorder fills a Response, the headers set before the handler ran are left out of it
+type responseRecorder struct {
+	response Response
+}
+
+func (w *responseRecorder) Header() http.Header { return w.response.Header }
+
+func (w *responseRecorder) WriteHeader(status int) { w.response.Status = status }
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	w.response.Body = append(w.response.Body, p...)
+	return len(p), nil
+}
+
+func (resp *Response) writeTo(w http.ResponseWriter, replayed bool) {
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	if replayed {
+		w.Header().Set(ReplayedHeader, "true")
+	}
+	w.WriteHeader(resp.Status)
+	io.Copy(w, bytes.NewReader(resp.Body))
+}
+
+type contextKey int
+
+const keyContextKey contextKey = iota
+
+// ContextWithKey sets the Idempotency-Key sent by the client endpoints
+func ContextWithKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, keyContextKey, key)
+}
+
+// KeyFromContext returns the Idempotency-Key of ctx, empty when there is none
+func KeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(keyContextKey).(string)
+	return key
+}
+
+// NewKey returns a random 128 bit key in hex
+func NewKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// EndpointMiddleware gives the calls without an Idempotency-Key a new one, placed before a retry
+// every attempt of a call sends the same key
+func EndpointMiddleware() endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if KeyFromContext(ctx) == "" {
+				ctx = ContextWithKey(ctx, NewKey())
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// ContextToHTTP sets the Idempotency-Key of the context on an outgoing request
+func ContextToHTTP() kithttp.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if key := KeyFromContext(ctx); key != "" {
+			r.Header.Set(Header, key)
+		}
+		return ctx
+	}
+}
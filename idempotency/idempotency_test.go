@@ -0,0 +1,146 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPMiddleware(t *testing.T) {
+	runs := 0
+	status := http.StatusOK
+	handler := HTTPMiddleware(NewMemoryStore(), time.Hour, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		runs++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+	tests := []struct {
+		name         string
+		key          string
+		apiKey       string
+		body         string
+		status       int
+		wantStatus   int
+		wantRuns     int
+		wantReplayed bool
+	}{
+		{name: "without a key", body: "a", wantStatus: http.StatusOK, wantRuns: 1},
+		{name: "without a key again", body: "a", wantStatus: http.StatusOK, wantRuns: 2},
+		{name: "first keyed request", key: "k1", body: "a", wantStatus: http.StatusOK, wantRuns: 3},
+		{name: "retry is replayed", key: "k1", body: "a", wantStatus: http.StatusOK, wantRuns: 3, wantReplayed: true},
+		{name: "key reused for another body", key: "k1", body: "b", wantStatus: http.StatusUnprocessableEntity, wantRuns: 3},
+		{name: "other credentials", key: "k1", apiKey: "other", body: "a", wantStatus: http.StatusOK, wantRuns: 4},
+		{name: "client errors are kept", key: "k2", body: "a", status: http.StatusBadRequest, wantStatus: http.StatusBadRequest, wantRuns: 5},
+		{name: "client error replayed", key: "k2", body: "a", wantStatus: http.StatusBadRequest, wantRuns: 5, wantReplayed: true},
+		{name: "server errors are not kept", key: "k3", body: "a", status: http.StatusServiceUnavailable, wantStatus: http.StatusServiceUnavailable, wantRuns: 6},
+		{name: "server error retried", key: "k3", body: "a", wantStatus: http.StatusOK, wantRuns: 7},
+		{name: "auth failures are not kept", key: "k4", body: "a", status: http.StatusForbidden, wantStatus: http.StatusForbidden, wantRuns: 8},
+		{name: "auth failure retried", key: "k4", body: "a", wantStatus: http.StatusOK, wantRuns: 9},
+		{name: "key too long", key: strings.Repeat("k", MaxKeyLength+1), wantStatus: http.StatusBadRequest, wantRuns: 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status = tt.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			r := httptest.NewRequest(http.MethodPost, "/postVideo", strings.NewReader(tt.body))
+			if tt.key != "" {
+				r.Header.Set(Header, tt.key)
+			}
+			if tt.apiKey != "" {
+				r.Header.Set("X-API-Key", tt.apiKey)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus || runs != tt.wantRuns {
+				t.Fatalf("status %d after %d runs, want %d after %d", w.Code, runs, tt.wantStatus, tt.wantRuns)
+			}
+			if replayed := w.Header().Get(ReplayedHeader) == "true"; replayed != tt.wantReplayed {
+				t.Errorf("replayed = %v, want %v", replayed, tt.wantReplayed)
+			}
+			if tt.wantStatus < 300 && (w.Body.String() != tt.body || w.Header().Get("Content-Type") != "text/plain") {
+				t.Errorf("response %q %q, want %q", w.Header().Get("Content-Type"), w.Body.String(), tt.body)
+			}
+		})
+	}
+}
+
+func TestHTTPMiddleware_inProgress(t *testing.T) {
+	store := NewMemoryStore()
+	started, done := make(chan struct{}), make(chan struct{})
+	handler := HTTPMiddleware(store, time.Hour, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-done
+	}))
+	request := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/viewVideo?videoName=a", nil)
+		r.Header.Set(Header, "k")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- request() }()
+	<-started
+	if w := request(); w.Code != http.StatusConflict || w.Header().Get("Retry-After") == "" {
+		t.Errorf("concurrent retry got %d, want %d with a Retry-After", w.Code, http.StatusConflict)
+	}
+	close(done)
+	if w := <-first; w.Code != http.StatusOK {
+		t.Errorf("first request got %d", w.Code)
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Reserve(context.Context, string, time.Duration) (bool, *Response, error) {
+	return false, nil, errors.New("down")
+}
+func (failingStore) Save(context.Context, string, Response, time.Duration) error {
+	return errors.New("down")
+}
+func (failingStore) Release(context.Context, string) error { return errors.New("down") }
+
+func TestFallbackStore(t *testing.T) {
+	store := NewFallbackStore(failingStore{}, NewMemoryStore())
+	ctx := context.Background()
+	if reserved, _, err := store.Reserve(ctx, "k", time.Minute); err != nil || !reserved {
+		t.Fatalf("Reserve() = %v, %v", reserved, err)
+	}
+	if err := store.Save(ctx, "k", Response{Status: http.StatusOK}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	reserved, response, err := store.Reserve(ctx, "k", time.Minute)
+	if err != nil || reserved || response == nil || response.Status != http.StatusOK {
+		t.Errorf("Reserve() = %v, %+v, %v, want the saved response", reserved, response, err)
+	}
+}
+
+func TestEndpointMiddleware(t *testing.T) {
+	var keys []string
+	attempt := func(ctx context.Context, request interface{}) (interface{}, error) {
+		r := httptest.NewRequest(http.MethodPost, "/postVideo", nil)
+		ContextToHTTP()(ctx, r)
+		keys = append(keys, r.Header.Get(Header))
+		return nil, nil
+	}
+	//a retry calls the endpoint it wraps with the same context
+	retry := func(ctx context.Context, request interface{}) (interface{}, error) {
+		attempt(ctx, request)
+		return attempt(ctx, request)
+	}
+	e := EndpointMiddleware()(retry)
+	e(context.Background(), nil)
+	e(ContextWithKey(context.Background(), "mine"), nil)
+	if len(keys) != 4 || keys[0] == "" || keys[0] != keys[1] || keys[2] != "mine" || keys[3] != "mine" {
+		t.Errorf("keys = %q, want one new key per call and the key of the context", keys)
+	}
+}
@@ -0,0 +1,151 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Store keeps the responses of the keyed requests
+type Store interface {
+	// Reserve takes key for the request about to run, when it is already taken reserved is false and
+	// response is the one stored for it or nil while the first request is still running
+	Reserve(ctx context.Context, key string, ttl time.Duration) (reserved bool, response *Response, err error)
+	// Save stores the response of a reserved key for ttl
+	Save(ctx context.Context, key string, response Response, ttl time.Duration) error
+	// Release frees a reserved key so the request can run again
+	Release(ctx context.Context, key string) error
+}
+
+// a reserved key holds an empty value until its response is saved
+const pending = ""
+
+type redisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore returns a Store keeping the responses in redis so every instance replays them
+func NewRedisStore(client *redis.Client, prefix string) Store {
+	return &redisStore{client: client, prefix: prefix}
+}
+
+func (s *redisStore) Reserve(ctx context.Context, key string, ttl time.Duration) (bool, *Response, error) {
+	reserved, err := s.client.SetNX(ctx, s.prefix+key, pending, ttl).Result()
+	if err != nil || reserved {
+		return reserved, nil, err
+	}
+	value, err := s.client.Get(ctx, s.prefix+key).Result()
+	switch {
+	case err == redis.Nil, err == nil && value == pending:
+		//expired in between or still running, either way the caller should try again
+		return false, nil, nil
+	case err != nil:
+		return false, nil, err
+	}
+	var response Response
+	if err := json.Unmarshal([]byte(value), &response); err != nil {
+		return false, nil, err
+	}
+	return false, &response, nil
+}
+
+func (s *redisStore) Save(ctx context.Context, key string, response Response, ttl time.Duration) error {
+	value, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.prefix+key, value, ttl).Err()
+}
+
+func (s *redisStore) Release(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.prefix+key).Err()
+}
+
+// entries are swept once there are more than this many of them
+const maxMemoryEntries = 10000
+
+type entry struct {
+	response *Response
+	expires  time.Time
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	entries map[string]entry
+	now     func() time.Time
+}
+
+// NewMemoryStore returns a Store keeping the responses of this instance in memory
+func NewMemoryStore() Store {
+	return &memoryStore{entries: map[string]entry{}, now: time.Now}
+}
+
+func (s *memoryStore) Reserve(ctx context.Context, key string, ttl time.Duration) (bool, *Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if len(s.entries) > maxMemoryEntries {
+		s.sweep(now)
+	}
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		return false, e.response, nil
+	}
+	s.entries[key] = entry{expires: now.Add(ttl)}
+	return true, nil, nil
+}
+
+func (s *memoryStore) Save(ctx context.Context, key string, response Response, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = entry{response: &response, expires: s.now().Add(ttl)}
+	return nil
+}
+
+func (s *memoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *memoryStore) sweep(now time.Time) {
+	for key, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+type fallbackStore struct {
+	primary  Store
+	fallback Store
+}
+
+// NewFallbackStore returns a Store using primary and falling back to fallback when primary fails
+func NewFallbackStore(primary, fallback Store) Store {
+	return &fallbackStore{primary: primary, fallback: fallback}
+}
+
+func (s *fallbackStore) Reserve(ctx context.Context, key string, ttl time.Duration) (bool, *Response, error) {
+	reserved, response, err := s.primary.Reserve(ctx, key, ttl)
+	if err != nil {
+		return s.fallback.Reserve(ctx, key, ttl)
+	}
+	return reserved, response, nil
+}
+
+func (s *fallbackStore) Save(ctx context.Context, key string, response Response, ttl time.Duration) error {
+	if err := s.primary.Save(ctx, key, response, ttl); err != nil {
+		return s.fallback.Save(ctx, key, response, ttl)
+	}
+	return nil
+}
+
+func (s *fallbackStore) Release(ctx context.Context, key string) error {
+	s.fallback.Release(ctx, key)
+	return s.primary.Release(ctx, key)
+}
@@ -0,0 +1,152 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	log1 "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	FormatLogfmt = "logfmt"
+	FormatJSON   = "json"
+
+	// RequestIDHeader is read from incoming requests, set on their responses and sent by the clients
+	RequestIDHeader = "X-Request-ID"
+
+	// longest request id accepted from a caller, longer ones are replaced
+	maxRequestIDLength = 128
+)
+
+var ErrUnknownFormat = errors.New("unknown log format")
+var ErrUnknownLevel = errors.New("unknown log level")
+
+type contextKey int
+
+const requestIDKey contextKey = iota
+
+// NewLogger returns a logfmt or json logger writing to w which drops the events below lvl,
+// every event gets a ts
+func NewLogger(w io.Writer, format, lvl string) (log1.Logger, error) {
+	var logger log1.Logger
+	switch format {
+	case FormatLogfmt, "":
+		logger = log1.NewLogfmtLogger(log1.NewSyncWriter(w))
+	case FormatJSON:
+		logger = log1.NewJSONLogger(log1.NewSyncWriter(w))
+	default:
+		return nil, ErrUnknownFormat
+	}
+
+	var allow level.Option
+	switch lvl {
+	case "debug":
+		allow = level.AllowDebug()
+	case "info", "":
+		allow = level.AllowInfo()
+	case "warn":
+		allow = level.AllowWarn()
+	case "error":
+		allow = level.AllowError()
+	default:
+		return nil, ErrUnknownLevel
+	}
+	logger = level.NewFilter(logger, allow)
+	return log1.With(logger, "ts", log1.DefaultTimestampUTC), nil
+}
+
+// WithContext returns logger with the request id and the trace id of ctx, when they are set
+func WithContext(ctx context.Context, logger log1.Logger) log1.Logger {
+	if id := RequestIDFromContext(ctx); id != "" {
+		logger = log1.With(logger, "request_id", id)
+	}
+	if span := trace.SpanContextFromContext(ctx); span.HasTraceID() {
+		logger = log1.With(logger, "trace_id", span.TraceID().String())
+	}
+	return logger
+}
+
+// ForResult returns the error level logger when err is set and the info level one otherwise
+func ForResult(logger log1.Logger, err error) log1.Logger {
+	if err != nil {
+		return level.Error(logger)
+	}
+	return level.Info(logger)
+}
+
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// RequestIDMiddleware keeps the X-Request-ID of the caller or generates a new one, puts it in the
+// context of the request and sends it back in the response
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(ContextWithRequestID(r.Context(), id)))
+	})
+}
+
+// InjectRequestID sets the request id of ctx on an outgoing request
+func InjectRequestID(ctx context.Context, r *http.Request) context.Context {
+	if id := RequestIDFromContext(ctx); id != "" {
+		r.Header.Set(RequestIDHeader, id)
+	}
+	return ctx
+}
+
+// GRPCToRequestID keeps the request id of the metadata of a gRPC request or generates a new one
+func GRPCToRequestID(ctx context.Context, md metadata.MD) context.Context {
+	id := ""
+	if ids := md.Get(RequestIDHeader); len(ids) > 0 {
+		id = ids[0]
+	}
+	if !validRequestID(id) {
+		id = NewRequestID()
+	}
+	return ContextWithRequestID(ctx, id)
+}
+
+// InjectGRPCRequestID sets the request id of ctx in the metadata of an outgoing gRPC request
+func InjectGRPCRequestID(ctx context.Context, md *metadata.MD) context.Context {
+	if id := RequestIDFromContext(ctx); id != "" {
+		md.Set(RequestIDHeader, id)
+	}
+	return ctx
+}
+
+// NewRequestID returns a random 128 bit id in hex
+func NewRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// only short printable ascii ids are taken from callers so they can't break the log lines
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
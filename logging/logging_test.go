@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		wantSame bool
+	}{
+		{name: "keeps the id of the caller", incoming: "abc-123", wantSame: true},
+		{name: "generates a missing id", incoming: "", wantSame: false},
+		{name: "replaces an id with spaces", incoming: "abc 123", wantSame: false},
+		{name: "replaces a too long id", incoming: strings.Repeat("a", maxRequestIDLength+1), wantSame: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inContext string
+			handler := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				inContext = RequestIDFromContext(r.Context())
+			}))
+			req := httptest.NewRequest("GET", "/getViews", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			got := rec.Header().Get(RequestIDHeader)
+			if got == "" || got != inContext {
+				t.Errorf("response id = %q, context id = %q", got, inContext)
+			}
+			if (got == tt.incoming) != tt.wantSame {
+				t.Errorf("response id = %q, incoming id = %q, wantSame %v", got, tt.incoming, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, FormatJSON, "warn")
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+	logger = WithContext(ContextWithRequestID(context.Background(), "req-1"), logger)
+	level.Info(logger).Log("msg", "dropped")
+	level.Warn(logger).Log("msg", "kept")
+
+	out := buf.String()
+	if strings.Contains(out, "dropped") || !strings.Contains(out, `"msg":"kept"`) || !strings.Contains(out, `"request_id":"req-1"`) {
+		t.Errorf("unexpected log output %s", out)
+	}
+	if _, err := NewLogger(&buf, "xml", "info"); err != ErrUnknownFormat {
+		t.Errorf("NewLogger() error = %v, want %v", err, ErrUnknownFormat)
+	}
+}
@@ -2,72 +2,75 @@ package main
 
 import (
 	"context"
-	"log"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
-	"youtube_service/config"
-	db "youtube_service/repository"
+	"youtube_service/events"
+	"youtube_service/pb"
 	service "youtube_service/service"
+	"youtube_service/setup"
+	"youtube_service/validation"
 
-	"github.com/go-redis/redis/v8"
-	"github.com/hashicorp/consul/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
 
 	log1 "github.com/go-kit/kit/log"
-)
-
-const (
-	defaultPort              = "8080"
-	defaultRoutingServiceURL = "http://localhost:8080"
+	"github.com/go-kit/kit/log/level"
 )
 
 func main() {
-	//using consul for configs
-	config_consul := api.DefaultConfig()
-	client_consul, err := api.NewClient(config_consul)
-	if err != nil {
-		log.Fatalf("Failed to create Consul client: %v", err)
+	//wiring the service from the consul configs, the metrics are served by the default registry
+	app := setup.New(prometheus.DefaultRegisterer)
+	defer app.ShutDownTracing(context.Background())
+	configs, logger := app.Configs, app.Logger
+
+	//bulk import of view counts instead of serving, e.g. ./youtube_service import -file views.csv
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		runImport(app.Service, app.VideoIDs, os.Args[2:], logger)
+		return
 	}
-	key, kv := "youtube_service_configs", client_consul.KV()
 
-	pair, _, err := kv.Get(key, nil)
-	if err != nil {
-		log.Printf("Failed to get key-value pair: %v", err)
-		log.Println("-Setting default configs")
+	//rebuilding the rolling window leaderboards, saving snapshots of every window and reloading the rate limits in the background
+	refreshCtx, stopRefresh := context.WithCancel(context.Background())
+	defer stopRefresh()
+	app.Start(refreshCtx)
+	//the publisher is stopped after the servers so the events of the last requests are still sent
+	publishCtx, stopPublishing := context.WithCancel(context.Background())
+	published := make(chan struct{})
+	go func() {
+		app.Publish(publishCtx)
+		close(published)
+	}()
 
+	//applying the views of a queue instead of serving the API, e.g. ./youtube_service consume
+	if len(os.Args) > 1 && os.Args[1] == "consume" {
+		runConsumer(app)
+		stopPublishing()
+		<-published
+		return
 	}
-	if pair == nil {
-		log.Printf("Key '%s' not found in Consul\nsetting up default configs", key)
-	}
-	//setting up configs from consul
-	config := config.SetConfigs(pair)
-
-	// Create a new Redis client
-	var rdb = redis.NewClient(&redis.Options{
-		Addr:     config.RedisURL,
-		Password: "",
-		DB:       0,
-	})
-
-	redis := db.NewRedis(rdb, config.RedisKey)
-
-	var logger log1.Logger
-
-	logger = log1.NewLogfmtLogger(log1.NewSyncWriter(os.Stderr))
-	logger = log1.With(logger, "ts", log1.DefaultTimestampUTC)
-
-	//creating a new service and wrapping it with logging layer
-	yt_service := service.NewService(redis)
-	yt_service = service.NewLoggingService(log1.With(logger), yt_service)
-
-	mux := http.NewServeMux()
-	mux.Handle("/", service.MakeHandler(yt_service, logger))
 
 	server := &http.Server{
-		Addr:    ":8080",
-		Handler: mux,
+		Addr:    configs.HTTPAddr,
+		Handler: app.Handler(promhttp.Handler()),
+	}
+
+	//the gRPC transport of the same endpoints on its own port
+	grpcServer := grpc.NewServer()
+	pb.RegisterLeaderboardServer(grpcServer, service.MakeGRPCServer(app.Service, logger, app.HandlerOptions...))
+	grpcListener, err := net.Listen("tcp", configs.GRPCAddr)
+	if err != nil {
+		fatal(logger, "Failed to listen for gRPC", err)
 	}
 
 	//-----Graceful Shutdown------
@@ -76,20 +79,119 @@ func main() {
 	signal.Notify(s, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, syscall.SIGHUP)
 
 	go func() {
-		log.Printf("Server started on %v \n", defaultRoutingServiceURL)
-		log.Println(server.ListenAndServe())
+		level.Info(logger).Log("msg", "Server started", "addr", configs.HTTPAddr)
+		level.Info(logger).Log("msg", "Server stopped", "err", server.ListenAndServe())
+	}()
+	go func() {
+		level.Info(logger).Log("msg", "gRPC server started", "addr", configs.GRPCAddr)
+		level.Info(logger).Log("msg", "gRPC server stopped", "err", grpcServer.Serve(grpcListener))
 	}()
 
 	<-s
-	shutDown(server)
+	shutDown(server, grpcServer, logger)
+	stopPublishing()
+	<-published
 
 }
 
-func shutDown(server *http.Server) {
+func shutDown(server *http.Server, grpcServer *grpc.Server, logger log1.Logger) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	if err := server.Shutdown(ctx); err != nil {
-		log.Println("Handle error while server shutdown")
+		level.Error(logger).Log("msg", "Handle error while server shutdown", "err", err)
+	}
+	//the watch streams only end with their clients, they are cut once the timeout is over
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		grpcServer.Stop()
+	}
+	level.Info(logger).Log("msg", "doing gracefull shutdown")
+}
+
+// fatal logs err at error level and exits
+func fatal(logger log1.Logger, msg string, err error) {
+	level.Error(logger).Log("msg", msg, "err", err)
+	os.Exit(1)
+}
+
+// runConsumer applies the views of the queue until the process is stopped, only the health and the metrics are served
+func runConsumer(app *setup.App) {
+	configs, logger := app.Configs, app.Logger
+	if configs.ConsumeSource == configs.EventBroker && configs.ConsumeTopic == configs.EventTopic {
+		fatal(logger, "Failed to set up the consumer", errors.New("the views would be published to the queue they are read from"))
+	}
+	//the instances share the consumer group, every one of them is a consumer of its own
+	hostname, _ := os.Hostname()
+	timeout := time.Duration(configs.ConsumeTimeoutMillis) * time.Millisecond
+	source, err := events.NewSource(configs.ConsumeSource, app.Client, configs.ConsumeTopic, configs.ConsumeGroup, hostname+"-"+strconv.Itoa(os.Getpid()),
+		configs.ConsumeDeadLetters, configs.ConsumeBrokerAddr, time.Duration(configs.ConsumeAckWaitSeconds)*time.Second, timeout)
+	if err != nil {
+		fatal(logger, "Failed to set up the consumer", err)
+	}
+	consumer := events.NewConsumer(source, service.ViewEventHandler(app.Service, app.Database, app.VideoIDs, time.Duration(configs.ConsumeDedupSeconds)*time.Second), events.ConsumerOptions{
+		Concurrency:   configs.ConsumeConcurrency,
+		BatchSize:     configs.ConsumeBatchSize,
+		MaxDeliveries: configs.ConsumeMaxDeliveries,
+		LagInterval:   time.Duration(configs.ConsumeLagSeconds) * time.Second,
+		Timeout:       timeout,
+	}, events.NewPrometheusConsumerMetrics(prometheus.DefaultRegisterer), logger)
+
+	mux := http.NewServeMux()
+	mux.Handle("/health", service.MakeHealthHandler(app.Health))
+	mux.Handle("/metrics", promhttp.Handler())
+	server := &http.Server{Addr: configs.HTTPAddr, Handler: mux}
+	go func() {
+		level.Info(logger).Log("msg", "Server stopped", "err", server.ListenAndServe())
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, os.Interrupt, syscall.SIGHUP)
+	defer stop()
+	level.Info(logger).Log("msg", "Consumer started", "source", configs.ConsumeSource, "topic", configs.ConsumeTopic, "group", configs.ConsumeGroup)
+	consumer.Run(ctx)
+	level.Info(logger).Log("msg", "Consumer stopped")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	server.Shutdown(shutdownCtx)
+}
+
+func runImport(s service.Service, videoIDs *validation.Validator, args []string, logger log1.Logger) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	file := flags.String("file", "", "csv or ndjson file with videoID,views[,date] rows")
+	format := flags.String("format", "", "csv or ndjson, taken from the file extension when empty")
+	dryRun := flags.Bool("dry-run", false, "only validate the file")
+	resumeFrom := flags.Int("resume-from", 0, "skip every line before this one")
+	batchSize := flags.Int("batch-size", 0, "number of records written per pipeline")
+	flags.Parse(args)
+
+	f, err := os.Open(*file)
+	if err != nil {
+		fatal(logger, "Failed to open import file", err)
+	}
+	defer f.Close()
+
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(*file), ".")
+	}
+	report, err := s.ImportViews(context.Background(), f, service.ImportOptions{
+		Format:     *format,
+		DryRun:     *dryRun,
+		ResumeFrom: *resumeFrom,
+		BatchSize:  *batchSize,
+
+		NormalizeVideoID: service.ImportVideoIDs(videoIDs),
+	})
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+	if err != nil {
+		level.Error(logger).Log("msg", "Import stopped", "resumeFrom", report.LastLine+1, "err", err)
+		os.Exit(1)
 	}
-	log.Println("doing gracefull shutdown ")
 }
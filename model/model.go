@@ -1,6 +1,99 @@
 package model
 
+import "time"
+
 type ResultRedis struct {
 	VideoID   string `json:"videoID"`
 	ViewCount int    `json:"viewCount"`
 }
+
+// ViewRecord is one row of a bulk import, Date is zero for lifetime counts
+type ViewRecord struct {
+	VideoID string    `json:"videoID"`
+	Views   int       `json:"views"`
+	Date    time.Time `json:"date,omitempty"`
+}
+
+// HistoryPoint is the number of views a video got in the day or hour starting at Time
+type HistoryPoint struct {
+	Time  time.Time `json:"time"`
+	Views int       `json:"views"`
+}
+
+// VideoStats are the lifetime views of a video and its rank in a leaderboard window,
+// ranks start at 1 and are 0 when the video has no views in the window
+type VideoStats struct {
+	VideoID   string `json:"videoID"`
+	ViewCount int    `json:"viewCount"`
+	Rank      int    `json:"rank"`
+}
+
+// Snapshot is the top of a leaderboard window at a point in time
+type Snapshot struct {
+	Window  string        `json:"window"`
+	TakenAt time.Time     `json:"takenAt"`
+	Videos  []ResultRedis `json:"videos"`
+}
+
+// RankChange is the movement of a video between two snapshots, ranks start at 1 and are 0 when not ranked
+type RankChange struct {
+	VideoID      string `json:"videoID"`
+	PreviousRank int    `json:"previousRank"`
+	Rank         int    `json:"rank"`
+	Movement     int    `json:"movement"`
+	ViewCount    int    `json:"viewCount"`
+}
+
+// LeaderboardDiff is the rank movement of the top of a window between its two last snapshots
+type LeaderboardDiff struct {
+	Window     string       `json:"window"`
+	From       time.Time    `json:"from"`
+	To         time.Time    `json:"to"`
+	NewEntries []RankChange `json:"newEntries"`
+	Climbers   []RankChange `json:"climbers"`
+	Fallers    []RankChange `json:"fallers"`
+	DropOuts   []RankChange `json:"dropOuts"`
+}
+
+// Health is the state of the database as seen by the service
+type Health struct {
+	Status         string `json:"status"`
+	Redis          bool   `json:"redis"`
+	Breaker        string `json:"breaker"`
+	BufferedWrites int    `json:"bufferedWrites"`
+}
+
+// AuditEntry is a recorded mutation, Before and After are the lifetime views of the video around it
+// and SampleRate is the share of the calls of Method which are recorded
+type AuditEntry struct {
+	ID         string    `json:"id,omitempty"`
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	VideoID    string    `json:"videoID,omitempty"`
+	Subject    string    `json:"subject,omitempty"`
+	RequestID  string    `json:"requestID,omitempty"`
+	Before     float64   `json:"before"`
+	After      float64   `json:"after"`
+	SampleRate float64   `json:"sampleRate"`
+	Details    string    `json:"details,omitempty"`
+	Err        string    `json:"error,omitempty"`
+}
+
+// AuditFilter selects audit entries, the zero fields match everything
+type AuditFilter struct {
+	Method  string
+	VideoID string
+	Subject string
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+}
+
+// Matches tells if entry is selected by the filter, the limit aside
+func (f AuditFilter) Matches(entry AuditEntry) bool {
+	return (f.Method == "" || f.Method == entry.Method) &&
+		(f.VideoID == "" || f.VideoID == entry.VideoID) &&
+		(f.Subject == "" || f.Subject == entry.Subject) &&
+		(f.Since.IsZero() || !entry.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || !entry.Time.After(f.Until))
+}
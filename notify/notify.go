@@ -0,0 +1,164 @@
+// Package notify tells the live streams of an instance that a topic, a leaderboard window or a video,
+// may have changed, the changes are shared between the instances through a Relay
+package notify
+
+import (
+	"context"
+	"sync"
+)
+
+// Relay shares the changed topics between the instances
+type Relay interface {
+	// Publish sends the changed topics to the other instances, it must not block
+	Publish(topics []string)
+	// Run delivers the topics changed by the other instances until ctx is done
+	Run(ctx context.Context, deliver func(topics []string)) error
+}
+
+// Notifier fans the changes of a topic out to its subscribers, a subscriber which has not taken
+// a change yet gets the next ones merged with it so a slow reader never holds up the writes
+type Notifier struct {
+	relay Relay
+
+	mu          sync.Mutex
+	subscribers map[string]map[*Subscription]struct{}
+}
+
+// New returns a Notifier sharing the changes through relay, nil keeps them in the instance
+func New(relay Relay) *Notifier {
+	return &Notifier{
+		relay:       relay,
+		subscribers: map[string]map[*Subscription]struct{}{},
+	}
+}
+
+// Subscription follows the changes of a set of topics, C receives a value once some of them changed
+type Subscription struct {
+	C <-chan struct{}
+
+	notifier *Notifier
+	c        chan struct{}
+	// the subscribed topics are guarded by the mutex of the notifier
+	topics map[string]struct{}
+
+	mu      sync.Mutex
+	changed map[string]struct{}
+}
+
+// NewSubscription returns a Subscription to topics, Close has to be called once done
+func (n *Notifier) NewSubscription(topics ...string) *Subscription {
+	c := make(chan struct{}, 1)
+	s := &Subscription{
+		C:        c,
+		notifier: n,
+		c:        c,
+		topics:   map[string]struct{}{},
+		changed:  map[string]struct{}{},
+	}
+	s.Add(topics...)
+	return s
+}
+
+// Subscribe returns a channel receiving a value after the changes of topic, cancel has to be called once done
+func (n *Notifier) Subscribe(topic string) (changes <-chan struct{}, cancel func()) {
+	s := n.NewSubscription(topic)
+	return s.C, s.Close
+}
+
+// Add follows the changes of topics too
+func (s *Subscription) Add(topics ...string) {
+	n := s.notifier
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, topic := range topics {
+		if n.subscribers[topic] == nil {
+			n.subscribers[topic] = map[*Subscription]struct{}{}
+		}
+		n.subscribers[topic][s] = struct{}{}
+		s.topics[topic] = struct{}{}
+	}
+}
+
+// Remove stops following the changes of topics
+func (s *Subscription) Remove(topics ...string) {
+	n := s.notifier
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, topic := range topics {
+		delete(n.subscribers[topic], s)
+		if len(n.subscribers[topic]) == 0 {
+			delete(n.subscribers, topic)
+		}
+		delete(s.topics, topic)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, topic := range topics {
+		delete(s.changed, topic)
+	}
+}
+
+// Topics returns the subscribed topics
+func (s *Subscription) Topics() []string {
+	s.notifier.mu.Lock()
+	defer s.notifier.mu.Unlock()
+	topics := make([]string, 0, len(s.topics))
+	for topic := range s.topics {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// Changed returns the topics changed since the last call
+func (s *Subscription) Changed() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	topics := make([]string, 0, len(s.changed))
+	for topic := range s.changed {
+		topics = append(topics, topic)
+	}
+	s.changed = map[string]struct{}{}
+	return topics
+}
+
+// Close stops following every topic, it can be called more than once
+func (s *Subscription) Close() {
+	s.Remove(s.Topics()...)
+}
+
+func (s *Subscription) notify(topic string) {
+	s.mu.Lock()
+	s.changed[topic] = struct{}{}
+	s.mu.Unlock()
+	select {
+	case s.c <- struct{}{}:
+	default:
+	}
+}
+
+// Notify tells the subscribers of this instance and of the other ones that topics changed
+func (n *Notifier) Notify(topics ...string) {
+	n.deliver(topics)
+	if n.relay != nil {
+		n.relay.Publish(topics)
+	}
+}
+
+// Run delivers the changes of the other instances until ctx is done
+func (n *Notifier) Run(ctx context.Context) error {
+	if n.relay == nil {
+		<-ctx.Done()
+		return nil
+	}
+	return n.relay.Run(ctx, n.deliver)
+}
+
+func (n *Notifier) deliver(topics []string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, topic := range topics {
+		for s := range n.subscribers[topic] {
+			s.notify(topic)
+		}
+	}
+}
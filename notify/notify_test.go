@@ -0,0 +1,114 @@
+package notify
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+type fakeRelay struct {
+	published [][]string
+	incoming  chan []string
+}
+
+func (r *fakeRelay) Publish(topics []string) {
+	r.published = append(r.published, topics)
+}
+
+func (r *fakeRelay) Run(ctx context.Context, deliver func(topics []string)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case topics := <-r.incoming:
+			deliver(topics)
+		}
+	}
+}
+
+func received(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	relay := &fakeRelay{incoming: make(chan []string)}
+	n := New(relay)
+	today, cancelToday := n.Subscribe("today")
+	defer cancelToday()
+	lifetime, cancelLifetime := n.Subscribe("lifetime")
+
+	//the changes not taken yet are merged
+	n.Notify("today")
+	n.Notify("today")
+	if !received(today) || received(today) {
+		t.Error("today subscriber should get the two changes as one")
+	}
+	if received(lifetime) {
+		t.Error("lifetime subscriber got a change of today")
+	}
+	if want := [][]string{{"today"}, {"today"}}; !reflect.DeepEqual(relay.published, want) {
+		t.Errorf("published = %v, want %v", relay.published, want)
+	}
+
+	cancelLifetime()
+	cancelLifetime()
+	n.Notify("lifetime")
+	if received(lifetime) {
+		t.Error("cancelled subscriber got a change")
+	}
+
+	//the changes of the other instances are delivered but not published again
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- n.Run(ctx) }()
+	relay.incoming <- []string{"today"}
+	select {
+	case <-today:
+	case <-time.After(time.Second):
+		t.Fatal("change of another instance not delivered")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if len(relay.published) != 3 {
+		t.Errorf("published = %v, the delivered change should not be published", relay.published)
+	}
+}
+
+func TestSubscription(t *testing.T) {
+	n := New(nil)
+	s := n.NewSubscription("video1")
+	defer s.Close()
+	s.Add("video2")
+
+	n.Notify("video1", "video3")
+	n.Notify("video2")
+	if !received(s.C) {
+		t.Fatal("subscription not notified")
+	}
+	changed := s.Changed()
+	sort.Strings(changed)
+	if want := []string{"video1", "video2"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("Changed() = %v, want %v", changed, want)
+	}
+	if changed := s.Changed(); len(changed) != 0 {
+		t.Errorf("Changed() = %v, want nothing new", changed)
+	}
+
+	s.Remove("video1")
+	n.Notify("video1")
+	if received(s.C) || len(s.Changed()) != 0 {
+		t.Error("removed topic still notified")
+	}
+	if topics := s.Topics(); !reflect.DeepEqual(topics, []string{"video2"}) {
+		t.Errorf("Topics() = %v, want [video2]", topics)
+	}
+}
@@ -0,0 +1,94 @@
+package notify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// the changes of an instance are published at most once per flushInterval, every view would be a message otherwise
+const flushInterval = 100 * time.Millisecond
+
+type message struct {
+	Source string   `json:"source"`
+	Topics []string `json:"topics"`
+}
+
+type redisRelay struct {
+	client  *redis.Client
+	channel string
+	source  string
+
+	mu      sync.Mutex
+	pending map[string]struct{}
+}
+
+// NewRedisRelay returns a Relay sharing the changes over the redis pub/sub channel, the messages of
+// the instance itself are skipped
+func NewRedisRelay(client *redis.Client, channel string) Relay {
+	source := make([]byte, 8)
+	rand.Read(source)
+	return &redisRelay{
+		client:  client,
+		channel: channel,
+		source:  hex.EncodeToString(source),
+		pending: map[string]struct{}{},
+	}
+}
+
+func (r *redisRelay) Publish(topics []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, topic := range topics {
+		r.pending[topic] = struct{}{}
+	}
+}
+
+// Run subscribes to the channel and publishes the pending changes every flushInterval, the
+// subscription reconnects by itself while redis is down
+func (r *redisRelay) Run(ctx context.Context, deliver func(topics []string)) error {
+	pubsub := r.client.Subscribe(ctx, r.channel)
+	defer pubsub.Close()
+	messages := pubsub.Channel()
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			r.flush(ctx)
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			var m message
+			if err := json.Unmarshal([]byte(msg.Payload), &m); err != nil || m.Source == r.source {
+				continue
+			}
+			deliver(m.Topics)
+		}
+	}
+}
+
+// flush publishes the pending changes, they are dropped when redis is down as the streams also refresh on their own
+func (r *redisRelay) flush(ctx context.Context) {
+	r.mu.Lock()
+	if len(r.pending) == 0 {
+		r.mu.Unlock()
+		return
+	}
+	m := message{Source: r.source}
+	for topic := range r.pending {
+		m.Topics = append(m.Topics, topic)
+	}
+	r.pending = map[string]struct{}{}
+	r.mu.Unlock()
+	data, _ := json.Marshal(m)
+	r.client.Publish(ctx, r.channel, data)
+}
@@ -0,0 +1,243 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"youtube_service/apierror"
+
+	"github.com/go-kit/kit/endpoint"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// APIKeyHeader identifies the caller for the per API key limit
+const APIKeyHeader = "X-API-Key"
+
+// Limit is a token bucket refilled with Rate tokens per second up to Burst tokens,
+// a zero Rate means no limit and a zero Burst is one second worth of tokens
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+func (l Limit) enabled() bool { return l.Rate > 0 }
+
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return int(math.Max(1, math.Ceil(l.Rate)))
+}
+
+// Limits are the limits of the view ingestion, the client IP of a request from one of the TrustedProxies,
+// IPs or CIDRs, is read from its X-Forwarded-For header
+type Limits struct {
+	PerAPIKey      Limit    `json:"perAPIKey"`
+	PerIP          Limit    `json:"perIP"`
+	PerVideo       Limit    `json:"perVideo"`
+	TrustedProxies []string `json:"trustedProxies"`
+}
+
+// Validate returns an error when one of the trusted proxies is neither an IP nor a CIDR
+func (l Limits) Validate() error {
+	_, err := parseProxies(l.TrustedProxies)
+	return err
+}
+
+func parseProxies(proxies []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if strings.Contains(proxy, "/") {
+			_, network, err := net.ParseCIDR(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("trusted proxy %q is neither an IP nor a CIDR", proxy)
+			}
+			networks = append(networks, network)
+			continue
+		}
+		ip := net.ParseIP(proxy)
+		if ip == nil {
+			return nil, fmt.Errorf("trusted proxy %q is neither an IP nor a CIDR", proxy)
+		}
+		bits := 8 * len(ip)
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+		networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return networks, nil
+}
+
+// LimitedError is returned when a bucket is empty
+type LimitedError struct {
+	Scope      string
+	RetryAfter time.Duration
+}
+
+func (e *LimitedError) Error() string {
+	return fmt.Sprintf("rate limit per %s exceeded", e.Scope)
+}
+
+// RetryAfterSeconds is the value of the Retry-After header, at least one second
+func (e *LimitedError) RetryAfterSeconds() string {
+	return strconv.Itoa(int(math.Max(1, math.Ceil(e.RetryAfter.Seconds()))))
+}
+
+// Limiter applies the Limits, they can be replaced at any time with SetLimits
+type Limiter struct {
+	store Store
+	//the limits and their parsed trusted proxies
+	state atomic.Value
+}
+
+type limiterState struct {
+	limits  Limits
+	proxies []*net.IPNet
+}
+
+func NewLimiter(store Store, limits Limits) *Limiter {
+	l := &Limiter{store: store}
+	l.SetLimits(limits)
+	return l
+}
+
+// SetLimits replaces the limits, the trusted proxies which are neither an IP nor a CIDR are skipped
+func (l *Limiter) SetLimits(limits Limits) {
+	state := limiterState{limits: limits}
+	for _, proxy := range limits.TrustedProxies {
+		if networks, err := parseProxies([]string{proxy}); err == nil {
+			state.proxies = append(state.proxies, networks...)
+		}
+	}
+	l.state.Store(state)
+}
+
+func (l *Limiter) Limits() Limits {
+	return l.state.Load().(limiterState).limits
+}
+
+// take returns a LimitedError when the bucket of id is empty, a failing store lets the request through
+func (l *Limiter) take(ctx context.Context, scope, id string, limit Limit) error {
+	if !limit.enabled() || id == "" {
+		return nil
+	}
+	allowed, retryAfter, err := l.store.Take(ctx, scope+":"+id, limit)
+	if err != nil || allowed {
+		return nil
+	}
+	return &LimitedError{Scope: scope, RetryAfter: retryAfter}
+}
+
+// HTTPMiddleware limits the requests per API key and per client IP, answering 429 with a Retry-After
+func (l *Limiter) HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limited, ok := l.Check(r).(*LimitedError); ok {
+			WriteLimited(r.Context(), w, limited)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Check takes a token for the API key and the client IP of r, the error is a *LimitedError
+// when one of them is limited
+func (l *Limiter) Check(r *http.Request) error {
+	return l.checkClient(r.Context(), r.Header.Get(APIKeyHeader), clientIP(r, l.state.Load().(limiterState).proxies))
+}
+
+func (l *Limiter) checkClient(ctx context.Context, apiKey, ip string) error {
+	limits := l.Limits()
+	if err := l.take(ctx, "apiKey", apiKey, limits.PerAPIKey); err != nil {
+		return err
+	}
+	return l.take(ctx, "ip", ip, limits.PerIP)
+}
+
+// GRPCMiddleware limits the gRPC requests per API key of the metadata and per peer IP, the context
+// of the endpoint is the one of the gRPC call
+func (l *Limiter) GRPCMiddleware() endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			var apiKey, ip string
+			if md, ok := metadata.FromIncomingContext(ctx); ok {
+				if keys := md.Get(APIKeyHeader); len(keys) > 0 {
+					apiKey = keys[0]
+				}
+			}
+			if p, ok := peer.FromContext(ctx); ok {
+				ip = hostOf(p.Addr.String())
+			}
+			if err := l.checkClient(ctx, apiKey, ip); err != nil {
+				return nil, err
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// EndpointMiddleware limits the requests per video, videoOf returns the video of a decoded request
+func (l *Limiter) EndpointMiddleware(videoOf func(request interface{}) string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if err := l.take(ctx, "video", videoOf(request), l.Limits().PerVideo); err != nil {
+				return nil, err
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// WriteLimited answers the request of ctx with the 429 of a LimitedError
+func WriteLimited(ctx context.Context, w http.ResponseWriter, err *LimitedError) {
+	w.Header().Set("Retry-After", err.RetryAfterSeconds())
+	apierror.Write(ctx, w, http.StatusTooManyRequests, err)
+}
+
+// clientIP is the remote address of r, or the nearest address of its X-Forwarded-For which is not
+// one of the trusted proxies when r comes from one of them. The other clients could set any address.
+func clientIP(r *http.Request, proxies []*net.IPNet) string {
+	ip := hostOf(r.RemoteAddr)
+	if !trusted(ip, proxies) {
+		return ip
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !trusted(ip, proxies) {
+			break
+		}
+	}
+	return ip
+}
+
+func trusted(ip string, proxies []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, proxy := range proxies {
+		if proxy.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
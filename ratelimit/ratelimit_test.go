@@ -0,0 +1,195 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Now()
+	store := &memoryStore{buckets: map[string]*bucket{}, now: func() time.Time { return now }}
+	limit := Limit{Rate: 1, Burst: 2}
+	tests := []struct {
+		name        string
+		elapsed     time.Duration
+		wantAllowed bool
+		wantRetry   time.Duration
+	}{
+		{name: "starts full", wantAllowed: true},
+		{name: "spends the burst", wantAllowed: true},
+		{name: "empty bucket", wantAllowed: false, wantRetry: time.Second},
+		{name: "refills over time", elapsed: time.Second, wantAllowed: true},
+		{name: "half a token", elapsed: 500 * time.Millisecond, wantAllowed: false, wantRetry: 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.elapsed)
+			allowed, retry, err := store.Take(context.Background(), "video:a", limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if allowed != tt.wantAllowed || retry != tt.wantRetry {
+				t.Errorf("Take() = %v, %v, want %v, %v", allowed, retry, tt.wantAllowed, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestMemoryStore_sweep(t *testing.T) {
+	now := time.Now()
+	store := &memoryStore{buckets: map[string]*bucket{}, now: func() time.Time { return now }}
+	//a slow limit takes an hour to refill, a fast one a second
+	slow := Limit{Rate: 1.0 / 3600, Burst: 1}
+	fast := Limit{Rate: 1, Burst: 1}
+	store.Take(context.Background(), "key:slow", slow)
+	for i := 0; i <= maxMemoryBuckets; i++ {
+		store.Take(context.Background(), "ip:"+strconv.Itoa(i), fast)
+	}
+	now = now.Add(time.Minute)
+	//the sweep from a fast key keeps the empty slow bucket
+	store.Take(context.Background(), "ip:new", fast)
+	if _, ok := store.buckets["key:slow"]; !ok {
+		t.Fatal("the slow bucket was swept before it refilled")
+	}
+	if len(store.buckets) != 2 {
+		t.Errorf("%d buckets after the sweep, want 2", len(store.buckets))
+	}
+	if allowed, _, _ := store.Take(context.Background(), "key:slow", slow); allowed {
+		t.Error("the slow bucket was refilled by the sweep")
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, Limit) (bool, time.Duration, error) {
+	return false, 0, errors.New("connection refused")
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		store      Store
+		limits     Limits
+		apiKey     string
+		wantStatus []int
+	}{
+		{name: "no limits", store: NewMemoryStore(), wantStatus: []int{200, 200, 200}},
+		{name: "per ip", store: NewMemoryStore(), limits: Limits{PerIP: Limit{Rate: 0.1, Burst: 2}}, wantStatus: []int{200, 200, 429}},
+		{name: "per api key", store: NewMemoryStore(), limits: Limits{PerAPIKey: Limit{Rate: 0.1, Burst: 1}}, apiKey: "k", wantStatus: []int{200, 429, 429}},
+		{name: "falls back to memory", store: NewFallbackStore(failingStore{}, NewMemoryStore()), limits: Limits{PerIP: Limit{Rate: 0.1, Burst: 1}}, wantStatus: []int{200, 429, 429}},
+		{name: "failing store lets through", store: failingStore{}, limits: Limits{PerIP: Limit{Rate: 0.1, Burst: 1}}, wantStatus: []int{200, 200, 200}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewLimiter(tt.store, tt.limits).HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			for i, want := range tt.wantStatus {
+				req := httptest.NewRequest("GET", "/viewVideo?videoName=a", nil)
+				if tt.apiKey != "" {
+					req.Header.Set(APIKeyHeader, tt.apiKey)
+				}
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				if rec.Code != want {
+					t.Fatalf("request %d status = %d, want %d", i, rec.Code, want)
+				}
+				if want == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "10" {
+					t.Errorf("Retry-After = %q, want 10", rec.Header().Get("Retry-After"))
+				}
+			}
+		})
+	}
+}
+
+func TestSetLimits(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore(), Limits{PerVideo: Limit{Rate: 0.1, Burst: 1}})
+	next := func(context.Context, interface{}) (interface{}, error) { return nil, nil }
+	e := limiter.EndpointMiddleware(func(request interface{}) string { return request.(string) })(next)
+
+	e(context.Background(), "a")
+	_, err := e(context.Background(), "a")
+	var limited *LimitedError
+	if !errors.As(err, &limited) || limited.Scope != "video" {
+		t.Fatalf("err = %v, want a video LimitedError", err)
+	}
+	if _, err := e(context.Background(), "b"); err != nil {
+		t.Errorf("other video err = %v", err)
+	}
+
+	limiter.SetLimits(Limits{})
+	if _, err := e(context.Background(), "a"); err != nil {
+		t.Errorf("err after removing the limits = %v", err)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	limits := Limits{TrustedProxies: []string{"10.0.0.0/8", "192.0.2.1"}}
+	if err := limits.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	proxies, _ := parseProxies(limits.TrustedProxies)
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.7:4000", want: "203.0.113.7"},
+		{name: "untrusted forwarder", remoteAddr: "203.0.113.7:4000", forwarded: []string{"198.51.100.1"}, want: "203.0.113.7"},
+		{name: "trusted proxy", remoteAddr: "10.1.2.3:4000", forwarded: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{name: "chain of trusted proxies", remoteAddr: "192.0.2.1:4000", forwarded: []string{"198.51.100.9, 198.51.100.1, 10.0.0.5"}, want: "198.51.100.1"},
+		{name: "several headers", remoteAddr: "10.1.2.3:4000", forwarded: []string{"198.51.100.9", "198.51.100.1"}, want: "198.51.100.1"},
+		{name: "malformed hop", remoteAddr: "10.1.2.3:4000", forwarded: []string{"198.51.100.1, junk"}, want: "10.1.2.3"},
+		{name: "trusted proxy without the header", remoteAddr: "10.1.2.3:4000", want: "10.1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/viewVideo", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := clientIP(r, proxies); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if err := (Limits{TrustedProxies: []string{"10.0.0.0/33"}}).Validate(); err == nil {
+		t.Error("Validate() of a malformed proxy = nil, want an error")
+	}
+}
+
+func TestRedisStore_timeout(t *testing.T) {
+	//a redis which never answers
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	client := redis.NewClient(&redis.Options{Addr: listener.Addr().String(), ReadTimeout: time.Minute})
+	defer client.Close()
+
+	start := time.Now()
+	if _, _, err := NewRedisStore(client, "rl:", 50*time.Millisecond).Take(context.Background(), "ip:a", Limit{Rate: 1}); err == nil {
+		t.Fatal("Take() = nil error, want the timeout")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Take() took %v, want about the timeout", elapsed)
+	}
+}
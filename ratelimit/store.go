@@ -0,0 +1,148 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Store takes a token from the bucket of key, when the bucket is empty allowed is false
+// and retryAfter is the time until the next token
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// the bucket is refilled from the time elapsed since its last take, TIME keeps every instance on the redis clock
+var tokenBucketScript = redis.NewScript(`
+redis.replicate_commands()
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1]) or burst
+local ts = tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = (1 - tokens) / rate
+end
+redis.call('HSET', KEYS[1], 'tokens', tokens, 'ts', now)
+redis.call('EXPIRE', KEYS[1], math.ceil(burst / rate) + 1)
+return {allowed, tostring(retry)}
+`)
+
+type redisStore struct {
+	client  *redis.Client
+	prefix  string
+	timeout time.Duration
+}
+
+// NewRedisStore returns a Store keeping the buckets in redis so every instance shares them, every
+// take is bounded by timeout like the calls of the database
+func NewRedisStore(client *redis.Client, prefix string, timeout time.Duration) Store {
+	return &redisStore{client: client, prefix: prefix, timeout: timeout}
+}
+
+func (s *redisStore) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	reply, err := tokenBucketScript.Run(ctx, s.client, []string{s.prefix + key}, limit.Rate, limit.burst()).Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	allowed, _ := reply[0].(int64)
+	retryText, _ := reply[1].(string)
+	retry, err := strconv.ParseFloat(retryText, 64)
+	if err != nil {
+		return false, 0, err
+	}
+	return allowed == 1, seconds(retry), nil
+}
+
+// buckets are swept once there are more than this many of them
+const maxMemoryBuckets = 10000
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	//time to refill the bucket from empty with its last limit
+	full time.Duration
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+// NewMemoryStore returns a Store keeping the buckets of this instance in memory
+func NewMemoryStore() Store {
+	return &memoryStore{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+func (s *memoryStore) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	burst := float64(limit.burst())
+	if len(s.buckets) > maxMemoryBuckets {
+		s.sweep(now)
+	}
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+	b.full = seconds(burst / limit.Rate)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	return false, seconds((1 - b.tokens) / limit.Rate), nil
+}
+
+// sweep drops the buckets which would be full by now, they are the same as missing ones,
+// each bucket refills with the limit of its own key
+func (s *memoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if now.Sub(b.last) > b.full {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+type fallbackStore struct {
+	primary  Store
+	fallback Store
+}
+
+// NewFallbackStore returns a Store using primary and falling back to fallback when primary fails
+func NewFallbackStore(primary, fallback Store) Store {
+	return &fallbackStore{primary: primary, fallback: fallback}
+}
+
+func (s *fallbackStore) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	allowed, retryAfter, err := s.primary.Take(ctx, key, limit)
+	if err != nil {
+		return s.fallback.Take(ctx, key, limit)
+	}
+	return allowed, retryAfter, nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
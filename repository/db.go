@@ -1,14 +1,30 @@
 package database
 
 import (
+	"context"
+	"time"
 	model "youtube_service/model"
 )
 
 //go:generate mockgen -source=db.go -destination mock/mock.go
 type Database interface {
-	Set(member string, score float64) error
-	CheckDBHealth() bool
-	GetScore(member string) (response float64, err error)
-	GetSortedRecords(n int, ifLifeTime bool) ([]model.ResultRedis, error)
-	IncreaseScore(videoName string, increaseBy float64) (err error)
+	Set(ctx context.Context, member string, score float64) error
+	CheckDBHealth(ctx context.Context) bool
+	GetScore(ctx context.Context, member string) (response float64, err error)
+	GetSortedRecords(ctx context.Context, n int, ifLifeTime bool) ([]model.ResultRedis, error)
+	IncreaseScore(ctx context.Context, videoName string, increaseBy float64) (err error)
+	// IncreaseScoreAt counts views made at a time which can be past, in the day and hour of at
+	IncreaseScoreAt(ctx context.Context, videoName string, increaseBy float64, at time.Time) (err error)
+	SetScores(ctx context.Context, records []model.ViewRecord) error
+	ScanRecords(ctx context.Context, isLifeTime bool, each func(model.ResultRedis) error) error
+	GetScoresAndRanks(ctx context.Context, members []string, window string) ([]model.VideoStats, error)
+	GetScoreHistory(ctx context.Context, member string, buckets []time.Time, hourly bool) ([]float64, error)
+	RefreshRollingRecords(ctx context.Context, window string, hours int) error
+	GetRollingRecords(ctx context.Context, window string, n int) ([]model.ResultRedis, error)
+	SaveSnapshot(ctx context.Context, snapshot model.Snapshot) error
+	GetLastSnapshots(ctx context.Context, window string) ([]model.Snapshot, error)
+	// Claim takes name for ttl when nobody holds it, it is true for the one caller that got it
+	Claim(ctx context.Context, name string, ttl time.Duration) (bool, error)
+	// Release drops the claim of name so it can be taken again
+	Release(ctx context.Context, name string) error
 }
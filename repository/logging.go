@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"time"
+	"youtube_service/logging"
+
+	log1 "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-redis/redis/v8"
+)
+
+type startKey struct{}
+
+// loggingHook logs every redis command and pipeline at debug level with the request id of its context
+type loggingHook struct {
+	logger log1.Logger
+}
+
+// NewLoggingHook returns a redis hook logging the commands to logger
+func NewLoggingHook(logger log1.Logger) redis.Hook {
+	return &loggingHook{logger: logger}
+}
+
+func (h *loggingHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, startKey{}, time.Now()), nil
+}
+
+func (h *loggingHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.log(ctx, cmd.FullName(), 1, cmd.Err())
+	return nil
+}
+
+func (h *loggingHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, startKey{}, time.Now()), nil
+}
+
+func (h *loggingHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmd.Err() != nil && cmd.Err() != redis.Nil {
+			err = cmd.Err()
+			break
+		}
+	}
+	h.log(ctx, "pipeline", len(cmds), err)
+	return nil
+}
+
+func (h *loggingHook) log(ctx context.Context, command string, commands int, err error) {
+	if err == redis.Nil {
+		err = nil
+	}
+	logger := level.Debug(logging.WithContext(ctx, h.logger))
+	if err != nil {
+		logger = level.Error(logging.WithContext(ctx, h.logger))
+	}
+	begin, _ := ctx.Value(startKey{}).(time.Time)
+	logger.Log(
+		"component", "redis",
+		"command", command,
+		"commands", commands,
+		"took", time.Since(begin),
+		"err", err,
+	)
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sony/gobreaker"
+)
+
+// poolStatsCollector exports the connection pool stats of a redis client on every scrape
+type poolStatsCollector struct {
+	client     *redis.Client
+	hits       *prometheus.Desc
+	misses     *prometheus.Desc
+	timeouts   *prometheus.Desc
+	totalConns *prometheus.Desc
+	idleConns  *prometheus.Desc
+	staleConns *prometheus.Desc
+}
+
+// NewPoolStatsCollector returns a prometheus collector of the pool stats of client
+func NewPoolStatsCollector(client *redis.Client) prometheus.Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("redis", "pool", name), help, nil, nil)
+	}
+	return &poolStatsCollector{
+		client:     client,
+		hits:       desc("hits_total", "Number of times a free connection was found in the pool."),
+		misses:     desc("misses_total", "Number of times a free connection was not found in the pool."),
+		timeouts:   desc("timeouts_total", "Number of times a wait for a connection timed out."),
+		totalConns: desc("total_connections", "Number of connections in the pool."),
+		idleConns:  desc("idle_connections", "Number of idle connections in the pool."),
+		staleConns: desc("stale_connections_total", "Number of stale connections removed from the pool."),
+	}
+}
+
+func (c *poolStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.timeouts
+	ch <- c.totalConns
+	ch <- c.idleConns
+	ch <- c.staleConns
+}
+
+func (c *poolStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.client.PoolStats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(c.timeouts, prometheus.CounterValue, float64(stats.Timeouts))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stats.TotalConns))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stats.IdleConns))
+	ch <- prometheus.MustNewConstMetric(c.staleConns, prometheus.CounterValue, float64(stats.StaleConns))
+}
+
+// breakerCollector exports the breaker state and the buffered writes of a resilient database on every scrape
+type breakerCollector struct {
+	database       *resilientDatabase
+	state          *prometheus.Desc
+	bufferedWrites *prometheus.Desc
+}
+
+// NewBreakerCollector returns a prometheus collector of the breaker of database
+func NewBreakerCollector(database *resilientDatabase) prometheus.Collector {
+	return &breakerCollector{
+		database:       database,
+		state:          prometheus.NewDesc("redis_breaker_state", "Current state of the redis circuit breaker, 1 for the state it is in.", []string{"state"}, nil),
+		bufferedWrites: prometheus.NewDesc("redis_breaker_buffered_writes", "Number of videos with writes buffered while the breaker is open.", nil, nil),
+	}
+}
+
+func (c *breakerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.state
+	ch <- c.bufferedWrites
+}
+
+func (c *breakerCollector) Collect(ch chan<- prometheus.Metric) {
+	current := c.database.State()
+	for _, state := range []gobreaker.State{gobreaker.StateClosed, gobreaker.StateHalfOpen, gobreaker.StateOpen} {
+		value := 0.0
+		if state.String() == current {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.state, prometheus.GaugeValue, value, state.String())
+	}
+	ch <- prometheus.MustNewConstMetric(c.bufferedWrites, prometheus.GaugeValue, float64(c.database.BufferedWrites()))
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPoolStatsCollector(t *testing.T) {
+	addr := newRedisServer(t, func(args []string) string {
+		return "+PONG\r\n"
+	})
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	//the first ping dials a connection, the second one reuses it
+	for i := 0; i < 2; i++ {
+		if err := client.Ping(context.Background()).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := `
+# HELP redis_pool_hits_total Number of times a free connection was found in the pool.
+# TYPE redis_pool_hits_total counter
+redis_pool_hits_total 1
+# HELP redis_pool_misses_total Number of times a free connection was not found in the pool.
+# TYPE redis_pool_misses_total counter
+redis_pool_misses_total 1
+# HELP redis_pool_timeouts_total Number of times a wait for a connection timed out.
+# TYPE redis_pool_timeouts_total counter
+redis_pool_timeouts_total 0
+# HELP redis_pool_total_connections Number of connections in the pool.
+# TYPE redis_pool_total_connections gauge
+redis_pool_total_connections 1
+# HELP redis_pool_idle_connections Number of idle connections in the pool.
+# TYPE redis_pool_idle_connections gauge
+redis_pool_idle_connections 1
+# HELP redis_pool_stale_connections_total Number of stale connections removed from the pool.
+# TYPE redis_pool_stale_connections_total counter
+redis_pool_stale_connections_total 0
+`
+	if err := testutil.CollectAndCompare(NewPoolStatsCollector(client), strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
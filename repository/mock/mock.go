@@ -5,7 +5,9 @@
 package mock_database
 
 import (
+	context "context"
 	reflect "reflect"
+	time "time"
 	model "youtube_service/model"
 
 	gomock "github.com/golang/mock/gomock"
@@ -35,73 +37,232 @@ func (m *MockDatabase) EXPECT() *MockDatabaseMockRecorder {
 }
 
 // CheckDBHealth mocks base method.
-func (m *MockDatabase) CheckDBHealth() bool {
+func (m *MockDatabase) CheckDBHealth(ctx context.Context) bool {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CheckDBHealth")
+	ret := m.ctrl.Call(m, "CheckDBHealth", ctx)
 	ret0, _ := ret[0].(bool)
 	return ret0
 }
 
 // CheckDBHealth indicates an expected call of CheckDBHealth.
-func (mr *MockDatabaseMockRecorder) CheckDBHealth() *gomock.Call {
+func (mr *MockDatabaseMockRecorder) CheckDBHealth(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckDBHealth", reflect.TypeOf((*MockDatabase)(nil).CheckDBHealth))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckDBHealth", reflect.TypeOf((*MockDatabase)(nil).CheckDBHealth), ctx)
+}
+
+// Claim mocks base method.
+func (m *MockDatabase) Claim(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Claim", ctx, name, ttl)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Claim indicates an expected call of Claim.
+func (mr *MockDatabaseMockRecorder) Claim(ctx, name, ttl interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Claim", reflect.TypeOf((*MockDatabase)(nil).Claim), ctx, name, ttl)
+}
+
+// GetLastSnapshots mocks base method.
+func (m *MockDatabase) GetLastSnapshots(ctx context.Context, window string) ([]model.Snapshot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLastSnapshots", ctx, window)
+	ret0, _ := ret[0].([]model.Snapshot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLastSnapshots indicates an expected call of GetLastSnapshots.
+func (mr *MockDatabaseMockRecorder) GetLastSnapshots(ctx, window interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastSnapshots", reflect.TypeOf((*MockDatabase)(nil).GetLastSnapshots), ctx, window)
+}
+
+// GetRollingRecords mocks base method.
+func (m *MockDatabase) GetRollingRecords(ctx context.Context, window string, n int) ([]model.ResultRedis, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRollingRecords", ctx, window, n)
+	ret0, _ := ret[0].([]model.ResultRedis)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRollingRecords indicates an expected call of GetRollingRecords.
+func (mr *MockDatabaseMockRecorder) GetRollingRecords(ctx, window, n interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRollingRecords", reflect.TypeOf((*MockDatabase)(nil).GetRollingRecords), ctx, window, n)
 }
 
 // GetScore mocks base method.
-func (m *MockDatabase) GetScore(member string) (float64, error) {
+func (m *MockDatabase) GetScore(ctx context.Context, member string) (float64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetScore", member)
+	ret := m.ctrl.Call(m, "GetScore", ctx, member)
 	ret0, _ := ret[0].(float64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetScore indicates an expected call of GetScore.
-func (mr *MockDatabaseMockRecorder) GetScore(member interface{}) *gomock.Call {
+func (mr *MockDatabaseMockRecorder) GetScore(ctx, member interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetScore", reflect.TypeOf((*MockDatabase)(nil).GetScore), ctx, member)
+}
+
+// GetScoreHistory mocks base method.
+func (m *MockDatabase) GetScoreHistory(ctx context.Context, member string, buckets []time.Time, hourly bool) ([]float64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetScoreHistory", ctx, member, buckets, hourly)
+	ret0, _ := ret[0].([]float64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetScoreHistory indicates an expected call of GetScoreHistory.
+func (mr *MockDatabaseMockRecorder) GetScoreHistory(ctx, member, buckets, hourly interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetScore", reflect.TypeOf((*MockDatabase)(nil).GetScore), member)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetScoreHistory", reflect.TypeOf((*MockDatabase)(nil).GetScoreHistory), ctx, member, buckets, hourly)
+}
+
+// GetScoresAndRanks mocks base method.
+func (m *MockDatabase) GetScoresAndRanks(ctx context.Context, members []string, window string) ([]model.VideoStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetScoresAndRanks", ctx, members, window)
+	ret0, _ := ret[0].([]model.VideoStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetScoresAndRanks indicates an expected call of GetScoresAndRanks.
+func (mr *MockDatabaseMockRecorder) GetScoresAndRanks(ctx, members, window interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetScoresAndRanks", reflect.TypeOf((*MockDatabase)(nil).GetScoresAndRanks), ctx, members, window)
 }
 
 // GetSortedRecords mocks base method.
-func (m *MockDatabase) GetSortedRecords(n int, ifLifeTime bool) ([]model.ResultRedis, error) {
+func (m *MockDatabase) GetSortedRecords(ctx context.Context, n int, ifLifeTime bool) ([]model.ResultRedis, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetSortedRecords", n, ifLifeTime)
+	ret := m.ctrl.Call(m, "GetSortedRecords", ctx, n, ifLifeTime)
 	ret0, _ := ret[0].([]model.ResultRedis)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetSortedRecords indicates an expected call of GetSortedRecords.
-func (mr *MockDatabaseMockRecorder) GetSortedRecords(n, ifLifeTime interface{}) *gomock.Call {
+func (mr *MockDatabaseMockRecorder) GetSortedRecords(ctx, n, ifLifeTime interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSortedRecords", reflect.TypeOf((*MockDatabase)(nil).GetSortedRecords), n, ifLifeTime)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSortedRecords", reflect.TypeOf((*MockDatabase)(nil).GetSortedRecords), ctx, n, ifLifeTime)
 }
 
 // IncreaseScore mocks base method.
-func (m *MockDatabase) IncreaseScore(videoName string, increaseBy float64) error {
+func (m *MockDatabase) IncreaseScore(ctx context.Context, videoName string, increaseBy float64) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "IncreaseScore", videoName, increaseBy)
+	ret := m.ctrl.Call(m, "IncreaseScore", ctx, videoName, increaseBy)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // IncreaseScore indicates an expected call of IncreaseScore.
-func (mr *MockDatabaseMockRecorder) IncreaseScore(videoName, increaseBy interface{}) *gomock.Call {
+func (mr *MockDatabaseMockRecorder) IncreaseScore(ctx, videoName, increaseBy interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncreaseScore", reflect.TypeOf((*MockDatabase)(nil).IncreaseScore), ctx, videoName, increaseBy)
+}
+
+// IncreaseScoreAt mocks base method.
+func (m *MockDatabase) IncreaseScoreAt(ctx context.Context, videoName string, increaseBy float64, at time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncreaseScoreAt", ctx, videoName, increaseBy, at)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// IncreaseScoreAt indicates an expected call of IncreaseScoreAt.
+func (mr *MockDatabaseMockRecorder) IncreaseScoreAt(ctx, videoName, increaseBy, at interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncreaseScore", reflect.TypeOf((*MockDatabase)(nil).IncreaseScore), videoName, increaseBy)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncreaseScoreAt", reflect.TypeOf((*MockDatabase)(nil).IncreaseScoreAt), ctx, videoName, increaseBy, at)
+}
+
+// RefreshRollingRecords mocks base method.
+func (m *MockDatabase) RefreshRollingRecords(ctx context.Context, window string, hours int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RefreshRollingRecords", ctx, window, hours)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RefreshRollingRecords indicates an expected call of RefreshRollingRecords.
+func (mr *MockDatabaseMockRecorder) RefreshRollingRecords(ctx, window, hours interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshRollingRecords", reflect.TypeOf((*MockDatabase)(nil).RefreshRollingRecords), ctx, window, hours)
+}
+
+// Release mocks base method.
+func (m *MockDatabase) Release(ctx context.Context, name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Release", ctx, name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Release indicates an expected call of Release.
+func (mr *MockDatabaseMockRecorder) Release(ctx, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Release", reflect.TypeOf((*MockDatabase)(nil).Release), ctx, name)
+}
+
+// SaveSnapshot mocks base method.
+func (m *MockDatabase) SaveSnapshot(ctx context.Context, snapshot model.Snapshot) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveSnapshot", ctx, snapshot)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveSnapshot indicates an expected call of SaveSnapshot.
+func (mr *MockDatabaseMockRecorder) SaveSnapshot(ctx, snapshot interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveSnapshot", reflect.TypeOf((*MockDatabase)(nil).SaveSnapshot), ctx, snapshot)
+}
+
+// ScanRecords mocks base method.
+func (m *MockDatabase) ScanRecords(ctx context.Context, isLifeTime bool, each func(model.ResultRedis) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ScanRecords", ctx, isLifeTime, each)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ScanRecords indicates an expected call of ScanRecords.
+func (mr *MockDatabaseMockRecorder) ScanRecords(ctx, isLifeTime, each interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ScanRecords", reflect.TypeOf((*MockDatabase)(nil).ScanRecords), ctx, isLifeTime, each)
 }
 
 // Set mocks base method.
-func (m *MockDatabase) Set(member string, score float64) error {
+func (m *MockDatabase) Set(ctx context.Context, member string, score float64) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Set", member, score)
+	ret := m.ctrl.Call(m, "Set", ctx, member, score)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Set indicates an expected call of Set.
-func (mr *MockDatabaseMockRecorder) Set(member, score interface{}) *gomock.Call {
+func (mr *MockDatabaseMockRecorder) Set(ctx, member, score interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockDatabase)(nil).Set), ctx, member, score)
+}
+
+// SetScores mocks base method.
+func (m *MockDatabase) SetScores(ctx context.Context, records []model.ViewRecord) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetScores", ctx, records)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetScores indicates an expected call of SetScores.
+func (mr *MockDatabaseMockRecorder) SetScores(ctx, records interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockDatabase)(nil).Set), member, score)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetScores", reflect.TypeOf((*MockDatabase)(nil).SetScores), ctx, records)
 }
@@ -2,33 +2,69 @@ package database
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"strconv"
 	"time"
 	model "youtube_service/model"
 
 	"github.com/go-redis/redis/v8"
 )
 
-var ctx = context.Background()
 var ErrUnknown = errors.New("not found")
+var ErrHourlyBucketsDisabled = errors.New("hourly buckets are not enabled")
 
 type redisCache struct {
-	client *redis.Client
-	prefix string
+	client        *redis.Client
+	prefix        string
+	hourlyBuckets bool
 }
 
-func (*redisCache) getTodayKey(key string) string {
-	return key + time.Now().Local().Format("2023-06-01")
+const (
+	// layout used for the suffix of the per-day keys
+	dayKeyLayout = "2006-01-02"
+	// layout used for the suffix of the per-hour keys
+	hourKeyLayout = "2006-01-02T15"
+	// number of members asked for in every ZSCAN call
+	scanPageSize = 500
+	// per-hour keys are only kept for this long
+	hourKeyTTL = 31 * 24 * time.Hour
+)
+
+func (r *redisCache) getTodayKey(key string) string {
+	return r.getDayKey(key, time.Now().Local())
+}
+
+// getDayKey returns the key of the sorted set holding the views of the given day
+func (*redisCache) getDayKey(key string, day time.Time) string {
+	return key + day.Format(dayKeyLayout)
+}
+
+// getRollingKey returns the key where the union of the hourly buckets of a rolling window is stored
+func (*redisCache) getRollingKey(key string, window string) string {
+	return key + ":rolling:" + window
 }
 
-func NewRedis(client *redis.Client, key string) *redisCache {
+// getSnapshotKey returns the key of the list holding the last snapshots of a window, newest first
+func (*redisCache) getSnapshotKey(key string, window string) string {
+	return key + ":snapshots:" + window
+}
+
+// getHourKey returns the key of the sorted set holding the views of the given hour
+func (*redisCache) getHourKey(key string, hour time.Time) string {
+	return key + hour.Format(hourKeyLayout)
+}
+
+// NewRedis returns a redis backed Database, with hourlyBuckets the views are also counted per hour
+func NewRedis(client *redis.Client, key string, hourlyBuckets bool) *redisCache {
 	return &redisCache{
-		client: client,
-		prefix: key,
+		client:        client,
+		prefix:        key,
+		hourlyBuckets: hourlyBuckets,
 	}
 }
 
-func (r *redisCache) CheckDBHealth() bool {
+func (r *redisCache) CheckDBHealth(ctx context.Context) bool {
 	// Ping the Redis server to check the connection
 	pong, err := r.client.Ping(ctx).Result()
 	if err != nil || pong != "PONG" {
@@ -38,7 +74,7 @@ func (r *redisCache) CheckDBHealth() bool {
 }
 
 // Getting videos in sorted order of their view count
-func (r *redisCache) GetSortedRecords(n int, isLifeTime bool) ([]model.ResultRedis, error) {
+func (r *redisCache) GetSortedRecords(ctx context.Context, n int, isLifeTime bool) ([]model.ResultRedis, error) {
 	var key string
 	//Extracting the key as per requirement
 	if isLifeTime {
@@ -46,8 +82,13 @@ func (r *redisCache) GetSortedRecords(n int, isLifeTime bool) ([]model.ResultRed
 	} else {
 		key = r.getTodayKey(r.prefix)
 	}
+	return r.getSortedRecordsByKey(ctx, key, n)
+}
+
+// getting the top n members of any sorted set
+func (r *redisCache) getSortedRecordsByKey(ctx context.Context, key string, n int) ([]model.ResultRedis, error) {
 	//Getting the videos sorted by view count from database
-	redisResponse := r.client.ZRevRangeWithScores(ctx, key, 0, int64(n))
+	redisResponse := r.client.ZRevRangeWithScores(ctx, key, 0, int64(n-1))
 	responseArray, err := redisResponse.Result()
 	if err != nil {
 		return nil, err
@@ -64,19 +105,32 @@ func (r *redisCache) GetSortedRecords(n int, isLifeTime bool) ([]model.ResultRed
 }
 
 // Increasing the viewcount of the video by increasing it's score
-func (r *redisCache) IncreaseScore(videoName string, increaseBy float64) (err error) {
-	for _, key := range []string{r.prefix, r.getTodayKey(r.prefix)} {
+func (r *redisCache) IncreaseScore(ctx context.Context, videoName string, increaseBy float64) (err error) {
+	return r.IncreaseScoreAt(ctx, videoName, increaseBy, time.Now())
+}
+
+func (r *redisCache) IncreaseScoreAt(ctx context.Context, videoName string, increaseBy float64, at time.Time) (err error) {
+	for _, key := range []string{r.prefix, r.getDayKey(r.prefix, at.Local())} {
 		_, err := r.client.ZIncrBy(ctx, key, increaseBy, videoName).Result()
 
 		if err != nil {
 			return err
 		}
 	}
+	if r.hourlyBuckets {
+		key := r.getHourKey(r.prefix, at.Local())
+		pipe := r.client.Pipeline()
+		pipe.ZIncrBy(ctx, key, increaseBy, videoName)
+		pipe.Expire(ctx, key, hourKeyTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // adding a new member score pair in database
-func (r *redisCache) Set(member string, score float64) (err error) {
+func (r *redisCache) Set(ctx context.Context, member string, score float64) (err error) {
 	_, err = r.client.ZAdd(ctx, r.prefix, &redis.Z{
 		Score:  score,
 		Member: member,
@@ -86,11 +140,209 @@ func (r *redisCache) Set(member string, score float64) (err error) {
 }
 
 // To get the views of a particular video
-func (r *redisCache) GetScore(videoName string) (response float64, err error) {
+func (r *redisCache) GetScore(ctx context.Context, videoName string) (response float64, err error) {
 	key := r.prefix
 	response, err = r.client.ZScore(ctx, key, videoName).Result()
-	if err != nil {
-		return response, err
+	if err == redis.Nil {
+		return 0, ErrUnknown
 	}
 	return response, err
 }
+
+// the score of a day is set and the lifetime score moves by the difference, so importing a day again does not count it twice
+var setDayScoreScript = redis.NewScript(`
+local previous = tonumber(redis.call('ZSCORE', KEYS[1], ARGV[2])) or 0
+redis.call('ZADD', KEYS[1], ARGV[1], ARGV[2])
+return redis.call('ZINCRBY', KEYS[2], tonumber(ARGV[1]) - previous, ARGV[2])
+`)
+
+// SetScores writes a batch of records in a single pipeline, a record with a date
+// sets the score of that day and adds the change to the lifetime score, a record
+// without a date sets the lifetime score
+func (r *redisCache) SetScores(ctx context.Context, records []model.ViewRecord) error {
+	pipe := r.client.Pipeline()
+	for _, record := range records {
+		if !record.Date.IsZero() {
+			//EVAL and not EVALSHA, a pipeline cannot load the script again after a NOSCRIPT
+			setDayScoreScript.Eval(ctx, pipe, []string{r.getDayKey(r.prefix, record.Date), r.prefix}, record.Views, record.VideoID)
+			continue
+		}
+		pipe.ZAdd(ctx, r.prefix, &redis.Z{
+			Score:  float64(record.Views),
+			Member: record.VideoID,
+		})
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// ScanRecords walks every video of a leaderboard with ZSCAN, so the whole set is never loaded at once,
+// the records come in no particular order
+func (r *redisCache) ScanRecords(ctx context.Context, isLifeTime bool, each func(model.ResultRedis) error) error {
+	key := r.prefix
+	if !isLifeTime {
+		key = r.getTodayKey(r.prefix)
+	}
+	var cursor uint64
+	for {
+		//ZSCAN replies with member, score pairs
+		page, next, err := r.client.ZScan(ctx, key, cursor, "", scanPageSize).Result()
+		if err != nil {
+			return err
+		}
+		for i := 0; i+1 < len(page); i += 2 {
+			score, err := strconv.ParseFloat(page[i+1], 64)
+			if err != nil {
+				return err
+			}
+			if err := each(model.ResultRedis{VideoID: page[i], ViewCount: int(score)}); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// GetScoresAndRanks returns the lifetime views of the members and their rank in window, "lifetime", "today"
+// or a rolling window as of its last refresh, with one pipeline. The unknown members are left out.
+func (r *redisCache) GetScoresAndRanks(ctx context.Context, members []string, window string) ([]model.VideoStats, error) {
+	key := r.prefix
+	switch window {
+	case "lifetime":
+	case "today":
+		key = r.getTodayKey(r.prefix)
+	default:
+		if !r.hourlyBuckets {
+			return nil, ErrHourlyBucketsDisabled
+		}
+		key = r.getRollingKey(r.prefix, window)
+	}
+	pipe := r.client.Pipeline()
+	scores := make([]*redis.FloatCmd, len(members))
+	ranks := make([]*redis.IntCmd, len(members))
+	for i, member := range members {
+		scores[i] = pipe.ZScore(ctx, r.prefix, member)
+		ranks[i] = pipe.ZRevRank(ctx, key, member)
+	}
+	//a missing member or rank replies with redis.Nil
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	stats := make([]model.VideoStats, 0, len(members))
+	for i, member := range members {
+		score, err := scores[i].Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		rank, err := ranks[i].Result()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		if err == nil {
+			rank++
+		}
+		stats = append(stats, model.VideoStats{VideoID: member, ViewCount: int(score), Rank: int(rank)})
+	}
+	return stats, nil
+}
+
+// GetScoreHistory returns the views of a video in every given day or hour bucket,
+// buckets without any views count as zero
+func (r *redisCache) GetScoreHistory(ctx context.Context, member string, buckets []time.Time, hourly bool) ([]float64, error) {
+	if hourly && !r.hourlyBuckets {
+		return nil, ErrHourlyBucketsDisabled
+	}
+	pipe := r.client.Pipeline()
+	commands := make([]*redis.FloatCmd, len(buckets))
+	for i, bucket := range buckets {
+		key := r.getDayKey(r.prefix, bucket)
+		if hourly {
+			key = r.getHourKey(r.prefix, bucket)
+		}
+		commands[i] = pipe.ZScore(ctx, key, member)
+	}
+	//a missing member replies with redis.Nil which is only a zero here
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	scores := make([]float64, len(buckets))
+	for i, command := range commands {
+		score, err := command.Result()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		scores[i] = score
+	}
+	return scores, nil
+}
+
+// RefreshRollingRecords stores the union of the last hours hourly buckets, the current one included,
+// under the key of the rolling window so it can be read with a single ZREVRANGE
+func (r *redisCache) RefreshRollingRecords(ctx context.Context, window string, hours int) error {
+	if !r.hourlyBuckets {
+		return ErrHourlyBucketsDisabled
+	}
+	now := time.Now().Local()
+	keys := make([]string, hours)
+	for i := range keys {
+		keys[i] = r.getHourKey(r.prefix, now.Add(-time.Duration(i)*time.Hour))
+	}
+	return r.client.ZUnionStore(ctx, r.getRollingKey(r.prefix, window), &redis.ZStore{Keys: keys}).Err()
+}
+
+// GetRollingRecords returns the top n videos of a rolling window as of its last refresh
+func (r *redisCache) GetRollingRecords(ctx context.Context, window string, n int) ([]model.ResultRedis, error) {
+	if !r.hourlyBuckets {
+		return nil, ErrHourlyBucketsDisabled
+	}
+	return r.getSortedRecordsByKey(ctx, r.getRollingKey(r.prefix, window), n)
+}
+
+// SaveSnapshot pushes a snapshot of a window, only the two newest ones are kept
+func (r *redisCache) SaveSnapshot(ctx context.Context, snapshot model.Snapshot) error {
+	value, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	key := r.getSnapshotKey(r.prefix, snapshot.Window)
+	pipe := r.client.TxPipeline()
+	pipe.LPush(ctx, key, value)
+	pipe.LTrim(ctx, key, 0, 1)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// getClaimKey returns the key taken by a claim of name
+func (*redisCache) getClaimKey(key string, name string) string {
+	return key + ":claims:" + name
+}
+
+// Claim sets the key of name with SETNX, it expires after ttl
+func (r *redisCache) Claim(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, r.getClaimKey(r.prefix, name), 1, ttl).Result()
+}
+
+func (r *redisCache) Release(ctx context.Context, name string) error {
+	return r.client.Del(ctx, r.getClaimKey(r.prefix, name)).Err()
+}
+
+// GetLastSnapshots returns up to two snapshots of a window, newest first
+func (r *redisCache) GetLastSnapshots(ctx context.Context, window string) ([]model.Snapshot, error) {
+	values, err := r.client.LRange(ctx, r.getSnapshotKey(r.prefix, window), 0, 1).Result()
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make([]model.Snapshot, len(values))
+	for i, value := range values {
+		if err := json.Unmarshal([]byte(value), &snapshots[i]); err != nil {
+			return nil, err
+		}
+	}
+	return snapshots, nil
+}
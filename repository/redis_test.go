@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	model "youtube_service/model"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestRedisCache_SetScores(t *testing.T) {
+	var mu sync.Mutex
+	var commands [][]string
+	addr := newRedisServer(t, func(args []string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		switch strings.ToUpper(args[0]) {
+		case "EVAL":
+			//the script body is left out
+			commands = append(commands, append([]string{"EVAL"}, args[2:]...))
+			return ":5\r\n"
+		case "ZADD":
+			commands = append(commands, args)
+			return ":1\r\n"
+		}
+		return "+OK\r\n"
+	})
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	day := time.Date(2023, 6, 1, 0, 0, 0, 0, time.Local)
+
+	err := NewRedis(client, "videos", false).SetScores(context.Background(), []model.ViewRecord{
+		{VideoID: "video1", Views: 5, Date: day},
+		{VideoID: "video2", Views: 7},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the dated row goes to the day and the lifetime keys
+	want := [][]string{
+		{"EVAL", "2", "videos2023-06-01", "videos", "5", "video1"},
+		{"zadd", "videos", "7", "video2"},
+	}
+	if !reflect.DeepEqual(commands, want) {
+		t.Errorf("commands = %q, want %q", commands, want)
+	}
+}
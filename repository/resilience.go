@@ -0,0 +1,388 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+	model "youtube_service/model"
+
+	"github.com/sony/gobreaker"
+)
+
+var ErrUnavailable = errors.New("redis is unavailable")
+var ErrWriteBufferFull = errors.New("write buffer is full")
+
+// health statuses, degraded is when the breaker is not closed and redis is only partly used
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+)
+
+// ResilienceOptions configures the timeouts and the breaker around a Database
+type ResilienceOptions struct {
+	// Timeout of every call except the scans, which last as long as their caller
+	Timeout time.Duration
+	// MaxFailures in a row opening the breaker
+	MaxFailures uint32
+	// OpenTimeout is how long the breaker stays open before letting a call through
+	OpenTimeout time.Duration
+	// BufferSize is the number of videos whose writes are kept while the breaker is open
+	BufferSize int
+}
+
+type resilientDatabase struct {
+	Database
+	breaker *gobreaker.CircuitBreaker
+	opts    ResilienceOptions
+
+	mu sync.Mutex
+	// last leaderboard read of every window, served while redis is unavailable
+	leaderboards map[string]cachedLeaderboard
+	// writes rejected by the open breaker, replayed once it closes, the increments of every video
+	// are kept by the hour they were made in so they land in the buckets of that hour
+	pendingSets       map[string]float64
+	pendingIncrements map[string]map[time.Time]float64
+	flushing          bool
+}
+
+// NewResilientDatabase wraps next with timeouts and a circuit breaker, while the breaker is open the
+// leaderboards are read from the last results and the view counts and new videos are buffered
+func NewResilientDatabase(next Database, opts ResilienceOptions) *resilientDatabase {
+	r := &resilientDatabase{
+		Database:          next,
+		opts:              opts,
+		leaderboards:      map[string]cachedLeaderboard{},
+		pendingSets:       map[string]float64{},
+		pendingIncrements: map[string]map[time.Time]float64{},
+	}
+	r.breaker = gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		Name:    "redis",
+		Timeout: opts.OpenTimeout,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures >= opts.MaxFailures
+		},
+		OnStateChange: func(_ string, _, to gobreaker.State) {
+			if to == gobreaker.StateClosed {
+				r.startFlush()
+			}
+		},
+		IsSuccessful: isSuccessful,
+	})
+	return r
+}
+
+// isSuccessful tells the breaker which errors are not a sign of redis being unavailable
+func isSuccessful(err error) bool {
+	return err == nil ||
+		errors.Is(err, ErrUnknown) ||
+		errors.Is(err, ErrHourlyBucketsDisabled) ||
+		errors.Is(err, context.Canceled)
+}
+
+// rejected is true when the breaker refused the call, so it never reached redis
+func rejected(err error) bool {
+	return err == ErrUnavailable
+}
+
+// call runs fn through the breaker with the call timeout, the calls refused by the breaker return ErrUnavailable
+func (r *resilientDatabase) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	_, err := r.breaker.Execute(func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+		defer cancel()
+		return nil, fn(ctx)
+	})
+	if err == nil && r.breaker.State() == gobreaker.StateClosed {
+		r.startFlush()
+	}
+	return breakerError(err)
+}
+
+func breakerError(err error) error {
+	if errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests) {
+		return ErrUnavailable
+	}
+	return err
+}
+
+// State is the state of the breaker, "closed", "half-open" or "open"
+func (r *resilientDatabase) State() string {
+	return r.breaker.State().String()
+}
+
+// BufferedWrites is the number of videos with writes waiting for redis
+func (r *resilientDatabase) BufferedWrites() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.buffered()
+}
+
+func (r *resilientDatabase) buffered() int {
+	n := len(r.pendingIncrements)
+	for member := range r.pendingSets {
+		if _, ok := r.pendingIncrements[member]; !ok {
+			n++
+		}
+	}
+	return n
+}
+
+// Health pings redis past the breaker and reports the state of both
+func (r *resilientDatabase) Health(ctx context.Context) model.Health {
+	health := model.Health{
+		Redis:          r.CheckDBHealth(ctx),
+		Breaker:        r.State(),
+		BufferedWrites: r.BufferedWrites(),
+	}
+	switch {
+	case !health.Redis && health.Breaker == gobreaker.StateOpen.String():
+		health.Status = HealthDown
+	case !health.Redis || health.Breaker != gobreaker.StateClosed.String():
+		health.Status = HealthDegraded
+	default:
+		health.Status = HealthOK
+	}
+	return health
+}
+
+func (r *resilientDatabase) CheckDBHealth(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+	defer cancel()
+	return r.Database.CheckDBHealth(ctx)
+}
+
+func (r *resilientDatabase) Set(ctx context.Context, member string, score float64) error {
+	err := r.call(ctx, func(ctx context.Context) error {
+		return r.Database.Set(ctx, member, score)
+	})
+	if rejected(err) {
+		return r.buffer(func() {
+			r.pendingSets[member] = score
+			delete(r.pendingIncrements, member)
+		}, member)
+	}
+	return err
+}
+
+func (r *resilientDatabase) IncreaseScore(ctx context.Context, videoName string, increaseBy float64) error {
+	return r.IncreaseScoreAt(ctx, videoName, increaseBy, time.Now())
+}
+
+func (r *resilientDatabase) IncreaseScoreAt(ctx context.Context, videoName string, increaseBy float64, at time.Time) error {
+	err := r.call(ctx, func(ctx context.Context) error {
+		return r.Database.IncreaseScoreAt(ctx, videoName, increaseBy, at)
+	})
+	if rejected(err) {
+		return r.buffer(func() {
+			addIncrement(r.pendingIncrements, videoName, localHour(at), increaseBy)
+		}, videoName)
+	}
+	return err
+}
+
+// localHour is the start of the local hour of at, the day and hour keys are local and Truncate would
+// cut the absolute time, which is off by the half hour of the zones like +05:30
+func localHour(at time.Time) time.Time {
+	at = at.Local()
+	return time.Date(at.Year(), at.Month(), at.Day(), at.Hour(), 0, 0, 0, at.Location())
+}
+
+func addIncrement(increments map[string]map[time.Time]float64, member string, hour time.Time, increaseBy float64) {
+	if increments[member] == nil {
+		increments[member] = map[time.Time]float64{}
+	}
+	increments[member][hour] += increaseBy
+}
+
+// buffer applies a write to the pending ones when there is room for member
+func (r *resilientDatabase) buffer(write func(), member string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, set := r.pendingSets[member]
+	_, increment := r.pendingIncrements[member]
+	if !set && !increment && r.buffered() >= r.opts.BufferSize {
+		return ErrWriteBufferFull
+	}
+	write()
+	return nil
+}
+
+// startFlush replays the buffered writes in the background unless it is already done
+func (r *resilientDatabase) startFlush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.flushing || r.buffered() == 0 {
+		return
+	}
+	r.flushing = true
+	go r.flush()
+}
+
+// flush replays the buffered writes, the sets go first since they reset the increments made before them
+func (r *resilientDatabase) flush() {
+	r.mu.Lock()
+	sets, increments := r.pendingSets, r.pendingIncrements
+	r.pendingSets, r.pendingIncrements = map[string]float64{}, map[string]map[time.Time]float64{}
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.flushing = false
+		r.mu.Unlock()
+	}()
+
+	ctx := context.Background()
+	for member, score := range sets {
+		if err := r.call(ctx, func(ctx context.Context) error {
+			return r.Database.Set(ctx, member, score)
+		}); err != nil {
+			r.requeue(sets, increments)
+			return
+		}
+		delete(sets, member)
+	}
+	for member, hours := range increments {
+		for hour, increaseBy := range hours {
+			if err := r.call(ctx, func(ctx context.Context) error {
+				return r.Database.IncreaseScoreAt(ctx, member, increaseBy, hour)
+			}); err != nil {
+				r.requeue(sets, increments)
+				return
+			}
+			delete(hours, hour)
+		}
+		delete(increments, member)
+	}
+}
+
+// requeue puts back the writes which were not flushed in front of the ones buffered meanwhile
+func (r *resilientDatabase) requeue(sets map[string]float64, increments map[string]map[time.Time]float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for member, hours := range r.pendingIncrements {
+		for hour, increaseBy := range hours {
+			addIncrement(increments, member, hour, increaseBy)
+		}
+	}
+	for member, score := range r.pendingSets {
+		sets[member] = score
+		delete(increments, member)
+	}
+	r.pendingSets, r.pendingIncrements = sets, increments
+}
+
+func (r *resilientDatabase) GetScore(ctx context.Context, member string) (response float64, err error) {
+	err = r.call(ctx, func(ctx context.Context) error {
+		response, err = r.Database.GetScore(ctx, member)
+		return err
+	})
+	return response, err
+}
+
+func (r *resilientDatabase) GetSortedRecords(ctx context.Context, n int, ifLifeTime bool) (records []model.ResultRedis, err error) {
+	window := "today"
+	if ifLifeTime {
+		window = "lifetime"
+	}
+	err = r.call(ctx, func(ctx context.Context) error {
+		records, err = r.Database.GetSortedRecords(ctx, n, ifLifeTime)
+		return err
+	})
+	return r.leaderboard(window, n, records, err)
+}
+
+func (r *resilientDatabase) GetRollingRecords(ctx context.Context, window string, n int) (records []model.ResultRedis, err error) {
+	err = r.call(ctx, func(ctx context.Context) error {
+		records, err = r.Database.GetRollingRecords(ctx, window, n)
+		return err
+	})
+	return r.leaderboard(window, n, records, err)
+}
+
+// cachedLeaderboard is the last leaderboard read of a window with the limit it was read with
+type cachedLeaderboard struct {
+	n       int
+	records []model.ResultRedis
+}
+
+// leaderboard keeps a fresh leaderboard of window or falls back to the last one when redis is unavailable,
+// a leaderboard cut by a smaller limit than n is not served as it may be missing some of the top n
+func (r *resilientDatabase) leaderboard(window string, n int, records []model.ResultRedis, err error) ([]model.ResultRedis, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		r.leaderboards[window] = cachedLeaderboard{n: n, records: records}
+		return records, nil
+	}
+	cached, ok := r.leaderboards[window]
+	if isSuccessful(err) || !ok || cached.n < n && len(cached.records) >= cached.n {
+		return nil, err
+	}
+	if len(cached.records) > n {
+		return cached.records[:n], nil
+	}
+	return cached.records, nil
+}
+
+func (r *resilientDatabase) SetScores(ctx context.Context, records []model.ViewRecord) error {
+	return r.call(ctx, func(ctx context.Context) error {
+		return r.Database.SetScores(ctx, records)
+	})
+}
+
+func (r *resilientDatabase) ScanRecords(ctx context.Context, isLifeTime bool, each func(model.ResultRedis) error) error {
+	_, err := r.breaker.Execute(func() (interface{}, error) {
+		return nil, r.Database.ScanRecords(ctx, isLifeTime, each)
+	})
+	return breakerError(err)
+}
+
+func (r *resilientDatabase) GetScoresAndRanks(ctx context.Context, members []string, window string) (stats []model.VideoStats, err error) {
+	err = r.call(ctx, func(ctx context.Context) error {
+		stats, err = r.Database.GetScoresAndRanks(ctx, members, window)
+		return err
+	})
+	return stats, err
+}
+
+func (r *resilientDatabase) GetScoreHistory(ctx context.Context, member string, buckets []time.Time, hourly bool) (scores []float64, err error) {
+	err = r.call(ctx, func(ctx context.Context) error {
+		scores, err = r.Database.GetScoreHistory(ctx, member, buckets, hourly)
+		return err
+	})
+	return scores, err
+}
+
+func (r *resilientDatabase) RefreshRollingRecords(ctx context.Context, window string, hours int) error {
+	return r.call(ctx, func(ctx context.Context) error {
+		return r.Database.RefreshRollingRecords(ctx, window, hours)
+	})
+}
+
+func (r *resilientDatabase) SaveSnapshot(ctx context.Context, snapshot model.Snapshot) error {
+	return r.call(ctx, func(ctx context.Context) error {
+		return r.Database.SaveSnapshot(ctx, snapshot)
+	})
+}
+
+func (r *resilientDatabase) Claim(ctx context.Context, name string, ttl time.Duration) (claimed bool, err error) {
+	err = r.call(ctx, func(ctx context.Context) error {
+		claimed, err = r.Database.Claim(ctx, name, ttl)
+		return err
+	})
+	return claimed, err
+}
+
+func (r *resilientDatabase) Release(ctx context.Context, name string) error {
+	return r.call(ctx, func(ctx context.Context) error {
+		return r.Database.Release(ctx, name)
+	})
+}
+
+func (r *resilientDatabase) GetLastSnapshots(ctx context.Context, window string) (snapshots []model.Snapshot, err error) {
+	err = r.call(ctx, func(ctx context.Context) error {
+		snapshots, err = r.Database.GetLastSnapshots(ctx, window)
+		return err
+	})
+	return snapshots, err
+}
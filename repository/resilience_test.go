@@ -0,0 +1,196 @@
+package database
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	model "youtube_service/model"
+	mockDb "youtube_service/repository/mock"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/golang/mock/gomock"
+)
+
+func TestResilientDatabase(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	errDown := errors.New("connection refused")
+	top := []model.ResultRedis{{VideoID: "video1", ViewCount: 9}, {VideoID: "video2", ViewCount: 4}}
+	yesterday := localHour(time.Now().Add(-24 * time.Hour))
+	today := localHour(time.Now())
+
+	gomock.InOrder(
+		newMockDB.EXPECT().GetSortedRecords(gomock.Any(), 2, true).Return(top, nil),
+		newMockDB.EXPECT().GetScore(gomock.Any(), "video3").Return(float64(0), ErrUnknown),
+		newMockDB.EXPECT().IncreaseScoreAt(gomock.Any(), "video1", float64(1), gomock.Any()).Return(errDown),
+		newMockDB.EXPECT().GetSortedRecords(gomock.Any(), 1, true).Return(nil, errDown),
+		newMockDB.EXPECT().Set(gomock.Any(), "video3", float64(0)).Return(nil),
+	)
+	//the buffered increments are replayed in the hours they were made in
+	newMockDB.EXPECT().IncreaseScoreAt(gomock.Any(), "video1", float64(2), today).Return(nil)
+	newMockDB.EXPECT().IncreaseScoreAt(gomock.Any(), "video1", float64(1), yesterday).Return(nil)
+	r := NewResilientDatabase(newMockDB, ResilienceOptions{
+		Timeout:     time.Second,
+		MaxFailures: 2,
+		OpenTimeout: 50 * time.Millisecond,
+		BufferSize:  2,
+	})
+	ctx := context.Background()
+
+	if got, err := r.GetSortedRecords(ctx, 2, true); err != nil || !reflect.DeepEqual(got, top) {
+		t.Fatalf("GetSortedRecords() = %v, %v", got, err)
+	}
+	if _, err := r.GetScore(ctx, "video3"); err != ErrUnknown {
+		t.Fatalf("GetScore() error = %v, want ErrUnknown", err)
+	}
+	if err := r.IncreaseScore(ctx, "video1", 1); err != errDown {
+		t.Fatalf("failing IncreaseScore() error = %v, want it returned", err)
+	}
+	if got, err := r.GetSortedRecords(ctx, 1, true); err != nil || !reflect.DeepEqual(got, top[:1]) {
+		t.Fatalf("cached GetSortedRecords() = %v, %v", got, err)
+	}
+	if r.State() != "open" {
+		t.Fatalf("State() = %q after two failures, want open", r.State())
+	}
+
+	if _, err := r.GetScore(ctx, "video1"); err != ErrUnavailable {
+		t.Errorf("open GetScore() error = %v, want ErrUnavailable", err)
+	}
+	if got, err := r.GetRollingRecords(ctx, "24h", 5); err != ErrUnavailable || got != nil {
+		t.Errorf("uncached GetRollingRecords() = %v, %v, want ErrUnavailable", got, err)
+	}
+	//the top 2 are cached, the top 5 may be missing some videos
+	if got, err := r.GetSortedRecords(ctx, 5, true); err != ErrUnavailable || got != nil {
+		t.Errorf("GetSortedRecords() over the cached limit = %v, %v, want ErrUnavailable", got, err)
+	}
+	for _, write := range []func() error{
+		func() error { return r.IncreaseScoreAt(ctx, "video1", 1, today.Add(time.Minute)) },
+		func() error { return r.IncreaseScoreAt(ctx, "video1", 1, today.Add(2*time.Minute)) },
+		func() error { return r.IncreaseScoreAt(ctx, "video1", 1, yesterday.Add(time.Minute)) },
+		func() error { return r.Set(ctx, "video3", 0) },
+	} {
+		if err := write(); err != nil {
+			t.Fatalf("buffered write error = %v", err)
+		}
+	}
+	if err := r.Set(ctx, "video4", 0); err != ErrWriteBufferFull {
+		t.Errorf("Set() over the buffer size error = %v, want ErrWriteBufferFull", err)
+	}
+	newMockDB.EXPECT().CheckDBHealth(gomock.Any()).Return(false)
+	if health := r.Health(ctx); health.Status != HealthDown || health.BufferedWrites != 2 {
+		t.Errorf("Health() = %+v", health)
+	}
+
+	//the first call after the open timeout closes the breaker and the buffer is replayed
+	newMockDB.EXPECT().CheckDBHealth(gomock.Any()).Return(true)
+	time.Sleep(60 * time.Millisecond)
+	newMockDB.EXPECT().GetScore(gomock.Any(), "video1").Return(float64(9), nil)
+	if _, err := r.GetScore(ctx, "video1"); err != nil {
+		t.Fatalf("half-open GetScore() error = %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for r.BufferedWrites() > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if health := r.Health(ctx); health.Status != HealthOK || health.BufferedWrites != 0 {
+		t.Errorf("Health() after the flush = %+v", health)
+	}
+}
+
+// newRedisServer is enough of a redis server for a client, every command is answered with the RESP
+// reply of its name and arguments
+func newRedisServer(t *testing.T, reply func(args []string) string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					var n int
+					if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil {
+						return
+					}
+					args := make([]string, n)
+					for i := range args {
+						var size int
+						if _, err := fmt.Fscanf(r, "$%d\r\n", &size); err != nil {
+							return
+						}
+						arg := make([]byte, size+2)
+						if _, err := io.ReadFull(r, arg); err != nil {
+							return
+						}
+						args[i] = string(arg[:size])
+					}
+					fmt.Fprint(conn, reply(args))
+				}
+			}()
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return listener.Addr().String()
+}
+
+func TestResilientDatabase_unknownVideos(t *testing.T) {
+	addr := newRedisServer(t, func(args []string) string {
+		if strings.ToUpper(args[0]) == "ZSCORE" {
+			//the nil bulk string of a missing member
+			return "$-1\r\n"
+		}
+		return "+OK\r\n"
+	})
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	r := NewResilientDatabase(NewRedis(client, "videos", false), ResilienceOptions{
+		Timeout:     time.Second,
+		MaxFailures: 2,
+		OpenTimeout: time.Minute,
+		BufferSize:  2,
+	})
+	for i := 0; i < 5; i++ {
+		if _, err := r.GetScore(context.Background(), "unknown"); err != ErrUnknown {
+			t.Fatalf("GetScore() error = %v, want ErrUnknown", err)
+		}
+	}
+	if r.State() != "closed" {
+		t.Errorf("State() = %q after unknown videos, want closed", r.State())
+	}
+}
+
+func TestLocalHour(t *testing.T) {
+	local := time.Local
+	defer func() { time.Local = local }()
+	time.Local = time.FixedZone("IST", 5*3600+1800)
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want string
+	}{
+		{name: "first half of the hour", at: time.Date(2026, 10, 19, 4, 40, 0, 0, time.UTC), want: "2026-10-19 10:00 +0530"},
+		{name: "second half of the hour", at: time.Date(2026, 10, 19, 5, 20, 0, 0, time.UTC), want: "2026-10-19 10:00 +0530"},
+		{name: "just after midnight", at: time.Date(2026, 10, 18, 18, 40, 0, 0, time.UTC), want: "2026-10-19 00:00 +0530"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := localHour(tt.at).Format("2006-01-02 15:04 -0700"); got != tt.want {
+				t.Errorf("localHour() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+	"youtube_service/audit"
+	"youtube_service/auth"
+	"youtube_service/logging"
+	model "youtube_service/model"
+	db "youtube_service/repository"
+
+	log1 "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+var ErrAuditDisabled = errors.New("audit log is not enabled")
+
+// entries returned by an audit query without a limit
+const defaultAuditLimit = 100
+
+func (s *service) GetAuditEntries(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, error) {
+	return nil, ErrAuditDisabled
+}
+
+type auditingService struct {
+	log            audit.Log
+	database       db.Database
+	viewSampleRate float64
+	sample         func() float64
+	logger         log1.Logger
+	Service
+}
+
+// NewAuditingService returns a Service recording every mutation in auditLog with the caller, the request id
+// and the views of the video read from database before and after it, only viewSampleRate of the views are recorded
+func NewAuditingService(auditLog audit.Log, database db.Database, viewSampleRate float64, logger log1.Logger, s Service) Service {
+	return &auditingService{
+		log:            auditLog,
+		database:       database,
+		viewSampleRate: viewSampleRate,
+		sample:         rand.Float64,
+		logger:         logger,
+		Service:        s,
+	}
+}
+
+// score returns the lifetime views of a video, zero when it is unknown or cannot be read
+func (s *auditingService) score(ctx context.Context, videoName string) float64 {
+	score, _ := s.database.GetScore(ctx, videoName)
+	return score
+}
+
+// record appends entry with the caller of ctx, a failed append is logged but does not fail the call
+func (s *auditingService) record(ctx context.Context, entry model.AuditEntry, err error) {
+	entry.Time = time.Now()
+	entry.RequestID = logging.RequestIDFromContext(ctx)
+	if principal, ok := auth.PrincipalFromContext(ctx); ok {
+		entry.Subject = principal.Subject
+	}
+	if err != nil {
+		entry.Err = err.Error()
+	}
+	if err := s.log.Append(ctx, entry); err != nil {
+		level.Error(logging.WithContext(ctx, s.logger)).Log("method", "audit", "audited", entry.Method, "err", err)
+	}
+}
+
+func (s *auditingService) ViewVideo(ctx context.Context, videoName string) error {
+	if s.sample() >= s.viewSampleRate {
+		return s.Service.ViewVideo(ctx, videoName)
+	}
+	before := s.score(ctx, videoName)
+	err := s.Service.ViewVideo(ctx, videoName)
+	s.record(ctx, model.AuditEntry{
+		Method:     "ViewVideo",
+		VideoID:    videoName,
+		Before:     before,
+		After:      s.score(ctx, videoName),
+		SampleRate: s.viewSampleRate,
+	}, err)
+	return err
+}
+
+func (s *auditingService) PostVideo(ctx context.Context, videoName string) error {
+	before := s.score(ctx, videoName)
+	err := s.Service.PostVideo(ctx, videoName)
+	s.record(ctx, model.AuditEntry{
+		Method:     "PostVideo",
+		VideoID:    videoName,
+		Before:     before,
+		After:      s.score(ctx, videoName),
+		SampleRate: 1,
+	}, err)
+	return err
+}
+
+// the views of an import are not read around it, the entry only has its summary
+func (s *auditingService) ImportViews(ctx context.Context, r io.Reader, opts ImportOptions) (ImportReport, error) {
+	report, err := s.Service.ImportViews(ctx, r, opts)
+	if !opts.DryRun {
+		s.record(ctx, model.AuditEntry{
+			Method:     "ImportViews",
+			SampleRate: 1,
+			Details:    fmt.Sprintf("format=%s imported=%d failed=%d lastLine=%d", opts.Format, report.Imported, report.Failed, report.LastLine),
+		}, err)
+	}
+	return report, err
+}
+
+func (s *auditingService) GetAuditEntries(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	return s.log.Query(ctx, filter)
+}
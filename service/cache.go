@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+	model "youtube_service/model"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// entries kept at most, the limit a client can ask for is part of the key
+const maxCacheEntries = 1024
+
+type cacheKey struct {
+	window string
+	n      int
+}
+
+type cacheEntry struct {
+	videos  []model.ResultRedis
+	expires time.Time
+}
+
+// Cache holds the top N videos of every window for a short ttl, a window is dropped with Invalidate
+type Cache struct {
+	ttl   time.Duration
+	now   func() time.Time
+	group singleflight.Group
+
+	mu      sync.Mutex
+	entries map[cacheKey]cacheEntry
+	// bumped by Invalidate so the loads started before it are not stored
+	generations map[string]uint64
+}
+
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{
+		ttl:         ttl,
+		now:         time.Now,
+		entries:     map[cacheKey]cacheEntry{},
+		generations: map[string]uint64{},
+	}
+}
+
+// Invalidate drops the cached leaderboards of window
+func (c *Cache) Invalidate(window string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generations[window]++
+	for key := range c.entries {
+		if key.window == window {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// get returns the cached top n of window or loads it, the concurrent loads of the same key are done once
+func (c *Cache) get(ctx context.Context, window string, n int, load func() ([]model.ResultRedis, error)) ([]model.ResultRedis, error) {
+	key := cacheKey{window: window, n: n}
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	generation := c.generations[window]
+	c.mu.Unlock()
+	if ok && c.now().Before(entry.expires) {
+		return entry.videos, nil
+	}
+
+	videos, err, _ := c.group.Do(window+":"+strconv.Itoa(n), func() (interface{}, error) {
+		videos, err := load()
+		if err == nil {
+			c.store(key, generation, videos)
+		}
+		return videos, err
+	})
+	//the load was shared with a caller which went away, this one still wants the result
+	if errors.Is(err, context.Canceled) && ctx.Err() == nil {
+		return load()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return videos.([]model.ResultRedis), nil
+}
+
+func (c *Cache) store(key cacheKey, generation uint64, videos []model.ResultRedis) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generations[key.window] != generation {
+		return
+	}
+	now := c.now()
+	if len(c.entries) >= maxCacheEntries {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxCacheEntries {
+			return
+		}
+	}
+	c.entries[key] = cacheEntry{videos: videos, expires: now.Add(c.ttl)}
+}
+
+type cachingService struct {
+	cache *Cache
+	Service
+}
+
+// NewCachingService returns a Service reading the leaderboards through cache, the returned
+// videos are shared between the callers and must not be modified
+func NewCachingService(cache *Cache, s Service) Service {
+	return &cachingService{
+		cache:   cache,
+		Service: s,
+	}
+}
+
+func (s *cachingService) GetTopNVideos(ctx context.Context, n int, isLifeTime bool) ([]model.ResultRedis, error) {
+	return s.cache.get(ctx, lifeTimeWindow(isLifeTime), n, func() ([]model.ResultRedis, error) {
+		return s.Service.GetTopNVideos(ctx, n, isLifeTime)
+	})
+}
+
+func (s *cachingService) GetTopNVideosInWindow(ctx context.Context, n int, window string) ([]model.ResultRedis, error) {
+	return s.cache.get(ctx, window, n, func() ([]model.ResultRedis, error) {
+		return s.Service.GetTopNVideosInWindow(ctx, n, window)
+	})
+}
+
+// a new video can enter the calendar leaderboards which have less than N videos
+func (s *cachingService) PostVideo(ctx context.Context, videoName string) error {
+	err := s.Service.PostVideo(ctx, videoName)
+	if err == nil {
+		s.cache.Invalidate(WindowLifetime)
+		s.cache.Invalidate(WindowToday)
+	}
+	return err
+}
+
+func (s *cachingService) ImportViews(ctx context.Context, r io.Reader, opts ImportOptions) (ImportReport, error) {
+	report, err := s.Service.ImportViews(ctx, r, opts)
+	if !report.DryRun && report.Imported > 0 {
+		for _, window := range windows {
+			s.cache.Invalidate(window)
+		}
+	}
+	return report, err
+}
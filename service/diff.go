@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+	model "youtube_service/model"
+	db "youtube_service/repository"
+
+	log1 "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// number of videos kept in every snapshot, the largest N a diff can be asked for
+const snapshotSize = 100
+
+var ErrNoSnapshots = errors.New("not enough snapshots of the window yet")
+
+func (s *service) GetLeaderboardDiff(ctx context.Context, window string, n int) (model.LeaderboardDiff, error) {
+	if n <= 0 || n > snapshotSize || !isValidWindow(window) {
+		return model.LeaderboardDiff{}, ErrInvalidArgument
+	}
+	snapshots, err := s.database.GetLastSnapshots(ctx, window)
+	if err != nil {
+		return model.LeaderboardDiff{}, err
+	}
+	if len(snapshots) < 2 {
+		return model.LeaderboardDiff{}, ErrNoSnapshots
+	}
+	return diffSnapshots(snapshots[1], snapshots[0], n), nil
+}
+
+// diffSnapshots compares the top n of two snapshots, climbers and fallers are sorted by the size of their move
+func diffSnapshots(previous, current model.Snapshot, n int) model.LeaderboardDiff {
+	diff := model.LeaderboardDiff{
+		Window:     current.Window,
+		From:       previous.TakenAt,
+		To:         current.TakenAt,
+		NewEntries: []model.RankChange{},
+		Climbers:   []model.RankChange{},
+		Fallers:    []model.RankChange{},
+		DropOuts:   []model.RankChange{},
+	}
+	previousTop, currentTop := topOf(previous.Videos, n), topOf(current.Videos, n)
+	previousRanks := make(map[string]int, len(previousTop))
+	for i, video := range previousTop {
+		previousRanks[video.VideoID] = i + 1
+	}
+	currentRanks := make(map[string]int, len(currentTop))
+	for i, video := range currentTop {
+		rank := i + 1
+		currentRanks[video.VideoID] = rank
+		change := model.RankChange{VideoID: video.VideoID, Rank: rank, ViewCount: video.ViewCount}
+		previousRank, ok := previousRanks[video.VideoID]
+		if !ok {
+			diff.NewEntries = append(diff.NewEntries, change)
+			continue
+		}
+		change.PreviousRank = previousRank
+		change.Movement = previousRank - rank
+		switch {
+		case change.Movement > 0:
+			diff.Climbers = append(diff.Climbers, change)
+		case change.Movement < 0:
+			diff.Fallers = append(diff.Fallers, change)
+		}
+	}
+	for i, video := range previousTop {
+		if _, ok := currentRanks[video.VideoID]; !ok {
+			diff.DropOuts = append(diff.DropOuts, model.RankChange{VideoID: video.VideoID, PreviousRank: i + 1, ViewCount: video.ViewCount})
+		}
+	}
+	sort.SliceStable(diff.Climbers, func(i, j int) bool { return diff.Climbers[i].Movement > diff.Climbers[j].Movement })
+	sort.SliceStable(diff.Fallers, func(i, j int) bool { return diff.Fallers[i].Movement < diff.Fallers[j].Movement })
+	return diff
+}
+
+func topOf(videos []model.ResultRedis, n int) []model.ResultRedis {
+	if len(videos) > n {
+		return videos[:n]
+	}
+	return videos
+}
+
+// SnapshotLeaderboards saves the top of every window right away and then every interval until ctx is done,
+// the rolling windows are skipped while the hourly buckets are disabled
+func SnapshotLeaderboards(ctx context.Context, database db.Database, interval time.Duration, logger log1.Logger) {
+	runEvery(ctx, interval, func() {
+		snapshotLeaderboards(ctx, database, interval, time.Now(), logger)
+	})
+}
+
+// snapshotLeaderboards saves the snapshots of the interval of now, every instance runs it but only
+// the first one to claim the interval takes them so the snapshots stay one interval apart
+func snapshotLeaderboards(ctx context.Context, database db.Database, interval time.Duration, now time.Time, logger log1.Logger) {
+	start := now.Truncate(interval)
+	claimed, err := database.Claim(ctx, "snapshots:"+strconv.FormatInt(start.Unix(), 10), 2*interval)
+	if err != nil {
+		level.Error(logger).Log("method", "SnapshotLeaderboards", "err", err)
+		return
+	}
+	if !claimed {
+		return
+	}
+	s := &service{database: database}
+	for _, window := range windows {
+		videos, err := s.GetTopNVideosInWindow(ctx, snapshotSize, window)
+		if err == db.ErrHourlyBucketsDisabled {
+			continue
+		}
+		if err == nil {
+			err = database.SaveSnapshot(ctx, model.Snapshot{Window: window, TakenAt: now, Videos: videos})
+		}
+		if err != nil {
+			level.Error(logger).Log("method", "SnapshotLeaderboards", "window", window, "err", err)
+		}
+	}
+}
@@ -2,9 +2,14 @@ package service
 
 import (
 	"context"
+	"io"
 	"net/url"
 	"strings"
+	"time"
 
+	"youtube_service/auth"
+	"youtube_service/idempotency"
+	"youtube_service/logging"
 	model "youtube_service/model"
 
 	"github.com/go-kit/kit/endpoint"
@@ -23,6 +28,21 @@ type Endpoints struct {
 	GetTopNVideosTodayEndpoint endpoint.Endpoint
 	GetViewsEndpoint           endpoint.Endpoint
 	PostVideoEndpoint          endpoint.Endpoint
+	ImportViewsEndpoint        endpoint.Endpoint
+	ExportVideosEndpoint       endpoint.Endpoint
+	GetViewHistoryEndpoint     endpoint.Endpoint
+	GetLeaderboardDiffEndpoint endpoint.Endpoint
+	GetAuditEntriesEndpoint    endpoint.Endpoint
+	GetVideoStatsEndpoint      endpoint.Endpoint
+}
+
+// ResponseError returns the error of the service answered in a response of the MakeXEndpoint endpoints,
+// they keep it in the response for the transports to encode
+func ResponseError(response interface{}) error {
+	if e, ok := response.(errorer); ok {
+		return e.error()
+	}
+	return nil
 }
 
 //kept for future use
@@ -34,12 +54,18 @@ type Endpoints struct {
 // 		GetTopNVideosTodayEndpoint: MakeGetTopNVideosTodayEndpoint(s),
 // 		GetViewsEndpoint:           MakeGetViewsEndpoint(s),
 // 		PostVideoEndpoint:          MakePostVideoEndpoint(s),
+// 		ImportViewsEndpoint:        MakeImportViewsEndpoint(s),
+// 		ExportVideosEndpoint:       MakeExportVideosEndpoint(s),
+// 		GetViewHistoryEndpoint:     MakeGetViewHistoryEndpoint(s),
+// 		GetLeaderboardDiffEndpoint: MakeGetLeaderboardDiffEndpoint(s),
+// 		GetAuditEntriesEndpoint:    MakeGetAuditEntriesEndpoint(s),
+// 		GetVideoStatsEndpoint:      MakeGetVideoStatsEndpoint(s),
 // 	}
 // }
 
 func (e Endpoints) ViewVideo(ctx context.Context, videoName string) (err error) {
 	req := viewVideoRequest{videoName: videoName}
-	response, err := e.ViewVideoEndpoint(context.Background(), req)
+	response, err := e.ViewVideoEndpoint(ctx, req)
 	if err != nil {
 		return err
 	}
@@ -50,15 +76,26 @@ func (e Endpoints) ViewVideo(ctx context.Context, videoName string) (err error)
 // if user want for lifefime we will hit the endpoint for lifetime top videos
 // else we will hit the endpoint for top videos on current day
 func (e Endpoints) GetTopNVideos(ctx context.Context, n int, isLifeTime bool) ([]model.ResultRedis, error) {
-	var response interface{}
-	var err error
 	if isLifeTime {
-		req := getTopNvideosRequest{limit: n}
-		response, err = e.GetTopNVideosEndpoint(context.Background(), req)
-	} else {
-		req := getTopNVideosTodayRequest{limit: n}
-		response, err = e.GetTopNVideosTodayEndpoint(context.Background(), req)
+		return e.GetTopNVideosInWindow(ctx, n, WindowLifetime)
 	}
+	req := getTopNVideosTodayRequest{limit: n}
+	response, err := e.GetTopNVideosTodayEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	//the client transports decode the today tops to a getTopNvideosResponse, the server endpoint
+	//wrapped by the load balanced client answers with its own type
+	if resp, ok := response.(getTopNVideosTodayResponse); ok {
+		return resp.TopVideos, resp.Err
+	}
+	resp := response.(getTopNvideosResponse)
+	return resp.TopVideos, resp.Err
+}
+
+func (e Endpoints) GetTopNVideosInWindow(ctx context.Context, n int, window string) ([]model.ResultRedis, error) {
+	req := getTopNvideosRequest{limit: n, window: window}
+	response, err := e.GetTopNVideosEndpoint(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -68,7 +105,7 @@ func (e Endpoints) GetTopNVideos(ctx context.Context, n int, isLifeTime bool) ([
 
 func (e Endpoints) GetViews(ctx context.Context, videoName string) (int, error) {
 	req := getViewsRequest{videoName: videoName}
-	response, err := e.GetViewsEndpoint(context.Background(), req)
+	response, err := e.GetViewsEndpoint(ctx, req)
 	if err != nil {
 		return 0, err
 	}
@@ -78,29 +115,95 @@ func (e Endpoints) GetViews(ctx context.Context, videoName string) (int, error)
 
 func (e Endpoints) PostVideo(ctx context.Context, videoName string) error {
 	req := postVideoRequest{videoName: videoName}
-	_, err := e.PostVideoEndpoint(context.Background(), req)
+	response, err := e.PostVideoEndpoint(ctx, req)
 	if err != nil {
 		return err
 	}
-	resp := postVideoResponse{Err: err}
+	resp := response.(postVideoResponse)
 	return resp.Err
 
 }
 
+func (e Endpoints) ImportViews(ctx context.Context, r io.Reader, opts ImportOptions) (ImportReport, error) {
+	req := importViewsRequest{body: r, opts: opts}
+	response, err := e.ImportViewsEndpoint(ctx, req)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	resp := response.(importViewsResponse)
+	return resp.Report, resp.Err
+}
+
+func (e Endpoints) ExportVideos(ctx context.Context, isLifeTime bool, each func(model.ResultRedis) error) error {
+	req := exportVideosRequest{isLifeTime: isLifeTime, format: FormatNDJSON}
+	response, err := e.ExportVideosEndpoint(ctx, req)
+	if err != nil {
+		return err
+	}
+	resp := response.(exportVideosResponse)
+	return resp.stream(each)
+}
+
+func (e Endpoints) GetViewHistory(ctx context.Context, videoName string, from, to time.Time, granularity string) ([]model.HistoryPoint, error) {
+	req := getViewHistoryRequest{videoName: videoName, from: from, to: to, granularity: granularity}
+	response, err := e.GetViewHistoryEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(getViewHistoryResponse)
+	return resp.History, resp.Err
+}
+
+func (e Endpoints) GetLeaderboardDiff(ctx context.Context, window string, n int) (model.LeaderboardDiff, error) {
+	req := getLeaderboardDiffRequest{window: window, limit: n}
+	response, err := e.GetLeaderboardDiffEndpoint(ctx, req)
+	if err != nil {
+		return model.LeaderboardDiff{}, err
+	}
+	resp := response.(getLeaderboardDiffResponse)
+	return resp.Diff, resp.Err
+}
+
+func (e Endpoints) GetAuditEntries(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, error) {
+	req := getAuditEntriesRequest{filter: filter}
+	response, err := e.GetAuditEntriesEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(getAuditEntriesResponse)
+	return resp.Entries, resp.Err
+}
+
+func (e Endpoints) GetVideoStats(ctx context.Context, videoNames []string, window string) ([]model.VideoStats, error) {
+	req := getVideoStatsRequest{videoNames: videoNames, window: window}
+	response, err := e.GetVideoStatsEndpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(getVideoStatsResponse)
+	return resp.Videos, resp.Err
+}
+
 // httptransport.NewClient().endpoint() will create an endpoint by taking encoder decoder functions, target URL, request type and options
 // and will return an usable client endpoint which calls the remote HTTP endpoint
-func MakeClientEndpoints(instance string) (Endpoints, error) {
+func MakeClientEndpoints(instance string, clientOptions ...httptransport.ClientOption) (Endpoints, error) {
 	if !strings.HasPrefix(instance, "http") {
 		instance = "http://" + instance
 	}
 
+	//the routes are appended to the path of instance, e.g. http://host/api/getViews
 	tgt, err := url.Parse(instance)
 	if err != nil {
 		return Endpoints{}, err
 	}
-	tgt.Path = ""
+	tgt.Path = strings.TrimSuffix(tgt.Path, "/")
+	tgt.RawPath = strings.TrimSuffix(tgt.RawPath, "/")
 
-	options := []httptransport.ClientOption{}
+	options := []httptransport.ClientOption{
+		httptransport.ClientBefore(startClientSpan, logging.InjectRequestID, auth.ContextToHTTP(), idempotency.ContextToHTTP()),
+		httptransport.ClientFinalizer(finishClientSpan),
+	}
+	options = append(options, clientOptions...)
 
 	return Endpoints{
 		ViewVideoEndpoint:          httptransport.NewClient("GET", tgt, _Encode_viewVideo_Request, _Decode_viewVideo_Response, options...).Endpoint(),
@@ -108,14 +211,23 @@ func MakeClientEndpoints(instance string) (Endpoints, error) {
 		GetTopNVideosTodayEndpoint: httptransport.NewClient("GET", tgt, _Encode_GetTopNVideosTodayEndpoint_Request, _Decode_GetTopNVideosTodayEndpoint_Response, options...).Endpoint(),
 		GetViewsEndpoint:           httptransport.NewClient("GET", tgt, _Encode_GetViewsEndpoint_Request, _Decode_GetViewsEndpoint_Response, options...).Endpoint(),
 		PostVideoEndpoint:          httptransport.NewClient("POST", tgt, _Encode_PostVideoEndpoint_Request, _Decode_PostVideoEndpoint_Response, options...).Endpoint(),
+		ImportViewsEndpoint:        httptransport.NewClient("POST", tgt, _Encode_ImportViewsEndpoint_Request, _Decode_ImportViewsEndpoint_Response, options...).Endpoint(),
+		GetViewHistoryEndpoint:     httptransport.NewClient("GET", tgt, _Encode_GetViewHistoryEndpoint_Request, _Decode_GetViewHistoryEndpoint_Response, options...).Endpoint(),
+		GetLeaderboardDiffEndpoint: httptransport.NewClient("GET", tgt, _Encode_GetLeaderboardDiffEndpoint_Request, _Decode_GetLeaderboardDiffEndpoint_Response, options...).Endpoint(),
+		GetAuditEntriesEndpoint:    httptransport.NewClient("GET", tgt, _Encode_GetAuditEntriesEndpoint_Request, _Decode_GetAuditEntriesEndpoint_Response, options...).Endpoint(),
+		GetVideoStatsEndpoint:      httptransport.NewClient("GET", tgt, _Encode_GetVideoStatsEndpoint_Request, _Decode_GetVideoStatsEndpoint_Response, options...).Endpoint(),
+		//the export body is left open and read by the stream of the response
+		ExportVideosEndpoint: httptransport.NewClient("GET", tgt, _Encode_ExportVideosEndpoint_Request, _Decode_ExportVideosEndpoint_Response,
+			append(options, httptransport.BufferedStream(true))...).Endpoint(),
 	}, nil
 }
 
 //creating endpoints for all the methods in service
 
 type viewVideoResponse struct {
-	Response string `json:"reponse,omitempty"`
-	Err      error  `json:"error,omitempty"`
+	Response  string `json:"reponse,omitempty"`
+	Err       error  `json:"-"`
+	videoName string
 }
 
 type viewVideoRequest struct {
@@ -128,17 +240,20 @@ func MakeViewVideoEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(viewVideoRequest)
 		err = s.ViewVideo(ctx, req.videoName)
-		return viewVideoResponse{Response: "success", Err: err}, nil
+		return viewVideoResponse{Response: "success", Err: err, videoName: req.videoName}, nil
 	}
 }
 
+// window is lifetime when it is not set
 type getTopNvideosRequest struct {
-	limit int
+	limit  int
+	window string
 }
 
 type getTopNvideosResponse struct {
 	TopVideos []model.ResultRedis
-	Err       error
+	Err       error `json:"-"`
+	window    string
 }
 
 func (r getTopNvideosResponse) error() error { return r.Err }
@@ -146,10 +261,12 @@ func (r getTopNvideosResponse) error() error { return r.Err }
 func MakeGetTopNVideosEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(getTopNvideosRequest)
-		isLifeTime := true
-		response, err = s.GetTopNVideos(ctx, req.limit, isLifeTime)
-		response1, _ := response.([]model.ResultRedis)
-		return getTopNvideosResponse{TopVideos: response1, Err: err}, nil
+		window := req.window
+		if window == "" {
+			window = WindowLifetime
+		}
+		response1, err := s.GetTopNVideosInWindow(ctx, req.limit, window)
+		return getTopNvideosResponse{TopVideos: response1, Err: err, window: window}, nil
 	}
 }
 
@@ -159,7 +276,7 @@ type getTopNVideosTodayRequest struct {
 
 type getTopNVideosTodayResponse struct {
 	TopVideos []model.ResultRedis
-	Err       error
+	Err       error `json:"-"`
 }
 
 func (r getTopNVideosTodayResponse) error() error { return r.Err }
@@ -179,8 +296,9 @@ type getViewsRequest struct {
 }
 
 type getViewsResponse struct {
-	Views int
-	Err   error
+	Views     int
+	Err       error `json:"-"`
+	videoName string
 }
 
 func (r getViewsResponse) error() error { return r.Err }
@@ -190,12 +308,13 @@ func MakeGetViewsEndpoint(s Service) endpoint.Endpoint {
 		req := request.(getViewsRequest)
 		response, err = s.GetViews(ctx, req.videoName)
 		response1, _ := response.(int)
-		return getViewsResponse{Views: response1, Err: err}, nil
+		return getViewsResponse{Views: response1, Err: err, videoName: req.videoName}, nil
 	}
 }
 
 type postVideoResponse struct {
-	Err error
+	Err       error `json:"-"`
+	videoName string
 }
 
 type postVideoRequest struct {
@@ -208,6 +327,129 @@ func MakePostVideoEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(postVideoRequest)
 		err = s.PostVideo(ctx, req.videoName)
-		return postVideoResponse{Err: err}, nil
+		return postVideoResponse{Err: err, videoName: req.videoName}, nil
+	}
+}
+
+type importViewsRequest struct {
+	body io.Reader
+	opts ImportOptions
+}
+
+// the report is encoded along with the error so a failed import can be resumed
+type importViewsResponse struct {
+	Report ImportReport
+	Err    error `json:"-"`
+}
+
+func MakeImportViewsEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(importViewsRequest)
+		report, err := s.ImportViews(ctx, req.body, req.opts)
+		return importViewsResponse{Report: report, Err: err}, nil
+	}
+}
+
+type exportVideosRequest struct {
+	isLifeTime bool
+	format     string
+}
+
+// stream runs the export, the service is only called once the transport starts writing the response
+type exportVideosResponse struct {
+	format string
+	stream func(each func(model.ResultRedis) error) error
+}
+
+func MakeExportVideosEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(exportVideosRequest)
+		return exportVideosResponse{
+			format: req.format,
+			stream: func(each func(model.ResultRedis) error) error {
+				return s.ExportVideos(ctx, req.isLifeTime, each)
+			},
+		}, nil
+	}
+}
+
+type getViewHistoryRequest struct {
+	videoName   string
+	from        time.Time
+	to          time.Time
+	granularity string
+}
+
+type getViewHistoryResponse struct {
+	History []model.HistoryPoint `json:"history"`
+	Err     error                `json:"-"`
+}
+
+func (r getViewHistoryResponse) error() error { return r.Err }
+
+func MakeGetViewHistoryEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getViewHistoryRequest)
+		history, err := s.GetViewHistory(ctx, req.videoName, req.from, req.to, req.granularity)
+		return getViewHistoryResponse{History: history, Err: err}, nil
+	}
+}
+
+type getLeaderboardDiffRequest struct {
+	window string
+	limit  int
+}
+
+type getLeaderboardDiffResponse struct {
+	Diff model.LeaderboardDiff `json:"diff"`
+	Err  error                 `json:"-"`
+}
+
+func (r getLeaderboardDiffResponse) error() error { return r.Err }
+
+func MakeGetLeaderboardDiffEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getLeaderboardDiffRequest)
+		diff, err := s.GetLeaderboardDiff(ctx, req.window, req.limit)
+		return getLeaderboardDiffResponse{Diff: diff, Err: err}, nil
+	}
+}
+
+type getAuditEntriesRequest struct {
+	filter model.AuditFilter
+}
+
+type getAuditEntriesResponse struct {
+	Entries []model.AuditEntry `json:"entries"`
+	Err     error              `json:"-"`
+}
+
+func (r getAuditEntriesResponse) error() error { return r.Err }
+
+func MakeGetAuditEntriesEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getAuditEntriesRequest)
+		entries, err := s.GetAuditEntries(ctx, req.filter)
+		return getAuditEntriesResponse{Entries: entries, Err: err}, nil
+	}
+}
+
+type getVideoStatsRequest struct {
+	videoNames []string
+	window     string
+}
+
+type getVideoStatsResponse struct {
+	Videos []model.VideoStats `json:"videos"`
+	Err    error              `json:"-"`
+}
+
+func (r getVideoStatsResponse) error() error { return r.Err }
+
+func MakeGetVideoStatsEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getVideoStatsRequest)
+		videos, err := s.GetVideoStats(ctx, req.videoNames, req.window)
+		return getVideoStatsResponse{Videos: videos, Err: err}, nil
 	}
 }
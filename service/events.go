@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"youtube_service/events"
+	db "youtube_service/repository"
+	"youtube_service/validation"
+)
+
+// releaseTimeout bounds the release of the claim of a failed event, the context of the event may be done
+const releaseTimeout = 5 * time.Second
+
+type publishingService struct {
+	publisher *events.Publisher
+	Service
+}
+
+// NewPublishingService returns a Service publishing an event for every successful view and new video,
+// the events are sent in the background and never fail the call
+func NewPublishingService(publisher *events.Publisher, s Service) Service {
+	return &publishingService{
+		publisher: publisher,
+		Service:   s,
+	}
+}
+
+func (s *publishingService) ViewVideo(ctx context.Context, videoName string) error {
+	err := s.Service.ViewVideo(ctx, videoName)
+	if err == nil {
+		s.publisher.Publish(ctx, events.NewEvent(ctx, events.TypeView, videoName))
+	}
+	return err
+}
+
+func (s *publishingService) PostVideo(ctx context.Context, videoName string) error {
+	err := s.Service.PostVideo(ctx, videoName)
+	if err == nil {
+		s.publisher.Publish(ctx, events.NewEvent(ctx, events.TypeVideoPosted, videoName))
+	}
+	return err
+}
+
+// ViewEventHandler applies the view events of a queue through s like the views of /viewVideo, their video IDs
+// are normalised and checked with v and the events of a rejected video go to the dead letters. The view
+// is counted in the day and hour of the event and the ID of the event is claimed in database for
+// dedupWindow, an event whose ID is already claimed is a duplicate.
+func ViewEventHandler(s Service, database db.Database, v *validation.Validator, dedupWindow time.Duration) events.Handler {
+	return func(ctx context.Context, event events.Event) error {
+		videoName, verr := v.VideoID("videoId", event.VideoID)
+		if verr != nil {
+			return events.Permanent(verr)
+		}
+		//the entries with only a video ID have neither an ID nor a time
+		if event.ID != "" {
+			claimed, err := database.Claim(ctx, "events:"+event.ID, dedupWindow)
+			if err != nil {
+				return err
+			}
+			if !claimed {
+				return events.ErrDuplicate
+			}
+		}
+		if !event.Time.IsZero() {
+			ctx = contextWithViewTime(ctx, event.Time)
+		}
+		err := s.ViewVideo(ctx, videoName)
+		if err != nil && event.ID != "" {
+			//the event is delivered again and has to be applied then, even when ctx ended with the failure
+			releaseCtx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+			defer cancel()
+			if rerr := database.Release(releaseCtx, "events:"+event.ID); rerr != nil {
+				return fmt.Errorf("%w, the event stays claimed: %v", err, rerr)
+			}
+		}
+		return err
+	}
+}
+
+type viewTimeContextKey struct{}
+
+// contextWithViewTime makes the views of ctx count at t instead of now
+func contextWithViewTime(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, viewTimeContextKey{}, t)
+}
+
+func viewTimeFromContext(ctx context.Context) (time.Time, bool) {
+	t, ok := ctx.Value(viewTimeContextKey{}).(time.Time)
+	return t, ok
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	model "youtube_service/model"
+)
+
+const (
+	FormatJSON = "json"
+	//FormatColumnar holds one array per column instead of one object per video
+	FormatColumnar = "columnar"
+
+	contentTypeJSON     = "application/json; charset=utf-8"
+	contentTypeCSV      = "text/csv; charset=utf-8"
+	contentTypeNDJSON   = "application/x-ndjson"
+	contentTypeColumnar = "application/vnd.leaderboard.columnar+json"
+)
+
+var mediaTypeFormats = map[string]string{
+	"application/json":     FormatJSON,
+	"text/csv":             FormatCSV,
+	"application/x-ndjson": FormatNDJSON,
+	"application/vnd.leaderboard.columnar+json": FormatColumnar,
+}
+
+var formatContentTypes = map[string]string{
+	FormatJSON:     contentTypeJSON,
+	FormatCSV:      contentTypeCSV,
+	FormatNDJSON:   contentTypeNDJSON,
+	FormatColumnar: contentTypeColumnar,
+}
+
+// negotiateFormat returns the format of the first supported media type in the Accept header,
+// fallback is used when nothing in the header is supported
+func negotiateFormat(accept string, fallback string) string {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(mediaRange, ";", 2)[0])
+		if format, ok := mediaTypeFormats[strings.ToLower(mediaType)]; ok {
+			return format
+		}
+	}
+	return fallback
+}
+
+// recordWriter writes the videos of a leaderboard one at a time
+type recordWriter interface {
+	Write(model.ResultRedis) error
+	Flush() error
+}
+
+// newRecordWriter returns a csv writer for FormatCSV and an ndjson writer for everything else
+func newRecordWriter(format string, w io.Writer) recordWriter {
+	if format == FormatCSV {
+		return &csvRecordWriter{writer: csv.NewWriter(w)}
+	}
+	return &ndjsonRecordWriter{encoder: json.NewEncoder(w)}
+}
+
+type csvRecordWriter struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+func (c *csvRecordWriter) writeHeader() error {
+	if c.headerWritten {
+		return nil
+	}
+	c.headerWritten = true
+	return c.writer.Write([]string{"videoID", "viewCount"})
+}
+
+func (c *csvRecordWriter) Write(record model.ResultRedis) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	return c.writer.Write([]string{record.VideoID, strconv.Itoa(record.ViewCount)})
+}
+
+func (c *csvRecordWriter) Flush() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+type ndjsonRecordWriter struct {
+	encoder *json.Encoder
+}
+
+func (n *ndjsonRecordWriter) Write(record model.ResultRedis) error {
+	return n.encoder.Encode(record)
+}
+
+func (n *ndjsonRecordWriter) Flush() error { return nil }
+
+// columnarRecords is the columnar layout of a leaderboard, the i-th entries of both columns belong together
+type columnarRecords struct {
+	VideoID   []string `json:"videoID"`
+	ViewCount []int    `json:"viewCount"`
+}
+
+func toColumnar(records []model.ResultRedis) columnarRecords {
+	columns := columnarRecords{
+		VideoID:   make([]string, len(records)),
+		ViewCount: make([]int, len(records)),
+	}
+	for i, record := range records {
+		columns.VideoID[i] = record.VideoID
+		columns.ViewCount[i] = record.ViewCount
+	}
+	return columns
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"time"
+	model "youtube_service/model"
+)
+
+const (
+	GranularityDay  = "day"
+	GranularityHour = "hour"
+
+	// longest series a single history request can ask for
+	maxHistoryPoints = 24 * 31
+)
+
+func (s *service) GetViewHistory(ctx context.Context, videoName string, from, to time.Time, granularity string) ([]model.HistoryPoint, error) {
+	if videoName == "" || to.Before(from) {
+		return nil, ErrInvalidArgument
+	}
+	buckets, err := historyBuckets(from, to, granularity)
+	if err != nil {
+		return nil, err
+	}
+	scores, err := s.database.GetScoreHistory(ctx, videoName, buckets, granularity == GranularityHour)
+	if err != nil {
+		return nil, err
+	}
+	history := make([]model.HistoryPoint, len(buckets))
+	for i, bucket := range buckets {
+		history[i] = model.HistoryPoint{Time: bucket, Views: int(scores[i])}
+	}
+	return history, nil
+}
+
+// historyBuckets returns the start of every day or hour between from and to, both included
+func historyBuckets(from, to time.Time, granularity string) ([]time.Time, error) {
+	var start time.Time
+	var next func(time.Time) time.Time
+	from, to = from.Local(), to.Local()
+	switch granularity {
+	case GranularityDay:
+		start = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.Local)
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	case GranularityHour:
+		start = time.Date(from.Year(), from.Month(), from.Day(), from.Hour(), 0, 0, 0, time.Local)
+		next = func(t time.Time) time.Time { return t.Add(time.Hour) }
+	default:
+		return nil, ErrInvalidArgument
+	}
+	var buckets []time.Time
+	for bucket := start; !bucket.After(to); bucket = next(bucket) {
+		if len(buckets) == maxHistoryPoints {
+			return nil, ErrInvalidArgument
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
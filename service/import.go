@@ -0,0 +1,216 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	model "youtube_service/model"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+
+	defaultImportBatchSize = 500
+	importDateLayout       = "2006-01-02"
+)
+
+var ErrUnknownFormat = errors.New("unknown import format")
+
+// ImportOptions controls how ImportViews reads and writes the records
+type ImportOptions struct {
+	//Format of the input, csv or ndjson
+	Format string
+	//DryRun validates every line without writing anything to the database
+	DryRun bool
+	//ResumeFrom skips every line before it, pass LastLine+1 of a failed import to resume it
+	ResumeFrom int
+	//BatchSize is the number of records written in a single pipeline
+	BatchSize int
+	//NormalizeVideoID normalises the video ID of every line, the lines it fails are rejected
+	NormalizeVideoID func(string) (string, error)
+}
+
+// ImportLineError is a validation error for a single line of the input
+type ImportLineError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// ImportReport is the summary of an import
+type ImportReport struct {
+	DryRun    bool              `json:"dryRun"`
+	Processed int               `json:"processed"`
+	Imported  int               `json:"imported"`
+	Skipped   int               `json:"skipped"`
+	Failed    int               `json:"failed"`
+	LastLine  int               `json:"lastLine"`
+	Errors    []ImportLineError `json:"errors,omitempty"`
+}
+
+// a parsed line of the input, err is set when the line is not valid
+type importLine struct {
+	number int
+	record model.ViewRecord
+	err    error
+}
+
+func (s *service) ImportViews(ctx context.Context, r io.Reader, opts ImportOptions) (ImportReport, error) {
+	report := ImportReport{DryRun: opts.DryRun}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultImportBatchSize
+	}
+
+	var next func() (importLine, error)
+	switch strings.ToLower(opts.Format) {
+	case FormatCSV:
+		next = csvLines(r)
+	case FormatNDJSON:
+		next = ndjsonLines(r)
+	default:
+		return report, ErrUnknownFormat
+	}
+
+	batch := make([]model.ViewRecord, 0, opts.BatchSize)
+	lastSeen := 0
+	flush := func() error {
+		if len(batch) > 0 && !opts.DryRun {
+			if err := s.database.SetScores(ctx, batch); err != nil {
+				return err
+			}
+		}
+		report.Imported += len(batch)
+		report.LastLine = lastSeen
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		line, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report, err
+		}
+		if line.number < opts.ResumeFrom {
+			report.Skipped++
+			continue
+		}
+		report.Processed++
+		lastSeen = line.number
+		if line.err == nil && opts.NormalizeVideoID != nil {
+			line.record.VideoID, line.err = opts.NormalizeVideoID(line.record.VideoID)
+		}
+		if line.err != nil {
+			report.Failed++
+			report.Errors = append(report.Errors, ImportLineError{Line: line.number, Error: line.err.Error()})
+			continue
+		}
+		batch = append(batch, line.record)
+		if len(batch) == opts.BatchSize {
+			if err := flush(); err != nil {
+				return report, err
+			}
+		}
+	}
+	return report, flush()
+}
+
+// csvLines reads videoID,views[,date] rows, an optional header row is ignored
+func csvLines(r io.Reader) func() (importLine, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	first := true
+	return func() (importLine, error) {
+		for {
+			fields, err := reader.Read()
+			if err == io.EOF {
+				return importLine{}, err
+			}
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return importLine{number: parseErr.Line, err: parseErr.Err}, nil
+			}
+			if err != nil {
+				return importLine{}, err
+			}
+			number, _ := reader.FieldPos(0)
+			if first {
+				first = false
+				if strings.EqualFold(strings.TrimSpace(fields[0]), "videoID") {
+					continue
+				}
+			}
+			if len(fields) < 2 || len(fields) > 3 {
+				return importLine{number: number, err: fmt.Errorf("expected 2 or 3 fields got %d", len(fields))}, nil
+			}
+			date := ""
+			if len(fields) == 3 {
+				date = fields[2]
+			}
+			record, err := parseViewRecord(fields[0], fields[1], date)
+			return importLine{number: number, record: record, err: err}, nil
+		}
+	}
+}
+
+// ndjsonLines reads one {"videoID": "", "views": 0, "date": ""} object per line, blank lines are ignored
+func ndjsonLines(r io.Reader) func() (importLine, error) {
+	scanner := bufio.NewScanner(r)
+	number := 0
+	return func() (importLine, error) {
+		for scanner.Scan() {
+			number++
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			var row struct {
+				VideoID string      `json:"videoID"`
+				Views   json.Number `json:"views"`
+				Date    string      `json:"date"`
+			}
+			if err := json.Unmarshal([]byte(text), &row); err != nil {
+				return importLine{number: number, err: err}, nil
+			}
+			record, err := parseViewRecord(row.VideoID, row.Views.String(), row.Date)
+			return importLine{number: number, record: record, err: err}, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return importLine{}, err
+		}
+		return importLine{}, io.EOF
+	}
+}
+
+func parseViewRecord(videoID, views, date string) (model.ViewRecord, error) {
+	var record model.ViewRecord
+	record.VideoID = strings.TrimSpace(videoID)
+	if record.VideoID == "" {
+		return record, errors.New("videoID is empty")
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(views))
+	if err != nil || count < 0 {
+		return record, fmt.Errorf("views %q is not a non-negative integer", views)
+	}
+	record.Views = count
+	if date = strings.TrimSpace(date); date != "" {
+		record.Date, err = time.ParseInLocation(importDateLayout, date, time.Local)
+		if err != nil {
+			return record, fmt.Errorf("date %q is not in %s format", date, importDateLayout)
+		}
+	}
+	return record, nil
+}
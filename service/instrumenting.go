@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"io"
+	"time"
+	model "youtube_service/model"
+
+	"github.com/go-kit/kit/metrics"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+type instrumentingService struct {
+	requestCount   metrics.Counter
+	errorCount     metrics.Counter
+	requestLatency metrics.Histogram
+	Service
+}
+
+// NewInstrumentingService returns an instance of an instrumenting Service, every metric has a method and a window label
+func NewInstrumentingService(requestCount, errorCount metrics.Counter, requestLatency metrics.Histogram, s Service) Service {
+	return &instrumentingService{
+		requestCount:   requestCount,
+		errorCount:     errorCount,
+		requestLatency: requestLatency,
+		Service:        s,
+	}
+}
+
+// NewPrometheusInstrumentingService returns an instrumenting Service whose metrics are registered in registerer
+func NewPrometheusInstrumentingService(registerer stdprometheus.Registerer, s Service) Service {
+	fieldKeys := []string{"method", "window"}
+	requestCount := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{
+		Namespace: "api",
+		Subsystem: "youtube_service",
+		Name:      "request_count",
+		Help:      "Number of requests received.",
+	}, fieldKeys)
+	errorCount := stdprometheus.NewCounterVec(stdprometheus.CounterOpts{
+		Namespace: "api",
+		Subsystem: "youtube_service",
+		Name:      "error_count",
+		Help:      "Number of requests which returned an error.",
+	}, fieldKeys)
+	requestLatency := stdprometheus.NewHistogramVec(stdprometheus.HistogramOpts{
+		Namespace: "api",
+		Subsystem: "youtube_service",
+		Name:      "request_latency_seconds",
+		Help:      "Duration of requests in seconds.",
+		Buckets:   stdprometheus.DefBuckets,
+	}, fieldKeys)
+	registerer.MustRegister(requestCount, errorCount, requestLatency)
+
+	return NewInstrumentingService(
+		kitprometheus.NewCounter(requestCount),
+		kitprometheus.NewCounter(errorCount),
+		kitprometheus.NewHistogram(requestLatency),
+		s,
+	)
+}
+
+// observe records a finished call of method
+func (s *instrumentingService) observe(method, window string, begin time.Time, err error) {
+	lvs := []string{"method", method, "window", window}
+	s.requestCount.With(lvs...).Add(1)
+	if err != nil {
+		s.errorCount.With(lvs...).Add(1)
+	}
+	s.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+}
+
+func lifeTimeWindow(isLifeTime bool) string {
+	if isLifeTime {
+		return WindowLifetime
+	}
+	return WindowToday
+}
+
+func (s *instrumentingService) ViewVideo(ctx context.Context, videoName string) (err error) {
+	defer func(begin time.Time) {
+		s.observe("ViewVideo", "", begin, err)
+	}(time.Now())
+	return s.Service.ViewVideo(ctx, videoName)
+}
+
+func (s *instrumentingService) GetTopNVideos(ctx context.Context, n int, isLifeTime bool) (arraylist []model.ResultRedis, err error) {
+	defer func(begin time.Time) {
+		s.observe("GetTopNVideos", lifeTimeWindow(isLifeTime), begin, err)
+	}(time.Now())
+	return s.Service.GetTopNVideos(ctx, n, isLifeTime)
+}
+
+func (s *instrumentingService) GetTopNVideosInWindow(ctx context.Context, n int, window string) (arraylist []model.ResultRedis, err error) {
+	defer func(begin time.Time) {
+		s.observe("GetTopNVideosInWindow", window, begin, err)
+	}(time.Now())
+	return s.Service.GetTopNVideosInWindow(ctx, n, window)
+}
+
+func (s *instrumentingService) GetViews(ctx context.Context, videoName string) (views int, err error) {
+	defer func(begin time.Time) {
+		s.observe("GetViews", "", begin, err)
+	}(time.Now())
+	return s.Service.GetViews(ctx, videoName)
+}
+
+func (s *instrumentingService) PostVideo(ctx context.Context, videoName string) (err error) {
+	defer func(begin time.Time) {
+		s.observe("PostVideo", "", begin, err)
+	}(time.Now())
+	return s.Service.PostVideo(ctx, videoName)
+}
+
+func (s *instrumentingService) ImportViews(ctx context.Context, r io.Reader, opts ImportOptions) (report ImportReport, err error) {
+	defer func(begin time.Time) {
+		s.observe("ImportViews", "", begin, err)
+	}(time.Now())
+	return s.Service.ImportViews(ctx, r, opts)
+}
+
+func (s *instrumentingService) ExportVideos(ctx context.Context, isLifeTime bool, each func(model.ResultRedis) error) (err error) {
+	defer func(begin time.Time) {
+		s.observe("ExportVideos", lifeTimeWindow(isLifeTime), begin, err)
+	}(time.Now())
+	return s.Service.ExportVideos(ctx, isLifeTime, each)
+}
+
+func (s *instrumentingService) GetViewHistory(ctx context.Context, videoName string, from, to time.Time, granularity string) (history []model.HistoryPoint, err error) {
+	defer func(begin time.Time) {
+		s.observe("GetViewHistory", "", begin, err)
+	}(time.Now())
+	return s.Service.GetViewHistory(ctx, videoName, from, to, granularity)
+}
+
+func (s *instrumentingService) GetLeaderboardDiff(ctx context.Context, window string, n int) (diff model.LeaderboardDiff, err error) {
+	defer func(begin time.Time) {
+		s.observe("GetLeaderboardDiff", window, begin, err)
+	}(time.Now())
+	return s.Service.GetLeaderboardDiff(ctx, window, n)
+}
+
+func (s *instrumentingService) GetVideoStats(ctx context.Context, videoNames []string, window string) (stats []model.VideoStats, err error) {
+	defer func(begin time.Time) {
+		s.observe("GetVideoStats", window, begin, err)
+	}(time.Now())
+	return s.Service.GetVideoStats(ctx, videoNames, window)
+}
+
+func (s *instrumentingService) GetAuditEntries(ctx context.Context, filter model.AuditFilter) (entries []model.AuditEntry, err error) {
+	defer func(begin time.Time) {
+		s.observe("GetAuditEntries", "", begin, err)
+	}(time.Now())
+	return s.Service.GetAuditEntries(ctx, filter)
+}
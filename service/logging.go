@@ -2,7 +2,9 @@ package service
 
 import (
 	"context"
+	"io"
 	"time"
+	"youtube_service/logging"
 	model "youtube_service/model"
 
 	log1 "github.com/go-kit/kit/log"
@@ -18,11 +20,17 @@ func NewLoggingService(logger log1.Logger, s Service) Service {
 	return &loggingService{logger, s}
 }
 
+// loggerFor returns the logger of a finished call, with the request id of ctx and at error level when err is set
+func (s *loggingService) loggerFor(ctx context.Context, err error) log1.Logger {
+	return logging.ForResult(logging.WithContext(ctx, s.logger), err)
+}
+
 func (s *loggingService) ViewVideo(ctx context.Context, videoName string) (err error) {
 	defer func(begin time.Time) {
-		s.logger.Log(
+		s.loggerFor(ctx, err).Log(
 			"method", "ViewVideo",
 			"videoName", videoName,
+			"took", time.Since(begin),
 			"err", err,
 		)
 	}(time.Now())
@@ -31,32 +39,142 @@ func (s *loggingService) ViewVideo(ctx context.Context, videoName string) (err e
 
 func (s *loggingService) GetTopNVideos(ctx context.Context, n int, isLifeTime bool) (arraylist []model.ResultRedis, err error) {
 	defer func(begin time.Time) {
-		s.logger.Log(
+		s.loggerFor(ctx, err).Log(
 			"method", "GetTopNVideos",
 			"N", n,
 			"isLifeTime", isLifeTime,
-			"error", err,
+			"took", time.Since(begin),
+			"err", err,
 		)
 	}(time.Now())
 	return s.Service.GetTopNVideos(ctx, n, isLifeTime)
 }
 
-func (s *loggingService) GetViews(ctx context.Context, videoName string) (int, error) {
+func (s *loggingService) GetTopNVideosInWindow(ctx context.Context, n int, window string) (arraylist []model.ResultRedis, err error) {
 	defer func(begin time.Time) {
-		s.logger.Log(
+		s.loggerFor(ctx, err).Log(
+			"method", "GetTopNVideosInWindow",
+			"N", n,
+			"window", window,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+	return s.Service.GetTopNVideosInWindow(ctx, n, window)
+}
+
+func (s *loggingService) GetViews(ctx context.Context, videoName string) (views int, err error) {
+	defer func(begin time.Time) {
+		s.loggerFor(ctx, err).Log(
 			"method", "GetViews",
 			"videoName", videoName,
+			"views", views,
+			"took", time.Since(begin),
+			"err", err,
 		)
 	}(time.Now())
 	return s.Service.GetViews(ctx, videoName)
 }
 
-func (s *loggingService) PostVideo(ctx context.Context, videoName string) error {
+func (s *loggingService) PostVideo(ctx context.Context, videoName string) (err error) {
 	defer func(begin time.Time) {
-		s.logger.Log(
+		s.loggerFor(ctx, err).Log(
 			"method", "PostVideo",
 			"videoName", videoName,
+			"took", time.Since(begin),
+			"err", err,
 		)
 	}(time.Now())
 	return s.Service.PostVideo(ctx, videoName)
 }
+
+func (s *loggingService) ImportViews(ctx context.Context, r io.Reader, opts ImportOptions) (report ImportReport, err error) {
+	defer func(begin time.Time) {
+		s.loggerFor(ctx, err).Log(
+			"method", "ImportViews",
+			"format", opts.Format,
+			"dryRun", opts.DryRun,
+			"resumeFrom", opts.ResumeFrom,
+			"processed", report.Processed,
+			"failed", report.Failed,
+			"lastLine", report.LastLine,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+	return s.Service.ImportViews(ctx, r, opts)
+}
+
+func (s *loggingService) ExportVideos(ctx context.Context, isLifeTime bool, each func(model.ResultRedis) error) (err error) {
+	exported := 0
+	defer func(begin time.Time) {
+		s.loggerFor(ctx, err).Log(
+			"method", "ExportVideos",
+			"isLifeTime", isLifeTime,
+			"exported", exported,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+	return s.Service.ExportVideos(ctx, isLifeTime, func(record model.ResultRedis) error {
+		exported++
+		return each(record)
+	})
+}
+
+func (s *loggingService) GetViewHistory(ctx context.Context, videoName string, from, to time.Time, granularity string) (history []model.HistoryPoint, err error) {
+	defer func(begin time.Time) {
+		s.loggerFor(ctx, err).Log(
+			"method", "GetViewHistory",
+			"videoName", videoName,
+			"from", from,
+			"to", to,
+			"granularity", granularity,
+			"points", len(history),
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+	return s.Service.GetViewHistory(ctx, videoName, from, to, granularity)
+}
+
+func (s *loggingService) GetLeaderboardDiff(ctx context.Context, window string, n int) (diff model.LeaderboardDiff, err error) {
+	defer func(begin time.Time) {
+		s.loggerFor(ctx, err).Log(
+			"method", "GetLeaderboardDiff",
+			"window", window,
+			"N", n,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+	return s.Service.GetLeaderboardDiff(ctx, window, n)
+}
+
+func (s *loggingService) GetVideoStats(ctx context.Context, videoNames []string, window string) (stats []model.VideoStats, err error) {
+	defer func(begin time.Time) {
+		s.loggerFor(ctx, err).Log(
+			"method", "GetVideoStats",
+			"videos", len(videoNames),
+			"window", window,
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+	return s.Service.GetVideoStats(ctx, videoNames, window)
+}
+
+func (s *loggingService) GetAuditEntries(ctx context.Context, filter model.AuditFilter) (entries []model.AuditEntry, err error) {
+	defer func(begin time.Time) {
+		s.loggerFor(ctx, err).Log(
+			"method", "GetAuditEntries",
+			"auditedMethod", filter.Method,
+			"videoName", filter.VideoID,
+			"subject", filter.Subject,
+			"entries", len(entries),
+			"took", time.Since(begin),
+			"err", err,
+		)
+	}(time.Now())
+	return s.Service.GetAuditEntries(ctx, filter)
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"io"
+	"youtube_service/notify"
+)
+
+type notifyingService struct {
+	windows *notify.Notifier
+	videos  *notify.Notifier
+	Service
+}
+
+// NewNotifyingService returns a Service telling windows about the leaderboards and videos about the
+// view counts changed by the views, the new videos and the imports so the live streams are pushed again
+func NewNotifyingService(windows, videos *notify.Notifier, s Service) Service {
+	return &notifyingService{
+		windows: windows,
+		videos:  videos,
+		Service: s,
+	}
+}
+
+// the rolling windows only change when they are rebuilt by RefreshRollingWindows
+func (s *notifyingService) ViewVideo(ctx context.Context, videoName string) error {
+	err := s.Service.ViewVideo(ctx, videoName)
+	if err == nil {
+		s.windows.Notify(WindowLifetime, WindowToday)
+		s.videos.Notify(videoName)
+	}
+	return err
+}
+
+func (s *notifyingService) PostVideo(ctx context.Context, videoName string) error {
+	err := s.Service.PostVideo(ctx, videoName)
+	if err == nil {
+		s.windows.Notify(WindowLifetime, WindowToday)
+		s.videos.Notify(videoName)
+	}
+	return err
+}
+
+// the imported videos are not listed in the report, their live counters are refreshed by the next view
+// or by the periodic refresh of the connections
+func (s *notifyingService) ImportViews(ctx context.Context, r io.Reader, opts ImportOptions) (ImportReport, error) {
+	report, err := s.Service.ImportViews(ctx, r, opts)
+	if !report.DryRun && report.Imported > 0 {
+		s.windows.Notify(windows...)
+	}
+	return report, err
+}
@@ -0,0 +1,423 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"youtube_service/apierror"
+	"youtube_service/auth"
+	model "youtube_service/model"
+
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+)
+
+// the routes of MakeHandler are listed in apiOperations, the schemas of their bodies are generated from
+// the request and response types, openapi_test.go checks both against the router and the encoded responses
+
+// apiParam is a query, path or header parameter, schema is an OpenAPI type or a list of allowed strings
+type apiParam struct {
+	name        string
+	in          string
+	schema      interface{}
+	required    bool
+	description string
+}
+
+// apiContent is a body of an operation, value is a sample of its type when it is JSON
+type apiContent struct {
+	contentType string
+	value       interface{}
+	description string
+}
+
+type apiOperation struct {
+	method     string
+	path       string
+	summary    string
+	scope      string
+	deprecated bool
+	params     []apiParam
+	body       *apiContent
+	status     int
+	responses  []apiContent
+	notes      string
+}
+
+var (
+	limitParam   = apiParam{name: "limit", in: "query", schema: "integer", required: true, description: "number of videos"}
+	windowsParam = apiParam{name: "window", in: "query", schema: windows, description: "leaderboard window, lifetime by default"}
+	videoIDParam = apiParam{name: "id", in: "path", schema: "string", required: true, description: "video ID"}
+)
+
+var apiOperations = []apiOperation{
+	{method: "GET", path: "/viewVideo", summary: "Count a view of a video", scope: auth.ScopeIngest, deprecated: true,
+		params:    []apiParam{{name: "videoName", in: "query", schema: "string", required: true}},
+		responses: []apiContent{{contentType: contentTypeJSON, value: viewVideoResponse{}}}},
+	{method: "GET", path: "/getViews", summary: "Lifetime views of a video", scope: auth.ScopeRead, deprecated: true,
+		params:    []apiParam{{name: "videoName", in: "query", schema: "string", required: true}},
+		responses: []apiContent{{contentType: contentTypeJSON, value: getViewsResponse{}}}},
+	{method: "GET", path: "/getTopNvideos", summary: "Top videos of a window", scope: auth.ScopeRead, deprecated: true,
+		params:    []apiParam{limitParam, windowsParam},
+		responses: topNVideosContents(getTopNvideosResponse{})},
+	{method: "GET", path: "/getTopNvideosToday", summary: "Top videos of today", scope: auth.ScopeRead, deprecated: true,
+		params:    []apiParam{limitParam},
+		responses: topNVideosContents(getTopNVideosTodayResponse{})},
+	{method: "POST", path: "/postVideo", summary: "Add a video with no views", scope: auth.ScopeAdmin, deprecated: true,
+		body:      &apiContent{contentType: contentTypeJSON, value: postVideoBody{}},
+		responses: []apiContent{{contentType: contentTypeJSON, value: postVideoResponse{}}}},
+	{method: "POST", path: "/admin/import", summary: "Import view counts from a csv or ndjson file of videoID,views[,date] rows", scope: auth.ScopeAdmin,
+		params: []apiParam{
+			{name: "format", in: "query", schema: []string{FormatCSV, FormatNDJSON}, description: "taken from the Content-Type when not set"},
+			{name: "dryRun", in: "query", schema: "boolean", description: "only validate the file"},
+			{name: "resumeFrom", in: "query", schema: "integer", description: "first line to import"},
+			{name: "batchSize", in: "query", schema: "integer"},
+		},
+		body:      &apiContent{contentType: contentTypeCSV, description: "csv or ndjson rows"},
+		responses: []apiContent{{contentType: contentTypeJSON, value: importViewsBody{}}}},
+	{method: "GET", path: "/export", summary: "Stream a whole leaderboard", scope: auth.ScopeRead,
+		params: []apiParam{
+			{name: "window", in: "query", schema: []string{WindowLifetime, WindowToday}, description: "lifetime by default"},
+			{name: "format", in: "query", schema: []string{FormatCSV, FormatNDJSON}, description: "taken from the Accept header when not set"},
+		},
+		responses: []apiContent{
+			{contentType: contentTypeNDJSON, value: model.ResultRedis{}, description: "one video per line"},
+			{contentType: contentTypeCSV, description: "videoID,viewCount rows"},
+		}},
+	{method: "GET", path: "/videos/{id}/history", summary: "Views of a video per day or hour", scope: auth.ScopeRead,
+		params: []apiParam{
+			videoIDParam,
+			{name: "from", in: "query", schema: "string", description: "RFC 3339 time or date, 30 days or 24 hours before to by default"},
+			{name: "to", in: "query", schema: "string", description: "RFC 3339 time or date, now by default"},
+			{name: "granularity", in: "query", schema: []string{GranularityDay, GranularityHour}},
+		},
+		responses: []apiContent{{contentType: contentTypeJSON, value: getViewHistoryResponse{}}}},
+	{method: "GET", path: "/videos/stats", summary: "Lifetime views of videos and their ranks in a window", scope: auth.ScopeRead,
+		params: []apiParam{
+			{name: "id", in: "query", schema: "string", required: true, description: "video ID, repeated for every video, 500 at most"},
+			windowsParam,
+		},
+		responses: []apiContent{{contentType: contentTypeJSON, value: getVideoStatsResponse{}}}},
+	{method: "GET", path: "/leaderboard/changes", summary: "Rank changes between the two last snapshots of a window", scope: auth.ScopeRead,
+		params: []apiParam{
+			{name: "window", in: "query", schema: windows, description: "today by default"},
+			{name: "limit", in: "query", schema: "integer", description: "10 by default"},
+		},
+		responses: []apiContent{{contentType: contentTypeJSON, value: getLeaderboardDiffResponse{}}}},
+	{method: "GET", path: "/leaderboards/{window}/stream", summary: "Server-Sent Events of the top of a window, sent again on every change", scope: auth.ScopeRead,
+		params: []apiParam{
+			{name: "window", in: "path", schema: windows, required: true},
+			{name: "limit", in: "query", schema: "integer", description: "10 by default"},
+			{name: "Last-Event-ID", in: "header", schema: "string", description: "id of the last leaderboard event received"},
+		},
+		responses: []apiContent{{contentType: "text/event-stream", value: leaderboardResource{}, description: "leaderboard events"}}},
+	{method: "GET", path: "/videos/live", summary: "WebSocket of live view counters", scope: auth.ScopeRead, status: http.StatusSwitchingProtocols,
+		params: []apiParam{{name: "maxRate", in: "query", schema: "number", description: "messages per second at most"}},
+		notes:  `The client sends {"subscribe": [...], "unsubscribe": [...]} messages and gets {"counts": {...}} messages.`},
+	{method: "GET", path: "/admin/audit", summary: "Newest recorded mutations", scope: auth.ScopeAdmin,
+		params: []apiParam{
+			{name: "method", in: "query", schema: "string"},
+			{name: "videoName", in: "query", schema: "string"},
+			{name: "subject", in: "query", schema: "string"},
+			{name: "since", in: "query", schema: "string"},
+			{name: "until", in: "query", schema: "string"},
+			{name: "limit", in: "query", schema: "integer", description: "100 by default"},
+		},
+		responses: []apiContent{{contentType: contentTypeJSON, value: getAuditEntriesResponse{}}}},
+	{method: "POST", path: "/graphql", summary: "Execute a GraphQL query", scope: auth.ScopeRead,
+		body:      &apiContent{contentType: contentTypeJSON, value: graphQLRequest{}},
+		responses: graphQLContents,
+		notes:     graphQLNotes},
+	{method: "GET", path: "/graphql", summary: "Execute a GraphQL query", scope: auth.ScopeRead,
+		params: []apiParam{
+			{name: "query", in: "query", schema: "string", required: true},
+			{name: "operationName", in: "query", schema: "string"},
+			{name: "variables", in: "query", schema: "string", description: "JSON object"},
+		},
+		responses: graphQLContents,
+		notes:     graphQLNotes},
+	{method: "GET", path: "/graphql/schema", summary: "GraphQL schema of /graphql",
+		responses: []apiContent{{contentType: "text/plain", description: "SDL"}}},
+	{method: "GET", path: "/openapi.json", summary: "This document",
+		responses: []apiContent{{contentType: "application/json", value: map[string]interface{}{}}}},
+	{method: "GET", path: "/docs", summary: "Swagger UI of this document",
+		responses: []apiContent{{contentType: "text/html"}}},
+
+	{method: "POST", path: "/v2/videos", summary: "Add a video with no views", scope: auth.ScopeAdmin, status: http.StatusCreated,
+		body:      &apiContent{contentType: contentTypeJSON, value: v2PostVideoBody{}},
+		responses: []apiContent{{contentType: contentTypeJSON, value: v2Envelope{Data: videoResource{}}}}},
+	{method: "POST", path: "/v2/videos/{id}/views", summary: "Count a view of a video", scope: auth.ScopeIngest,
+		params:    []apiParam{videoIDParam},
+		responses: []apiContent{{contentType: contentTypeJSON, value: v2Envelope{Data: viewResource{}}}}},
+	{method: "GET", path: "/v2/videos/{id}", summary: "Lifetime views of a video", scope: auth.ScopeRead,
+		params:    []apiParam{videoIDParam},
+		responses: []apiContent{{contentType: contentTypeJSON, value: v2Envelope{Data: videoResource{}}}}},
+	{method: "GET", path: "/v2/leaderboards/{window}", summary: "Top videos of a window", scope: auth.ScopeRead,
+		params: []apiParam{
+			{name: "window", in: "path", schema: windows, required: true},
+			{name: "limit", in: "query", schema: "integer", description: "10 by default"},
+		},
+		responses: []apiContent{{contentType: contentTypeJSON, value: v2Envelope{Data: leaderboardResource{}}}}},
+}
+
+var (
+	graphQLContents = []apiContent{{contentType: contentTypeJSON, value: graphQLResponse{}}}
+	graphQLNotes    = "The queries rejected before their execution are answered 400 with the errors of a GraphQL response, the failed fields are null and their errors listed in a 200 response."
+)
+
+func topNVideosContents(response interface{}) []apiContent {
+	return []apiContent{
+		{contentType: contentTypeJSON, value: response},
+		{contentType: contentTypeColumnar, value: columnarRecords{}},
+		{contentType: contentTypeNDJSON, value: model.ResultRedis{}, description: "one video per line"},
+		{contentType: contentTypeCSV, description: "videoID,viewCount rows"},
+	}
+}
+
+// openAPIDocument returns the OpenAPI 3 document of apiOperations
+func openAPIDocument() map[string]interface{} {
+	schemas := map[string]interface{}{}
+	paths := map[string]interface{}{}
+	for _, op := range apiOperations {
+		item, _ := paths[op.path].(map[string]interface{})
+		if item == nil {
+			item = map[string]interface{}{}
+			paths[op.path] = item
+		}
+		item[strings.ToLower(op.method)] = op.document(schemas)
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "youtube_service",
+			"description": "View counts and leaderboards of videos. The RPC style routes are deprecated in favour of the /v2 resources.",
+			"version":     "2.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"apiKey": map[string]interface{}{"type": "apiKey", "in": "header", "name": auth.APIKeyHeader},
+			},
+		},
+	}
+}
+
+func (op apiOperation) document(schemas map[string]interface{}) map[string]interface{} {
+	doc := map[string]interface{}{
+		"summary":     op.summary,
+		"operationId": strings.ToLower(op.method) + strings.NewReplacer("/", "_", "{", "", "}", "").Replace(op.path),
+	}
+	if op.deprecated {
+		doc["deprecated"] = true
+	}
+	description := op.notes
+	if op.scope != "" {
+		description = strings.TrimSpace(description + " Needs the " + op.scope + " scope when authentication is enabled.")
+		doc["security"] = []interface{}{
+			map[string]interface{}{"bearer": []string{}},
+			map[string]interface{}{"apiKey": []string{}},
+		}
+	}
+	if description != "" {
+		doc["description"] = description
+	}
+	if len(op.params) > 0 {
+		var params []interface{}
+		for _, p := range op.params {
+			param := map[string]interface{}{"name": p.name, "in": p.in, "schema": paramSchema(p.schema)}
+			if p.required {
+				param["required"] = true
+			}
+			if p.description != "" {
+				param["description"] = p.description
+			}
+			params = append(params, param)
+		}
+		doc["parameters"] = params
+	}
+	if op.body != nil {
+		doc["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  contents([]apiContent{*op.body}, schemas),
+		}
+	}
+	status := op.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	if len(op.responses) > 0 {
+		success["content"] = contents(op.responses, schemas)
+	}
+	doc["responses"] = map[string]interface{}{
+		strconv.Itoa(status): success,
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content":     contents([]apiContent{{contentType: contentTypeJSON, value: apierror.Body{}}}, schemas),
+		},
+	}
+	return doc
+}
+
+func paramSchema(schema interface{}) map[string]interface{} {
+	if values, ok := schema.([]string); ok {
+		return map[string]interface{}{"type": "string", "enum": values}
+	}
+	return map[string]interface{}{"type": schema}
+}
+
+func contents(bodies []apiContent, schemas map[string]interface{}) map[string]interface{} {
+	content := map[string]interface{}{}
+	for _, body := range bodies {
+		schema := map[string]interface{}{"type": "string"}
+		if body.value != nil {
+			schema = schemaOf(reflect.ValueOf(body.value), schemas)
+		}
+		if body.description != "" {
+			if _, ok := schema["$ref"]; ok {
+				schema = map[string]interface{}{"allOf": []interface{}{schema}}
+			}
+			schema["description"] = body.description
+		}
+		content[strings.Split(body.contentType, ";")[0]] = map[string]interface{}{"schema": schema}
+	}
+	return content
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf returns the schema of the JSON encoding of v, the named structs are added to schemas and
+// referenced, the interface fields are described by their value in v
+func schemaOf(v reflect.Value, schemas map[string]interface{}) map[string]interface{} {
+	t := v.Type()
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return map[string]interface{}{}
+		}
+		return schemaOf(v.Elem(), schemas)
+	case reflect.Ptr:
+		schema := schemaOf(reflect.Zero(t.Elem()), schemas)
+		schema["nullable"] = true
+		return schema
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(reflect.Zero(t.Elem()), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(reflect.Zero(t.Elem()), schemas)}
+	case reflect.Struct:
+		return structSchema(v, schemas)
+	}
+	return map[string]interface{}{}
+}
+
+// graphQLResponse is the graphql.Response with the object of its data
+type graphQLResponse struct {
+	Errors []*gqlerrors.QueryError `json:"errors,omitempty"`
+	Data   map[string]interface{}  `json:"data,omitempty"`
+}
+
+// the structs of these packages are named after them, e.g. the GraphQL QueryError
+var schemaPrefixes = map[string]string{"github.com/graph-gophers/graphql-go/errors": "GraphQL"}
+
+// structSchema follows the field names and the omitempty options of encoding/json, the named structs
+// without interface fields are shared through components
+func structSchema(v reflect.Value, schemas map[string]interface{}) map[string]interface{} {
+	t := v.Type()
+	name := schemaPrefixes[t.PkgPath()] + strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+	shared := !hasInterfaceField(t)
+	if shared {
+		if _, ok := schemas[name]; ok {
+			return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+		}
+		//a placeholder so a recursive type refers to itself
+		schemas[name] = map[string]interface{}{}
+	}
+	properties := map[string]interface{}{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		key, options, _ := strings.Cut(tag, ",")
+		if key == "" {
+			key = field.Name
+		}
+		properties[key] = schemaOf(v.Field(i), schemas)
+		if !strings.Contains(options, "omitempty") {
+			required = append(required, key)
+		}
+	}
+	sort.Strings(required)
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	if !shared {
+		return schema
+	}
+	schemas[name] = schema
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+func hasInterfaceField(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.PkgPath == "" && f.Tag.Get("json") != "-" && f.Type.Kind() == reflect.Interface {
+			return true
+		}
+	}
+	return false
+}
+
+// makeOpenAPIHandler serves the document built once
+func makeOpenAPIHandler() http.Handler {
+	document, _ := json.Marshal(openAPIDocument())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(document)
+	})
+}
+
+// swaggerUI loads Swagger UI from a CDN and points it at /openapi.json
+const swaggerUI = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>youtube_service API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+func makeSwaggerUIHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(swaggerUI))
+	})
+}
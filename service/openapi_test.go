@@ -0,0 +1,218 @@
+package service
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"youtube_service/auth"
+	model "youtube_service/model"
+	"youtube_service/notify"
+	db "youtube_service/repository"
+	mockDb "youtube_service/repository/mock"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+)
+
+var routeVariablePattern = regexp.MustCompile(`{(\w+):[^}]+}`)
+
+func Test_openAPI_routes(t *testing.T) {
+	ctr := gomock.NewController(t)
+	router := makeRouter(NewService(mockDb.NewMockDatabase(ctr)), kitlog.NewNopLogger(), WithLiveCounts(notify.New(nil), 1), testAuthenticator(t))
+	routes := map[string]bool{}
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			//the path prefix of the v2 subrouter
+			return nil
+		}
+		//the patterns of the variables are not part of the documented paths
+		path = routeVariablePattern.ReplaceAllString(path, "{$1}")
+		for _, method := range methods {
+			routes[method+" "+path] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	documented := map[string]bool{}
+	for _, op := range apiOperations {
+		documented[op.method+" "+op.path] = true
+	}
+	for route := range routes {
+		if !documented[route] {
+			t.Errorf("route %s is not in apiOperations", route)
+		}
+	}
+	for route := range documented {
+		if !routes[route] {
+			t.Errorf("documented operation %s is not routed", route)
+		}
+	}
+}
+
+func Test_openAPI_responses(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	top := []model.ResultRedis{{VideoID: "video1", ViewCount: 5}}
+	newMockDB.EXPECT().IncreaseScore(gomock.Any(), "video1", float64(1)).Return(nil).AnyTimes()
+	newMockDB.EXPECT().GetScore(gomock.Any(), "video1").Return(float64(5), nil).AnyTimes()
+	newMockDB.EXPECT().GetScore(gomock.Any(), "video2").Return(float64(0), db.ErrUnknown).AnyTimes()
+	newMockDB.EXPECT().GetSortedRecords(gomock.Any(), gomock.Any(), gomock.Any()).Return(top, nil).AnyTimes()
+	newMockDB.EXPECT().Set(gomock.Any(), "video1", float64(0)).Return(nil).AnyTimes()
+	handler := MakeHandler(NewService(newMockDB), kitlog.NewNopLogger(), testAuthenticator(t))
+
+	var document map[string]interface{}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if err := json.Unmarshal(w.Body.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method string
+		target string
+		path   string
+		body   string
+		status int
+	}{
+		{method: "GET", target: "/viewVideo?videoName=video1", path: "/viewVideo", status: http.StatusOK},
+		{method: "GET", target: "/getViews?videoName=video1", path: "/getViews", status: http.StatusOK},
+		{method: "GET", target: "/getViews?videoName=video2", path: "/getViews", status: http.StatusNotFound},
+		{method: "GET", target: "/getViews", path: "/getViews", status: http.StatusBadRequest},
+		{method: "GET", target: "/getTopNvideos?limit=1", path: "/getTopNvideos", status: http.StatusOK},
+		{method: "GET", target: "/getTopNvideosToday?limit=1", path: "/getTopNvideosToday", status: http.StatusOK},
+		{method: "POST", target: "/postVideo", path: "/postVideo", body: `{"videoName": "video1"}`, status: http.StatusOK},
+		{method: "POST", target: "/admin/import?dryRun=true&format=csv", path: "/admin/import", body: "video1,5\nvideo3,x\n", status: http.StatusOK},
+		{method: "POST", target: "/v2/videos", path: "/v2/videos", body: `{"id": "video1"}`, status: http.StatusCreated},
+		{method: "POST", target: "/v2/videos/video1/views", path: "/v2/videos/{id}/views", status: http.StatusOK},
+		{method: "GET", target: "/v2/videos/video1", path: "/v2/videos/{id}", status: http.StatusOK},
+		{method: "GET", target: "/v2/videos/video2", path: "/v2/videos/{id}", status: http.StatusNotFound},
+		{method: "GET", target: "/v2/leaderboards/today", path: "/v2/leaderboards/{window}", status: http.StatusOK},
+		{method: "GET", target: "/v2/leaderboards/today?limit=x", path: "/v2/leaderboards/{window}", status: http.StatusBadRequest},
+		{method: "POST", target: "/graphql", path: "/graphql", body: `{"query": "{ leaderboard(limit: 1) { entries { rank video { id views } } } }"}`, status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			r.Header.Set(auth.APIKeyHeader, adminKey)
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			var body interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			responses := lookup(t, document, "paths", tt.path, strings.ToLower(tt.method), "responses").(map[string]interface{})
+			response, ok := responses[strconv.Itoa(tt.status)]
+			if !ok {
+				response = responses["default"]
+			}
+			schema := lookup(t, response.(map[string]interface{}), "content", "application/json", "schema")
+			checkSchema(t, document, schema.(map[string]interface{}), body, "body")
+		})
+	}
+}
+
+func lookup(t *testing.T, document map[string]interface{}, keys ...string) interface{} {
+	var value interface{} = document
+	for _, key := range keys {
+		object, ok := value.(map[string]interface{})
+		if !ok || object[key] == nil {
+			t.Fatalf("%s is not in the document", strings.Join(keys, "."))
+		}
+		value = object[key]
+	}
+	return value
+}
+
+// checkSchema checks that value has the types, properties and required properties of schema
+func checkSchema(t *testing.T, document, schema map[string]interface{}, value interface{}, path string) {
+	t.Helper()
+	if ref, ok := schema["$ref"].(string); ok {
+		keys := strings.Split(strings.TrimPrefix(ref, "#/"), "/")
+		schema = lookup(t, document, keys...).(map[string]interface{})
+	}
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, s := range all {
+			checkSchema(t, document, s.(map[string]interface{}), value, path)
+		}
+		return
+	}
+	if value == nil {
+		if schema["nullable"] != true && schema["type"] != nil {
+			t.Errorf("%s is null", path)
+		}
+		return
+	}
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			t.Errorf("%s = %v, want an object", path, value)
+			return
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		additional, _ := schema["additionalProperties"].(map[string]interface{})
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			switch property, ok := properties[key].(map[string]interface{}); {
+			case ok:
+				checkSchema(t, document, property, object[key], path+"."+key)
+			case additional != nil:
+				checkSchema(t, document, additional, object[key], path+"."+key)
+			default:
+				t.Errorf("%s.%s is not in the schema", path, key)
+			}
+		}
+		required, _ := schema["required"].([]interface{})
+		for _, key := range required {
+			if _, ok := object[key.(string)]; !ok {
+				t.Errorf("%s.%s is missing", path, key)
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			t.Errorf("%s = %v, want an array", path, value)
+			return
+		}
+		for i, item := range array {
+			checkSchema(t, document, schema["items"].(map[string]interface{}), item, path+"["+strconv.Itoa(i)+"]")
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			t.Errorf("%s = %v, want a string", path, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			t.Errorf("%s = %v, want a boolean", path, value)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			t.Errorf("%s = %v, want a number", path, value)
+		}
+	case "integer":
+		if n, ok := value.(float64); !ok || n != math.Trunc(n) {
+			t.Errorf("%s = %v, want an integer", path, value)
+		}
+	}
+}
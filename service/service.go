@@ -3,6 +3,8 @@ package service
 import (
 	"context"
 	"errors"
+	"io"
+	"time"
 	model "youtube_service/model"
 	db "youtube_service/repository"
 )
@@ -23,11 +25,37 @@ type Service interface {
 	//the returned array contains videoID and views
 	GetTopNVideos(ctx context.Context, n int, isLifeTime bool) ([]model.ResultRedis, error)
 
+	//GetTopNVideosInWindow returns the top N videos of a window, "lifetime", "today" or the rolling "24h" and "7d"
+	GetTopNVideosInWindow(ctx context.Context, n int, window string) ([]model.ResultRedis, error)
+
 	//getting the views for a particular video, this will return the total views any video have
 	GetViews(ctx context.Context, videoName string) (int, error)
 
 	//To add a new video PostVideo method will be used, it takes videoName and keeps the initial view count as zero
 	PostVideo(ctx context.Context, videoName string) error
+
+	//ImportViews seeds view counts from a csv or ndjson stream of videoID,views[,date] rows
+	//and returns a summary with the validation errors of every rejected line
+	ImportViews(ctx context.Context, r io.Reader, opts ImportOptions) (ImportReport, error)
+
+	//ExportVideos walks every video of the lifetime or today's leaderboard and calls each for it,
+	//the videos are not sorted and the whole leaderboard is never held in memory
+	ExportVideos(ctx context.Context, isLifeTime bool, each func(model.ResultRedis) error) error
+
+	//GetViewHistory returns the views of a video for every day or hour between from and to,
+	//granularity is "day" or "hour" and buckets without views are returned as zero
+	GetViewHistory(ctx context.Context, videoName string, from, to time.Time, granularity string) ([]model.HistoryPoint, error)
+
+	//GetLeaderboardDiff compares the top N of the two last snapshots of a window and returns
+	//the new entries, the climbers, the fallers and the drop-outs
+	GetLeaderboardDiff(ctx context.Context, window string, n int) (model.LeaderboardDiff, error)
+
+	//GetVideoStats returns the lifetime views of videos and their rank in window with one database round trip,
+	//the unknown videos are left out and ranks start at 1 or are 0 for the videos without views in window
+	GetVideoStats(ctx context.Context, videoNames []string, window string) ([]model.VideoStats, error)
+
+	//GetAuditEntries returns the newest recorded mutations matching filter, the audit log has to be enabled
+	GetAuditEntries(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, error)
 }
 
 // create a new service by injecting a DB client
@@ -37,19 +65,18 @@ func NewService(database db.Database) Service {
 	}
 }
 
-func (s *service) ViewVideo(ctx context.Context, videoName string) (err error) {
+func (s *service) ViewVideo(ctx context.Context, videoName string) error {
 	if videoName == "" {
 		return ErrInvalidArgument
 	}
-	s.increaseViewCount(ctx, videoName, 1)
-	return err
+	return s.increaseViewCount(ctx, videoName, 1)
 }
 
 func (s *service) GetTopNVideos(ctx context.Context, n int, isLifeTime bool) ([]model.ResultRedis, error) {
-	if n == 0 {
+	if n <= 0 {
 		return nil, ErrInvalidArgument
 	}
-	arrayResult, err := s.database.GetSortedRecords(n, isLifeTime)
+	arrayResult, err := s.database.GetSortedRecords(ctx, n, isLifeTime)
 	if err != nil {
 		return nil, err
 	}
@@ -60,7 +87,7 @@ func (s *service) GetViews(ctx context.Context, videoName string) (int, error) {
 	if videoName == "" {
 		return -1, ErrInvalidArgument
 	}
-	views, err := s.database.GetScore(videoName)
+	views, err := s.database.GetScore(ctx, videoName)
 	if err != nil {
 		return int(views), err
 	}
@@ -71,16 +98,30 @@ func (s *service) PostVideo(ctx context.Context, videoName string) error {
 	if videoName == "" {
 		return ErrInvalidArgument
 	}
-	err := s.database.Set(videoName, 0)
+	err := s.database.Set(ctx, videoName, 0)
 	return err
 }
 
+func (s *service) ExportVideos(ctx context.Context, isLifeTime bool, each func(model.ResultRedis) error) error {
+	return s.database.ScanRecords(ctx, isLifeTime, func(record model.ResultRedis) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return each(record)
+	})
+}
+
 // a function to increase a view count for a particular video
 func (s *service) increaseViewCount(ctx context.Context, videoName string, increaseBy float64) error {
 	if videoName == "" {
 		return ErrInvalidArgument
 	}
-	err := s.database.IncreaseScore(videoName, increaseBy)
+	var err error
+	if at, ok := viewTimeFromContext(ctx); ok {
+		err = s.database.IncreaseScoreAt(ctx, videoName, increaseBy, at)
+	} else {
+		err = s.database.IncreaseScore(ctx, videoName, increaseBy)
+	}
 	if err != nil {
 		return err
 	}
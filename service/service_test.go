@@ -2,13 +2,25 @@ package service
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+	"youtube_service/events"
+	"youtube_service/logging"
 	model "youtube_service/model"
+	"youtube_service/notify"
 	db "youtube_service/repository"
 	mockDb "youtube_service/repository/mock"
+	"youtube_service/validation"
 
+	kitlog "github.com/go-kit/kit/log"
 	"github.com/golang/mock/gomock"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func Test_service_ViewVideo(t *testing.T) {
@@ -18,7 +30,8 @@ func Test_service_ViewVideo(t *testing.T) {
 	// creating mock db
 	newMockDB := mockDb.NewMockDatabase(ctr)
 
-	newMockDB.EXPECT().IncreaseScore("video10", float64(1)).Times(1).Return(nil)
+	newMockDB.EXPECT().IncreaseScore(gomock.Any(), "video10", float64(1)).Times(1).Return(nil)
+	newMockDB.EXPECT().IncreaseScore(gomock.Any(), "video11", float64(1)).Times(1).Return(db.ErrUnavailable)
 
 	type fields struct {
 		database db.Database
@@ -39,6 +52,12 @@ func Test_service_ViewVideo(t *testing.T) {
 			args:    args{videoName: "video10"},
 			wantErr: false,
 		},
+		{
+			name:    "database error",
+			fields:  fields{database: newMockDB},
+			args:    args{videoName: "video11"},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -55,7 +74,7 @@ func Test_service_ViewVideo(t *testing.T) {
 func Test_service_GetTopNVideos(t *testing.T) {
 	ctr := gomock.NewController(t)
 	newMockDB := mockDb.NewMockDatabase(ctr)
-	newMockDB.EXPECT().GetSortedRecords(10, true).Times(1).Return([]model.ResultRedis{model.ResultRedis{VideoID: "video100", ViewCount: 104}}, nil)
+	newMockDB.EXPECT().GetSortedRecords(gomock.Any(), 10, true).Times(1).Return([]model.ResultRedis{model.ResultRedis{VideoID: "video100", ViewCount: 104}}, nil)
 	type fields struct {
 		database db.Database
 	}
@@ -78,6 +97,12 @@ func Test_service_GetTopNVideos(t *testing.T) {
 			want:    []model.ResultRedis{model.ResultRedis{VideoID: "video100", ViewCount: 104}},
 			wantErr: false,
 		},
+		{
+			name:    "negative limit",
+			fields:  fields{database: newMockDB},
+			args:    args{n: -1, isLifeTime: true},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -99,7 +124,7 @@ func Test_service_GetTopNVideos(t *testing.T) {
 func Test_service_GetViews(t *testing.T) {
 	ctr := gomock.NewController(t)
 	newMockDB := mockDb.NewMockDatabase(ctr)
-	newMockDB.EXPECT().GetScore("video500").Times(1).Return(float64(0), nil)
+	newMockDB.EXPECT().GetScore(gomock.Any(), "video500").Times(1).Return(float64(0), nil)
 
 	type fields struct {
 		database db.Database
@@ -143,7 +168,7 @@ func Test_service_GetViews(t *testing.T) {
 func Test_service_PostVideo(t *testing.T) {
 	ctr := gomock.NewController(t)
 	newMockDB := mockDb.NewMockDatabase(ctr)
-	newMockDB.EXPECT().Set("video500", float64(0)).Times(1)
+	newMockDB.EXPECT().Set(gomock.Any(), "video500", float64(0)).Times(1)
 	type fields struct {
 		database db.Database
 	}
@@ -175,3 +200,690 @@ func Test_service_PostVideo(t *testing.T) {
 		})
 	}
 }
+
+func Test_service_ImportViews(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	day := time.Date(2023, 6, 1, 0, 0, 0, 0, time.Local)
+	newMockDB.EXPECT().SetScores(gomock.Any(), []model.ViewRecord{
+		{VideoID: "video1", Views: 10},
+		{VideoID: "video2", Views: 5, Date: day},
+	}).Times(1).Return(nil)
+	newMockDB.EXPECT().SetScores(gomock.Any(), []model.ViewRecord{
+		{VideoID: "video3", Views: 7},
+	}).Times(1).Return(nil)
+
+	csvInput := "videoID,views,date\nvideo1,10\nvideo2,5,2023-06-01\n,4\nvideo3,7\n"
+	type fields struct {
+		database db.Database
+	}
+	type args struct {
+		input string
+		opts  ImportOptions
+	}
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    ImportReport
+		wantErr bool
+	}{
+		{
+			name:   "csv with an invalid line",
+			fields: fields{database: newMockDB},
+			args:   args{input: csvInput, opts: ImportOptions{Format: FormatCSV, BatchSize: 2}},
+			want: ImportReport{Processed: 4, Imported: 3, Failed: 1, LastLine: 5,
+				Errors: []ImportLineError{{Line: 4, Error: "videoID is empty"}}},
+		},
+		{
+			name:   "dry run does not write",
+			fields: fields{database: newMockDB},
+			args:   args{input: `{"videoID": "video1", "views": 10}` + "\n" + `{"videoID": "video2", "views": -1}`, opts: ImportOptions{Format: FormatNDJSON, DryRun: true}},
+			want: ImportReport{DryRun: true, Processed: 2, Imported: 1, Failed: 1, LastLine: 2,
+				Errors: []ImportLineError{{Line: 2, Error: `views "-1" is not a non-negative integer`}}},
+		},
+		{
+			name:   "resume skips earlier lines",
+			fields: fields{database: newMockDB},
+			args:   args{input: "video1,10\nvideo2,5\n", opts: ImportOptions{Format: FormatCSV, DryRun: true, ResumeFrom: 2}},
+			want:   ImportReport{DryRun: true, Processed: 1, Imported: 1, Skipped: 1, LastLine: 2},
+		},
+		{
+			name:    "unknown format",
+			fields:  fields{database: newMockDB},
+			args:    args{input: "", opts: ImportOptions{Format: "xml"}},
+			want:    ImportReport{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &service{
+				database: tt.fields.database,
+			}
+			got, err := s.ImportViews(context.Background(), strings.NewReader(tt.args.input), tt.args.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("service.ImportViews() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("service.ImportViews() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_service_ExportVideos(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	records := []model.ResultRedis{{VideoID: "video1", ViewCount: 3}, {VideoID: "video2", ViewCount: 8}}
+	newMockDB.EXPECT().ScanRecords(gomock.Any(), false, gomock.Any()).Times(1).DoAndReturn(
+		func(ctx context.Context, isLifeTime bool, each func(model.ResultRedis) error) error {
+			for _, record := range records {
+				if err := each(record); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+	s := &service{database: newMockDB}
+	var got []model.ResultRedis
+	err := s.ExportVideos(context.Background(), false, func(record model.ResultRedis) error {
+		got = append(got, record)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("service.ExportVideos() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, records) {
+		t.Errorf("service.ExportVideos() = %v, want %v", got, records)
+	}
+}
+
+func Test_service_GetViewHistory(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	day := func(d int) time.Time { return time.Date(2023, 6, d, 0, 0, 0, 0, time.Local) }
+	newMockDB.EXPECT().GetScoreHistory(gomock.Any(), "video10", []time.Time{day(1), day(2), day(3)}, false).
+		Times(1).Return([]float64{4, 0, 9}, nil)
+
+	type args struct {
+		from        time.Time
+		to          time.Time
+		granularity string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []model.HistoryPoint
+		wantErr bool
+	}{
+		{
+			name: "three days",
+			args: args{from: day(1).Add(10 * time.Hour), to: day(3).Add(time.Hour), granularity: GranularityDay},
+			want: []model.HistoryPoint{{Time: day(1), Views: 4}, {Time: day(2), Views: 0}, {Time: day(3), Views: 9}},
+		},
+		{
+			name:    "to before from",
+			args:    args{from: day(3), to: day(1), granularity: GranularityDay},
+			wantErr: true,
+		},
+		{
+			name:    "unknown granularity",
+			args:    args{from: day(1), to: day(3), granularity: "week"},
+			wantErr: true,
+		},
+		{
+			name:    "too many points",
+			args:    args{from: day(1), to: day(1).AddDate(0, 2, 0), granularity: GranularityHour},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &service{database: newMockDB}
+			got, err := s.GetViewHistory(context.Background(), "video10", tt.args.from, tt.args.to, tt.args.granularity)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("service.GetViewHistory() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("service.GetViewHistory() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_service_GetTopNVideosInWindow(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	top := []model.ResultRedis{{VideoID: "video100", ViewCount: 104}}
+	newMockDB.EXPECT().GetSortedRecords(gomock.Any(), 10, false).Times(1).Return(top, nil)
+	newMockDB.EXPECT().GetRollingRecords(gomock.Any(), Window7d, 10).Times(1).Return(top, nil)
+
+	tests := []struct {
+		name    string
+		n       int
+		window  string
+		want    []model.ResultRedis
+		wantErr bool
+	}{
+		{name: "today", n: 10, window: WindowToday, want: top},
+		{name: "rolling 7 days", n: 10, window: Window7d, want: top},
+		{name: "unknown window", n: 10, window: "1y", wantErr: true},
+		{name: "zero videos", n: 0, window: WindowLifetime, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &service{database: newMockDB}
+			got, err := s.GetTopNVideosInWindow(context.Background(), tt.n, tt.window)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("service.GetTopNVideosInWindow() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("service.GetTopNVideosInWindow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_service_GetVideoStats(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	stats := []model.VideoStats{{VideoID: "video1", ViewCount: 5, Rank: 2}}
+	newMockDB.EXPECT().GetScoresAndRanks(gomock.Any(), []string{"video1", "video2"}, Window24h).Times(1).Return(stats, nil)
+
+	tests := []struct {
+		name       string
+		videoNames []string
+		window     string
+		want       []model.VideoStats
+		wantErr    bool
+	}{
+		{name: "rolling 24 hours", videoNames: []string{"video1", "video2"}, window: Window24h, want: stats},
+		{name: "no videos", window: WindowLifetime, wantErr: true},
+		{name: "too many videos", videoNames: make([]string, maxVideoStats+1), window: WindowLifetime, wantErr: true},
+		{name: "empty video name", videoNames: []string{""}, window: WindowLifetime, wantErr: true},
+		{name: "unknown window", videoNames: []string{"video1"}, window: "1y", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &service{database: newMockDB}
+			got, err := s.GetVideoStats(context.Background(), tt.videoNames, tt.window)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("service.GetVideoStats() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("service.GetVideoStats() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_service_GetLeaderboardDiff(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	from, to := time.Unix(1000, 0), time.Unix(2000, 0)
+	previous := model.Snapshot{Window: WindowToday, TakenAt: from, Videos: []model.ResultRedis{
+		{VideoID: "a", ViewCount: 50}, {VideoID: "b", ViewCount: 40}, {VideoID: "c", ViewCount: 30}, {VideoID: "d", ViewCount: 20},
+	}}
+	current := model.Snapshot{Window: WindowToday, TakenAt: to, Videos: []model.ResultRedis{
+		{VideoID: "c", ViewCount: 90}, {VideoID: "a", ViewCount: 60}, {VideoID: "e", ViewCount: 45}, {VideoID: "b", ViewCount: 41},
+	}}
+	newMockDB.EXPECT().GetLastSnapshots(gomock.Any(), WindowToday).Times(1).Return([]model.Snapshot{current, previous}, nil)
+	newMockDB.EXPECT().GetLastSnapshots(gomock.Any(), Window24h).Times(1).Return([]model.Snapshot{current}, nil)
+
+	tests := []struct {
+		name    string
+		window  string
+		n       int
+		want    model.LeaderboardDiff
+		wantErr bool
+	}{
+		{
+			name:   "top 4 today",
+			window: WindowToday,
+			n:      4,
+			want: model.LeaderboardDiff{
+				Window:     WindowToday,
+				From:       from,
+				To:         to,
+				NewEntries: []model.RankChange{{VideoID: "e", Rank: 3, ViewCount: 45}},
+				Climbers:   []model.RankChange{{VideoID: "c", PreviousRank: 3, Rank: 1, Movement: 2, ViewCount: 90}},
+				Fallers: []model.RankChange{
+					{VideoID: "b", PreviousRank: 2, Rank: 4, Movement: -2, ViewCount: 41},
+					{VideoID: "a", PreviousRank: 1, Rank: 2, Movement: -1, ViewCount: 60},
+				},
+				DropOuts: []model.RankChange{{VideoID: "d", PreviousRank: 4, ViewCount: 20}},
+			},
+		},
+		{name: "single snapshot", window: Window24h, n: 4, wantErr: true},
+		{name: "unknown window", window: "1y", n: 4, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &service{database: newMockDB}
+			got, err := s.GetLeaderboardDiff(context.Background(), tt.window, tt.n)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("service.GetLeaderboardDiff() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("service.GetLeaderboardDiff() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_snapshotLeaderboards(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	now := time.Date(2026, 10, 19, 12, 7, 0, 0, time.UTC)
+	top := []model.ResultRedis{{VideoID: "video1", ViewCount: 5}}
+	//both instances ask for the interval starting at 12:05, only the first one gets it
+	gomock.InOrder(
+		newMockDB.EXPECT().Claim(gomock.Any(), "snapshots:1792411500", 10*time.Minute).Return(true, nil),
+		newMockDB.EXPECT().Claim(gomock.Any(), "snapshots:1792411500", 10*time.Minute).Return(false, nil),
+	)
+	newMockDB.EXPECT().GetSortedRecords(gomock.Any(), snapshotSize, true).Return(top, nil)
+	newMockDB.EXPECT().GetSortedRecords(gomock.Any(), snapshotSize, false).Return(top, nil)
+	newMockDB.EXPECT().GetRollingRecords(gomock.Any(), gomock.Any(), snapshotSize).Times(2).Return(nil, db.ErrHourlyBucketsDisabled)
+	newMockDB.EXPECT().SaveSnapshot(gomock.Any(), model.Snapshot{Window: WindowLifetime, TakenAt: now, Videos: top}).Return(nil)
+	newMockDB.EXPECT().SaveSnapshot(gomock.Any(), model.Snapshot{Window: WindowToday, TakenAt: now, Videos: top}).Return(nil)
+
+	snapshotLeaderboards(context.Background(), newMockDB, 5*time.Minute, now, kitlog.NewNopLogger())
+	snapshotLeaderboards(context.Background(), newMockDB, 5*time.Minute, now.Add(time.Minute), kitlog.NewNopLogger())
+}
+
+func Test_instrumentingService(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	newMockDB.EXPECT().IncreaseScore(gomock.Any(), "video10", float64(1)).Return(nil)
+	newMockDB.EXPECT().IncreaseScore(gomock.Any(), "video11", float64(1)).Return(db.ErrUnavailable)
+	newMockDB.EXPECT().GetRollingRecords(gomock.Any(), Window7d, 10).Return(nil, nil)
+
+	registry := stdprometheus.NewRegistry()
+	s := NewPrometheusInstrumentingService(registry, NewService(newMockDB))
+	s.ViewVideo(context.Background(), "video10")
+	s.ViewVideo(context.Background(), "video11")
+	s.GetTopNVideosInWindow(context.Background(), 10, Window7d)
+
+	want := `
+# HELP api_youtube_service_error_count Number of requests which returned an error.
+# TYPE api_youtube_service_error_count counter
+api_youtube_service_error_count{method="ViewVideo",window=""} 1
+# HELP api_youtube_service_request_count Number of requests received.
+# TYPE api_youtube_service_request_count counter
+api_youtube_service_request_count{method="GetTopNVideosInWindow",window="7d"} 1
+api_youtube_service_request_count{method="ViewVideo",window=""} 2
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want), "api_youtube_service_request_count", "api_youtube_service_error_count"); err != nil {
+		t.Error(err)
+	}
+	//the latencies vary, only the number of observations is checked
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	observations := map[string]uint64{}
+	for _, family := range families {
+		if family.GetName() != "api_youtube_service_request_latency_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := ""
+			for _, label := range metric.GetLabel() {
+				labels += label.GetName() + "=" + label.GetValue() + " "
+			}
+			observations[strings.TrimSpace(labels)] = metric.GetHistogram().GetSampleCount()
+		}
+	}
+	wantObservations := map[string]uint64{"method=GetTopNVideosInWindow window=7d": 1, "method=ViewVideo window=": 2}
+	if !reflect.DeepEqual(observations, wantObservations) {
+		t.Errorf("latency observations = %v, want %v", observations, wantObservations)
+	}
+}
+
+func Test_cachingService_GetTopNVideosInWindow(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	first := []model.ResultRedis{{VideoID: "video1", ViewCount: 5}}
+	second := []model.ResultRedis{{VideoID: "video2", ViewCount: 8}}
+	gomock.InOrder(
+		newMockDB.EXPECT().GetSortedRecords(gomock.Any(), 1, true).Times(1).Return(first, nil),
+		newMockDB.EXPECT().GetSortedRecords(gomock.Any(), 1, true).Times(1).Return(second, nil),
+		newMockDB.EXPECT().GetSortedRecords(gomock.Any(), 1, true).Times(1).Return(first, nil),
+	)
+	newMockDB.EXPECT().GetSortedRecords(gomock.Any(), 1, false).Times(1).Return(nil, db.ErrUnavailable)
+	newMockDB.EXPECT().GetSortedRecords(gomock.Any(), 1, false).Times(1).Return(second, nil)
+
+	now := time.Unix(1000, 0)
+	cache := NewCache(time.Second)
+	cache.now = func() time.Time { return now }
+	s := NewCachingService(cache, &service{database: newMockDB})
+
+	tests := []struct {
+		name       string
+		window     string
+		elapsed    time.Duration
+		invalidate string
+		want       []model.ResultRedis
+		wantErr    bool
+	}{
+		{name: "loads on a miss", window: WindowLifetime, want: first},
+		{name: "hit before the ttl", window: WindowLifetime, elapsed: 500 * time.Millisecond, want: first},
+		{name: "reloads after the ttl", window: WindowLifetime, elapsed: time.Second, want: second},
+		{name: "other windows are kept", window: WindowLifetime, invalidate: WindowToday, want: second},
+		{name: "reloads an invalidated window", window: WindowLifetime, invalidate: WindowLifetime, want: first},
+		{name: "errors are not cached", window: WindowToday, wantErr: true},
+		{name: "loads after an error", window: WindowToday, want: second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.elapsed)
+			if tt.invalidate != "" {
+				cache.Invalidate(tt.invalidate)
+			}
+			got, err := s.GetTopNVideosInWindow(context.Background(), 1, tt.window)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("cachingService.GetTopNVideosInWindow() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cachingService.GetTopNVideosInWindow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_cachingService_singleflight(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	release := make(chan struct{})
+	newMockDB.EXPECT().GetSortedRecords(gomock.Any(), 10, true).Times(1).DoAndReturn(
+		func(context.Context, int, bool) ([]model.ResultRedis, error) {
+			<-release
+			return []model.ResultRedis{{VideoID: "video1", ViewCount: 5}}, nil
+		})
+	s := NewCachingService(NewCache(time.Minute), &service{database: newMockDB})
+
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := s.GetTopNVideos(context.Background(), 10, true)
+			errs <- err
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("cachingService.GetTopNVideos() error = %v", err)
+		}
+	}
+}
+
+func Test_cacheableEncoder(t *testing.T) {
+	encode := cacheableEncoder(2*time.Second, encodeTopNVideosResponse)
+	response := getTopNvideosResponse{TopVideos: []model.ResultRedis{{VideoID: "video1", ViewCount: 5}}}
+
+	rec := httptest.NewRecorder()
+	if err := encode(context.Background(), rec, response); err != nil {
+		t.Fatal(err)
+	}
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" || rec.Header().Get("Cache-Control") != "public, max-age=2" {
+		t.Fatalf("first response = %d %v", rec.Code, rec.Header())
+	}
+
+	ctx := context.WithValue(context.Background(), ifNoneMatchKey, `"other", `+etag)
+	rec = httptest.NewRecorder()
+	if err := encode(ctx, rec, response); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("revalidation = %d with %d bytes, want 304 without a body", rec.Code, rec.Body.Len())
+	}
+
+	rec = httptest.NewRecorder()
+	encode(context.Background(), rec, getTopNvideosResponse{Err: ErrInvalidArgument})
+	if rec.Code != http.StatusBadRequest || rec.Header().Get("ETag") != "" {
+		t.Errorf("error response = %d %v", rec.Code, rec.Header())
+	}
+}
+
+type memoryAuditLog struct {
+	entries []model.AuditEntry
+}
+
+func (l *memoryAuditLog) Append(ctx context.Context, entry model.AuditEntry) error {
+	l.entries = append(l.entries, entry)
+	return nil
+}
+
+func (l *memoryAuditLog) Query(ctx context.Context, filter model.AuditFilter) ([]model.AuditEntry, error) {
+	return l.entries, nil
+}
+
+func Test_auditingService(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	gomock.InOrder(
+		newMockDB.EXPECT().GetScore(gomock.Any(), "video1").Return(float64(42), nil),
+		newMockDB.EXPECT().Set(gomock.Any(), "video1", float64(0)).Return(nil),
+		newMockDB.EXPECT().GetScore(gomock.Any(), "video1").Return(float64(0), nil),
+	)
+	newMockDB.EXPECT().IncreaseScore(gomock.Any(), "video2", float64(1)).Times(2).Return(nil)
+	gomock.InOrder(
+		newMockDB.EXPECT().GetScore(gomock.Any(), "video2").Return(float64(0), db.ErrUnknown),
+		newMockDB.EXPECT().GetScore(gomock.Any(), "video2").Return(float64(1), nil),
+	)
+
+	log := &memoryAuditLog{}
+	s := NewAuditingService(log, newMockDB, 0.5, kitlog.NewNopLogger(), &service{database: newMockDB}).(*auditingService)
+	samples := []float64{0.9, 0.1}
+	s.sample = func() float64 {
+		sample := samples[0]
+		samples = samples[1:]
+		return sample
+	}
+
+	ctx := logging.ContextWithRequestID(context.Background(), "req-1")
+	if err := s.PostVideo(ctx, "video1"); err != nil {
+		t.Fatal(err)
+	}
+	//the first view is not sampled
+	for i := 0; i < 2; i++ {
+		if err := s.ViewVideo(ctx, "video2"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []model.AuditEntry{
+		{Method: "PostVideo", VideoID: "video1", RequestID: "req-1", Before: 42, After: 0, SampleRate: 1},
+		{Method: "ViewVideo", VideoID: "video2", RequestID: "req-1", Before: 0, After: 1, SampleRate: 0.5},
+	}
+	for i := range log.entries {
+		if log.entries[i].Time.IsZero() {
+			t.Errorf("entry %d has no time", i)
+		}
+		log.entries[i].Time = time.Time{}
+	}
+	if !reflect.DeepEqual(log.entries, want) {
+		t.Errorf("audit entries = %+v, want %+v", log.entries, want)
+	}
+
+	if _, err := NewService(newMockDB).GetAuditEntries(ctx, model.AuditFilter{}); err != ErrAuditDisabled {
+		t.Errorf("GetAuditEntries() without an audit log error = %v, want ErrAuditDisabled", err)
+	}
+}
+
+func Test_notifyingService(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	newMockDB.EXPECT().IncreaseScore(gomock.Any(), "video1", float64(1)).Return(nil)
+	newMockDB.EXPECT().IncreaseScore(gomock.Any(), "video2", float64(1)).Return(db.ErrUnavailable)
+
+	notifier := notify.New(nil)
+	today, cancelToday := notifier.Subscribe(WindowToday)
+	defer cancelToday()
+	rolling, cancelRolling := notifier.Subscribe(Window24h)
+	defer cancelRolling()
+	videos := notify.New(nil)
+	video1, cancelVideo1 := videos.Subscribe("video1")
+	defer cancelVideo1()
+	s := NewNotifyingService(notifier, videos, &service{database: newMockDB})
+
+	if err := s.ViewVideo(context.Background(), "video1"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-today:
+	default:
+		t.Error("a view did not notify today's leaderboard")
+	}
+	select {
+	case <-video1:
+	default:
+		t.Error("a view did not notify the video")
+	}
+	select {
+	case <-rolling:
+		t.Error("a view notified the rolling leaderboard")
+	default:
+	}
+	//failed views change nothing
+	s.ViewVideo(context.Background(), "video2")
+	select {
+	case <-today:
+		t.Error("a failed view notified today's leaderboard")
+	default:
+	}
+}
+
+// channelSender hands the sent events to a channel
+type channelSender chan events.Event
+
+func (s channelSender) Send(ctx context.Context, batch []events.Event) error {
+	for _, event := range batch {
+		s <- event
+	}
+	return nil
+}
+
+func Test_publishingService(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	newMockDB.EXPECT().IncreaseScore(gomock.Any(), "video1", float64(1)).Return(nil)
+	newMockDB.EXPECT().IncreaseScore(gomock.Any(), "video2", float64(1)).Return(db.ErrUnavailable)
+	newMockDB.EXPECT().Set(gomock.Any(), "video3", float64(0)).Return(nil)
+
+	sent := make(channelSender, 10)
+	publisher := events.NewPublisher(sent, events.NewMemoryOutbox(10), nil, events.PublisherOptions{
+		BatchSize:     1,
+		FlushInterval: time.Second,
+		BufferSize:    10,
+		RetryInterval: time.Hour,
+		Timeout:       time.Second,
+	}, kitlog.NewNopLogger())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go publisher.Run(ctx)
+	s := NewPublishingService(publisher, &service{database: newMockDB})
+
+	ctx = logging.ContextWithRequestID(ctx, "req-1")
+	if err := s.ViewVideo(ctx, "video1"); err != nil {
+		t.Fatal(err)
+	}
+	//failed views are not published
+	s.ViewVideo(ctx, "video2")
+	if err := s.PostVideo(ctx, "video3"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []events.Event{
+		{Type: events.TypeView, VideoID: "video1", RequestID: "req-1"},
+		{Type: events.TypeVideoPosted, VideoID: "video3", RequestID: "req-1"},
+	} {
+		select {
+		case got := <-sent:
+			if got.ID == "" || got.Time.IsZero() {
+				t.Errorf("event %+v has no id or time", got)
+			}
+			got.ID, got.Time = "", time.Time{}
+			if got != want {
+				t.Errorf("event = %+v, want %+v", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %+v was not sent", want)
+		}
+	}
+}
+
+func Test_ViewEventHandler(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	yesterday := time.Now().Add(-24 * time.Hour)
+	claimed := map[string]bool{}
+	newMockDB.EXPECT().Claim(gomock.Any(), gomock.Any(), time.Hour).AnyTimes().DoAndReturn(func(_ context.Context, name string, _ time.Duration) (bool, error) {
+		if claimed[name] {
+			return false, nil
+		}
+		claimed[name] = true
+		return true, nil
+	})
+	newMockDB.EXPECT().Release(gomock.Any(), "events:2").DoAndReturn(func(ctx context.Context, name string) error {
+		//the claim is released after the context of the event is done
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		delete(claimed, name)
+		return nil
+	})
+	newMockDB.EXPECT().Release(gomock.Any(), "events:4").Return(db.ErrUnavailable)
+	//the view of an event is counted on the day it was made, once
+	newMockDB.EXPECT().IncreaseScoreAt(gomock.Any(), "video1", float64(1), yesterday).Times(1).Return(nil)
+	gomock.InOrder(
+		newMockDB.EXPECT().IncreaseScoreAt(gomock.Any(), "video2", float64(1), yesterday).Return(db.ErrUnavailable),
+		newMockDB.EXPECT().IncreaseScoreAt(gomock.Any(), "video2", float64(1), yesterday).Return(nil),
+	)
+	newMockDB.EXPECT().IncreaseScore(gomock.Any(), "video3", float64(1)).Return(nil)
+	newMockDB.EXPECT().IncreaseScoreAt(gomock.Any(), "video4", float64(1), yesterday).Return(db.ErrUnavailable)
+	videoIDs, _ := validation.New(validation.Rules{Trim: true, FoldCase: true})
+	handle := ViewEventHandler(&service{database: newMockDB}, newMockDB, videoIDs, time.Hour)
+
+	tests := []struct {
+		name    string
+		event   events.Event
+		wantErr error
+	}{
+		//the video IDs are normalised like the ones of the requests
+		{name: "applied", event: events.Event{ID: "1", VideoID: " Video1 ", Time: yesterday}},
+		{name: "delivered twice", event: events.Event{ID: "1", VideoID: "video1", Time: yesterday}, wantErr: events.ErrDuplicate},
+		{name: "failed", event: events.Event{ID: "2", VideoID: "video2", Time: yesterday}, wantErr: db.ErrUnavailable},
+		{name: "failed delivered again", event: events.Event{ID: "2", VideoID: "video2", Time: yesterday}},
+		{name: "without an ID or a time", event: events.Event{VideoID: "video3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.wantErr == db.ErrUnavailable {
+				cancel()
+			}
+			defer cancel()
+			if err := handle(ctx, tt.event); err != tt.wantErr {
+				t.Errorf("handle() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+	if err := handle(context.Background(), events.Event{ID: "4", VideoID: "video4", Time: yesterday}); !errors.Is(err, db.ErrUnavailable) || !strings.Contains(err.Error(), "stays claimed") {
+		t.Errorf("handle() with a failing release = %v, want the view and the release errors", err)
+	}
+	var invalid *validation.Error
+	if err := handle(context.Background(), events.Event{ID: "3", VideoID: "  "}); !errors.As(err, &invalid) {
+		t.Errorf("handle(empty) = %v, want a permanent validation error", err)
+	}
+}
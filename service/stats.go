@@ -0,0 +1,21 @@
+package service
+
+import (
+	"context"
+	model "youtube_service/model"
+)
+
+// most videos a single stats request can ask for
+const maxVideoStats = 500
+
+func (s *service) GetVideoStats(ctx context.Context, videoNames []string, window string) ([]model.VideoStats, error) {
+	if len(videoNames) == 0 || len(videoNames) > maxVideoStats || !isValidWindow(window) {
+		return nil, ErrInvalidArgument
+	}
+	for _, videoName := range videoNames {
+		if videoName == "" {
+			return nil, ErrInvalidArgument
+		}
+	}
+	return s.database.GetScoresAndRanks(ctx, videoNames, window)
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+	model "youtube_service/model"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "youtube_service/service"
+
+type tracingService struct {
+	tracer trace.Tracer
+	Service
+}
+
+// NewTracingService returns a new instance of a tracing Service, every call gets a span
+// which is a child of the span in the context
+func NewTracingService(s Service) Service {
+	return &tracingService{otel.Tracer(tracerName), s}
+}
+
+func (s *tracingService) start(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return s.tracer.Start(ctx, "Service."+method, trace.WithAttributes(attrs...))
+}
+
+func finishSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (s *tracingService) ViewVideo(ctx context.Context, videoName string) (err error) {
+	ctx, span := s.start(ctx, "ViewVideo", attribute.String("videoName", videoName))
+	defer func() { finishSpan(span, err) }()
+	return s.Service.ViewVideo(ctx, videoName)
+}
+
+func (s *tracingService) GetTopNVideos(ctx context.Context, n int, isLifeTime bool) (arraylist []model.ResultRedis, err error) {
+	ctx, span := s.start(ctx, "GetTopNVideos", attribute.Int("n", n), attribute.String("window", lifeTimeWindow(isLifeTime)))
+	defer func() { finishSpan(span, err) }()
+	return s.Service.GetTopNVideos(ctx, n, isLifeTime)
+}
+
+func (s *tracingService) GetTopNVideosInWindow(ctx context.Context, n int, window string) (arraylist []model.ResultRedis, err error) {
+	ctx, span := s.start(ctx, "GetTopNVideosInWindow", attribute.Int("n", n), attribute.String("window", window))
+	defer func() { finishSpan(span, err) }()
+	return s.Service.GetTopNVideosInWindow(ctx, n, window)
+}
+
+func (s *tracingService) GetViews(ctx context.Context, videoName string) (views int, err error) {
+	ctx, span := s.start(ctx, "GetViews", attribute.String("videoName", videoName))
+	defer func() { finishSpan(span, err) }()
+	return s.Service.GetViews(ctx, videoName)
+}
+
+func (s *tracingService) PostVideo(ctx context.Context, videoName string) (err error) {
+	ctx, span := s.start(ctx, "PostVideo", attribute.String("videoName", videoName))
+	defer func() { finishSpan(span, err) }()
+	return s.Service.PostVideo(ctx, videoName)
+}
+
+func (s *tracingService) ImportViews(ctx context.Context, r io.Reader, opts ImportOptions) (report ImportReport, err error) {
+	ctx, span := s.start(ctx, "ImportViews", attribute.String("format", opts.Format), attribute.Bool("dryRun", opts.DryRun))
+	defer func() {
+		span.SetAttributes(attribute.Int("processed", report.Processed), attribute.Int("failed", report.Failed))
+		finishSpan(span, err)
+	}()
+	return s.Service.ImportViews(ctx, r, opts)
+}
+
+func (s *tracingService) ExportVideos(ctx context.Context, isLifeTime bool, each func(model.ResultRedis) error) (err error) {
+	ctx, span := s.start(ctx, "ExportVideos", attribute.String("window", lifeTimeWindow(isLifeTime)))
+	defer func() { finishSpan(span, err) }()
+	return s.Service.ExportVideos(ctx, isLifeTime, each)
+}
+
+func (s *tracingService) GetViewHistory(ctx context.Context, videoName string, from, to time.Time, granularity string) (history []model.HistoryPoint, err error) {
+	ctx, span := s.start(ctx, "GetViewHistory", attribute.String("videoName", videoName), attribute.String("granularity", granularity))
+	defer func() { finishSpan(span, err) }()
+	return s.Service.GetViewHistory(ctx, videoName, from, to, granularity)
+}
+
+func (s *tracingService) GetLeaderboardDiff(ctx context.Context, window string, n int) (diff model.LeaderboardDiff, err error) {
+	ctx, span := s.start(ctx, "GetLeaderboardDiff", attribute.String("window", window), attribute.Int("n", n))
+	defer func() { finishSpan(span, err) }()
+	return s.Service.GetLeaderboardDiff(ctx, window, n)
+}
+
+func (s *tracingService) GetVideoStats(ctx context.Context, videoNames []string, window string) (stats []model.VideoStats, err error) {
+	ctx, span := s.start(ctx, "GetVideoStats", attribute.Int("videos", len(videoNames)), attribute.String("window", window))
+	defer func() { finishSpan(span, err) }()
+	return s.Service.GetVideoStats(ctx, videoNames, window)
+}
+
+func (s *tracingService) GetAuditEntries(ctx context.Context, filter model.AuditFilter) (entries []model.AuditEntry, err error) {
+	ctx, span := s.start(ctx, "GetAuditEntries", attribute.String("method", filter.Method), attribute.Int("limit", filter.Limit))
+	defer func() { finishSpan(span, err) }()
+	return s.Service.GetAuditEntries(ctx, filter)
+}
+
+// startServerSpan continues the trace of the W3C headers of an incoming request in a span named after its route
+func startServerSpan(ctx context.Context, r *http.Request) context.Context {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(r.Header))
+	route := r.URL.Path
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			route = template
+		}
+	}
+	ctx, _ = otel.Tracer(tracerName).Start(ctx, r.Method+" "+route,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(semconv.HTTPMethod(r.Method), semconv.HTTPRoute(route)),
+	)
+	return ctx
+}
+
+func finishServerSpan(ctx context.Context, code int, r *http.Request) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(semconv.HTTPStatusCode(code))
+	if code >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(code))
+	}
+	span.End()
+}
+
+// startClientSpan starts a span for an outgoing request and injects it in the W3C headers
+func startClientSpan(ctx context.Context, r *http.Request) context.Context {
+	ctx, _ = otel.Tracer(tracerName).Start(ctx, r.Method+" "+r.URL.Path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPMethod(r.Method), semconv.HTTPURL(r.URL.String())),
+	)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(r.Header))
+	return ctx
+}
+
+func finishClientSpan(ctx context.Context, err error) {
+	finishSpan(trace.SpanFromContext(ctx), err)
+}
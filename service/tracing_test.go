@@ -0,0 +1,126 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	db "youtube_service/repository"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newRedisServer answers every command of a redis client at the returned address with reply
+func newRedisServer(t *testing.T, reply string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					var n int
+					if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil {
+						return
+					}
+					for i := 0; i < n; i++ {
+						var size int
+						if _, err := fmt.Fscanf(r, "$%d\r\n", &size); err != nil {
+							return
+						}
+						if _, err := io.CopyN(io.Discard, r, int64(size+2)); err != nil {
+							return
+						}
+					}
+					fmt.Fprint(conn, reply)
+				}
+			}()
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return listener.Addr().String()
+}
+
+func Test_tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	client := redis.NewClient(&redis.Options{Addr: newRedisServer(t, "$1\r\n5\r\n")})
+	client.AddHook(db.NewTracingHook())
+	defer client.Close()
+	handler := makeRouter(NewTracingService(NewService(db.NewRedis(client, "videos", false))), kitlog.NewNopLogger())
+
+	req := httptest.NewRequest("GET", "/getViews?videoName=video1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	server, ok := spans["GET /getViews"]
+	if !ok {
+		t.Fatalf("no server span in %v", spans)
+	}
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	remoteID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	if server.SpanContext().TraceID() != traceID || server.Parent().SpanID() != remoteID || !server.Parent().IsRemote() {
+		t.Errorf("server span continues %v, want the trace of the traceparent header", server.Parent())
+	}
+	if server.SpanKind() != trace.SpanKindServer {
+		t.Errorf("server span kind = %v", server.SpanKind())
+	}
+
+	tests := []struct {
+		name   string
+		parent sdktrace.ReadOnlySpan
+		kind   trace.SpanKind
+	}{
+		{name: "Service.GetViews", parent: server, kind: trace.SpanKindInternal},
+		{name: "redis zscore", parent: spans["Service.GetViews"], kind: trace.SpanKindClient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span, ok := spans[tt.name]
+			if !ok || tt.parent == nil {
+				t.Fatalf("missing spans in %v", spans)
+			}
+			if span.SpanContext().TraceID() != traceID {
+				t.Errorf("trace ID = %v, want %v", span.SpanContext().TraceID(), traceID)
+			}
+			if span.Parent().SpanID() != tt.parent.SpanContext().SpanID() {
+				t.Errorf("parent = %v, want %s", span.Parent().SpanID(), tt.parent.Name())
+			}
+			if span.SpanKind() != tt.kind {
+				t.Errorf("span kind = %v, want %v", span.SpanKind(), tt.kind)
+			}
+		})
+	}
+}
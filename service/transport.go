@@ -3,71 +3,294 @@ package service
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
+	"youtube_service/apierror"
+	"youtube_service/auth"
+	"youtube_service/idempotency"
+	"youtube_service/logging"
 	model "youtube_service/model"
+	"youtube_service/notify"
+	"youtube_service/ratelimit"
 	db "youtube_service/repository"
+	"youtube_service/validation"
 
 	"github.com/gorilla/mux"
 
+	"github.com/go-kit/kit/endpoint"
 	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 	"github.com/go-kit/kit/transport"
 	kithttp "github.com/go-kit/kit/transport/http"
 )
 
 var errBadRoute, errInvalidRequest = errors.New("bad route"), errors.New("invalid request type")
 
+var errMethodNotAllowed = errors.New("method not allowed")
+
+var errNotAcceptable = errors.New("none of the accepted media types is served")
+
+// HandlerOption sets an optional layer of the handler
+type HandlerOption func(*handlerOptions)
+
+type handlerOptions struct {
+	limiter       *ratelimit.Limiter
+	cacheMaxAge   time.Duration
+	authenticator *auth.Authenticator
+	validator     *validation.Validator
+	idempotency   idempotency.Store
+	idempotentTTL time.Duration
+	notifier      *notify.Notifier
+	// the live view counters are only served with a notifier of the videos
+	liveCounts        *notify.Notifier
+	liveCountsMaxRate float64
+}
+
+// idempotent replays the responses of the retried writes when there is an idempotency store
+func (o handlerOptions) idempotent(h http.Handler) http.Handler {
+	if o.idempotency == nil {
+		return h
+	}
+	return idempotency.HTTPMiddleware(o.idempotency, o.idempotentTTL, h)
+}
+
+func newHandlerOptions(options []HandlerOption) handlerOptions {
+	var ho handlerOptions
+	for _, option := range options {
+		option(&ho)
+	}
+	if ho.validator == nil {
+		ho.validator, _ = validation.New(validation.Rules{})
+	}
+	return ho
+}
+
+// chain normalises the video IDs of e and lets through the requests granted scope
+func (o handlerOptions) chain(scope string, e endpoint.Endpoint) endpoint.Endpoint {
+	return o.authorize(scope, validateVideoIDs(o.validator)(e))
+}
+
+// authorize lets through the requests granted scope, every request goes through without an authenticator
+func (o handlerOptions) authorize(scope string, e endpoint.Endpoint) endpoint.Endpoint {
+	if o.authenticator == nil {
+		return e
+	}
+	return o.authenticator.Middleware(scope)(e)
+}
+
+// WithRateLimiter limits the view ingestion per API key, per client IP and per video
+func WithRateLimiter(limiter *ratelimit.Limiter) HandlerOption {
+	return func(o *handlerOptions) { o.limiter = limiter }
+}
+
+// WithCacheMaxAge lets the clients and the CDNs keep the leaderboards for maxAge
+func WithCacheMaxAge(maxAge time.Duration) HandlerOption {
+	return func(o *handlerOptions) { o.cacheMaxAge = maxAge }
+}
+
+// WithAuthenticator asks for a JWT or an API key with the read scope for the reads,
+// the ingest scope for the views and the admin scope for new videos and imports,
+// the admin routes and the v2 writes are only served with it
+func WithAuthenticator(authenticator *auth.Authenticator) HandlerOption {
+	return func(o *handlerOptions) { o.authenticator = authenticator }
+}
+
+// WithVideoIDValidator normalises and validates the video IDs with v instead of the default rules
+func WithVideoIDValidator(v *validation.Validator) HandlerOption {
+	return func(o *handlerOptions) { o.validator = v }
+}
+
+// WithIdempotency runs the views, new videos and imports with an Idempotency-Key once,
+// their responses are kept in store and replayed to the retries for ttl
+func WithIdempotency(store idempotency.Store, ttl time.Duration) HandlerOption {
+	return func(o *handlerOptions) {
+		o.idempotency = store
+		o.idempotentTTL = ttl
+	}
+}
+
+// WithNotifier pushes the live leaderboards as soon as notifier is told about their changes,
+// they are polled every cache max age without it
+func WithNotifier(notifier *notify.Notifier) HandlerOption {
+	return func(o *handlerOptions) { o.notifier = notifier }
+}
+
+// WithLiveCounts serves the live view counters of the videos notifier is told about,
+// a connection gets at most maxRate updates per second
+func WithLiveCounts(notifier *notify.Notifier, maxRate float64) HandlerOption {
+	return func(o *handlerOptions) {
+		o.liveCounts = notifier
+		o.liveCountsMaxRate = maxRate
+	}
+}
+
 // creating handlers for all the endpoints
-func MakeHandler(s Service, logger kitlog.Logger) http.Handler {
+func MakeHandler(s Service, logger kitlog.Logger, options ...HandlerOption) http.Handler {
+	return logging.RequestIDMiddleware(makeRouter(s, logger, options...))
+}
+
+// makeRouter routes the endpoints, the routes are documented in apiOperations
+func makeRouter(s Service, logger kitlog.Logger, options ...HandlerOption) *mux.Router {
+	ho := newHandlerOptions(options)
 	opts := []kithttp.ServerOption{
-		kithttp.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		kithttp.ServerErrorHandler(transport.ErrorHandlerFunc(func(ctx context.Context, err error) {
+			level.Error(logging.WithContext(ctx, logger)).Log("err", err)
+		})),
 		kithttp.ServerErrorEncoder(encodeError),
+		kithttp.ServerBefore(kithttp.PopulateRequestContext, populateIfNoneMatch, auth.HTTPToContext(), startServerSpan),
+		kithttp.ServerFinalizer(finishServerSpan),
+	}
+	viewVideoEndpoint := MakeViewVideoEndpoint(s)
+	if ho.limiter != nil {
+		viewVideoEndpoint = ho.limiter.EndpointMiddleware(videoOfViewRequest)(viewVideoEndpoint)
 	}
-	viewVideoHandler := kithttp.NewServer(
-		MakeViewVideoEndpoint(s),
+	viewVideoEndpoint = ho.chain(auth.ScopeIngest, viewVideoEndpoint)
+	getViewsEndpoint := ho.chain(auth.ScopeRead, MakeGetViewsEndpoint(s))
+	getTopNVideosEndpoint := ho.chain(auth.ScopeRead, MakeGetTopNVideosEndpoint(s))
+	postVideoEndpoint := ho.chain(auth.ScopeAdmin, MakePostVideoEndpoint(s))
+	var viewVideoHandler http.Handler = kithttp.NewServer(
+		viewVideoEndpoint,
 		decodeViewVideoRequest,
 		encodeResponse,
 		opts...,
 	)
+	if ho.limiter != nil {
+		viewVideoHandler = ho.limiter.HTTPMiddleware(viewVideoHandler)
+	}
+	viewVideoHandler = ho.idempotent(viewVideoHandler)
 	GetViewsHandler := kithttp.NewServer(
-		MakeGetViewsEndpoint(s),
+		getViewsEndpoint,
 		decodeGetViewsRequest,
 		encodeResponse,
 		opts...,
 	)
 	GetTopNVideosHandler := kithttp.NewServer(
-		MakeGetTopNVideosEndpoint(s),
+		getTopNVideosEndpoint,
 		decodeGetNvideosRequest,
-		encodeResponse,
+		cacheableEncoder(ho.cacheMaxAge, encodeTopNVideosResponse),
 		opts...,
 	)
 
 	makeGetTopNVideosTodayHandler := kithttp.NewServer(
-		MakeGetTopNVideosTodayEndpoint(s),
-		decodeGetNvideosRequest,
-		encodeResponse,
+		ho.chain(auth.ScopeRead, MakeGetTopNVideosTodayEndpoint(s)),
+		decodeGetNvideosTodayRequest,
+		cacheableEncoder(ho.cacheMaxAge, encodeTopNVideosResponse),
 		opts...,
 	)
 
 	makePostVideoHandler := kithttp.NewServer(
-		MakePostVideoEndpoint(s),
+		postVideoEndpoint,
 		decodePostVideoRequest,
 		encodeResponse,
 		opts...,
 	)
 
+	importViewsHandler := kithttp.NewServer(
+		ho.chain(auth.ScopeAdmin, MakeImportViewsEndpoint(s)),
+		decodeImportViewsRequest,
+		encodeImportViewsResponse,
+		opts...,
+	)
+
+	exportVideosHandler := kithttp.NewServer(
+		ho.chain(auth.ScopeRead, MakeExportVideosEndpoint(s)),
+		decodeExportVideosRequest,
+		encodeExportVideosResponse,
+		opts...,
+	)
+
+	getViewHistoryHandler := kithttp.NewServer(
+		ho.chain(auth.ScopeRead, MakeGetViewHistoryEndpoint(s)),
+		decodeGetViewHistoryRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	getLeaderboardDiffHandler := kithttp.NewServer(
+		ho.chain(auth.ScopeRead, MakeGetLeaderboardDiffEndpoint(s)),
+		decodeGetLeaderboardDiffRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	getVideoStatsHandler := kithttp.NewServer(
+		ho.chain(auth.ScopeRead, MakeGetVideoStatsEndpoint(s)),
+		decodeGetVideoStatsRequest,
+		encodeResponse,
+		opts...,
+	)
+
+	streamTopNVideosHandler := kithttp.NewServer(
+		makeStreamTopNVideosEndpoint(getTopNVideosEndpoint),
+		decodeV2GetLeaderboardRequest,
+		encodeStreamTopNVideosResponse(ho.notifier, ho.cacheMaxAge),
+		append(opts, kithttp.ServerBefore(populateLastEventID))...,
+	)
+
+	getAuditEntriesHandler := kithttp.NewServer(
+		ho.chain(auth.ScopeAdmin, MakeGetAuditEntriesEndpoint(s)),
+		decodeGetAuditEntriesRequest,
+		encodeResponse,
+		opts...,
+	)
+
 	R := mux.NewRouter()
-	R.Handle("/viewVideo", viewVideoHandler).Methods("GET")
-	R.Handle("/getViews", GetViewsHandler).Methods("GET")
-	R.Handle("/getTopNvideos", GetTopNVideosHandler).Methods("GET")
-	R.Handle("/getTopNvideosToday", makeGetTopNVideosTodayHandler).Methods("GET")
-	R.Handle("/postVideo", makePostVideoHandler).Methods("POST")
+	//the RPC style routes are kept for the existing clients, the v2 resources replace them
+	R.Handle("/viewVideo", deprecated("/v2/videos/{id}/views", viewVideoHandler)).Methods("GET")
+	R.Handle("/getViews", deprecated("/v2/videos/{id}", GetViewsHandler)).Methods("GET")
+	R.Handle("/getTopNvideos", deprecated("/v2/leaderboards/{window}", GetTopNVideosHandler)).Methods("GET")
+	R.Handle("/getTopNvideosToday", deprecated("/v2/leaderboards/today", makeGetTopNVideosTodayHandler)).Methods("GET")
+	R.Handle("/postVideo", deprecated("/v2/videos", ho.idempotent(makePostVideoHandler))).Methods("POST")
+	R.Handle("/export", exportVideosHandler).Methods("GET")
+	//the video IDs can have slashes, the client escapes them and the router matches the decoded path
+	R.Handle("/videos/{id:.+}/history", getViewHistoryHandler).Methods("GET")
+	R.Handle("/videos/stats", getVideoStatsHandler).Methods("GET")
+	R.Handle("/leaderboard/changes", getLeaderboardDiffHandler).Methods("GET")
+	R.Handle("/leaderboards/{window}/stream", flushable(streamTopNVideosHandler)).Methods("GET")
+	if ho.liveCounts != nil {
+		R.Handle("/videos/live", makeLiveCountsHandler(getViewsEndpoint, ho, logger)).Methods("GET")
+	}
+	//the admin routes are not served without credentials, the RPC style writes stay open for the existing clients
+	if ho.authenticator != nil {
+		R.Handle("/admin/import", ho.idempotent(importViewsHandler)).Methods("POST")
+		R.Handle("/admin/audit", getAuditEntriesHandler).Methods("GET")
+	} else {
+		level.Warn(logger).Log("msg", "The admin routes and the v2 writes are not served without authentication")
+	}
 
-	return R
+	addV2Routes(R.PathPrefix("/v2").Subrouter(), Endpoints{
+		ViewVideoEndpoint:     viewVideoEndpoint,
+		GetViewsEndpoint:      getViewsEndpoint,
+		GetTopNVideosEndpoint: getTopNVideosEndpoint,
+		PostVideoEndpoint:     postVideoEndpoint,
+	}, ho, opts)
+
+	if errGraphQLSchema != nil {
+		level.Error(logger).Log("msg", "GraphQL is not served", "err", errGraphQLSchema)
+	} else {
+		R.Handle("/graphql", makeGraphQLHandler(graphQLSchema, s, ho, opts)).Methods("GET", "POST")
+		R.Handle("/graphql/schema", makeGraphQLSchemaHandler()).Methods("GET")
+	}
+
+	R.Handle("/openapi.json", makeOpenAPIHandler()).Methods("GET")
+	R.Handle("/docs", makeSwaggerUIHandler()).Methods("GET")
 
+	//the unknown routes answer with the error envelope too
+	R.NotFoundHandler = errorHandler(http.StatusNotFound, errBadRoute)
+	R.MethodNotAllowedHandler = errorHandler(http.StatusMethodNotAllowed, errMethodNotAllowed)
+
+	return R
 }
 
 //server related
@@ -75,38 +298,385 @@ func MakeHandler(s Service, logger kitlog.Logger) http.Handler {
 func decodeViewVideoRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
 	videoName := r.URL.Query().Get("videoName")
 	if videoName == "" {
-		return nil, errBadRoute
+		return nil, validation.NewError("videoName", validation.RuleRequired, "is missing")
 	}
 	return viewVideoRequest{videoName: videoName}, nil
 }
 
+func videoOfViewRequest(request interface{}) string {
+	req, _ := request.(viewVideoRequest)
+	return req.videoName
+}
+
 func decodeGetViewsRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
 	videoName := r.URL.Query().Get("videoName")
 	if videoName == "" {
-		return nil, errBadRoute
+		return nil, validation.NewError("videoName", validation.RuleRequired, "is missing")
 	}
 	return getViewsRequest{videoName: videoName}, nil
 }
 
 func decodeGetNvideosRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
-	limit := r.URL.Query().Get("limit")
-	num, err := strconv.Atoi(limit)
+	num, err := intParam("limit", r.URL.Query().Get("limit"))
 	if err != nil {
 		return nil, err
 	}
-	return getTopNvideosRequest{limit: num}, nil
+	return getTopNvideosRequest{limit: num, window: r.URL.Query().Get("window")}, nil
 }
 
-func decodePostVideoRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
-	var body struct {
-		VideoName string `json:"videoName"`
+func decodeGetNvideosTodayRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	num, err := intParam("limit", r.URL.Query().Get("limit"))
+	if err != nil {
+		return nil, err
 	}
+	return getTopNVideosTodayRequest{limit: num}, nil
+}
+
+type postVideoBody struct {
+	VideoName string `json:"videoName"`
+}
+
+func decodePostVideoRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	var body postVideoBody
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		return nil, err
+		return nil, validation.NewError("body", validation.RuleFormat, "is not a JSON object")
 	}
 	return postVideoRequest{videoName: body.VideoName}, nil
 }
 
+// the import options come from the query, the body is streamed to the service as it is
+func decodeImportViewsRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	query := r.URL.Query()
+	opts := ImportOptions{Format: query.Get("format")}
+	if opts.Format == "" {
+		opts.Format = formatFromContentType(r.Header.Get("Content-Type"))
+	}
+	if value := query.Get("dryRun"); value != "" {
+		if opts.DryRun, err = boolParam("dryRun", value); err != nil {
+			return nil, err
+		}
+	}
+	if value := query.Get("resumeFrom"); value != "" {
+		if opts.ResumeFrom, err = intParam("resumeFrom", value); err != nil {
+			return nil, err
+		}
+	}
+	if value := query.Get("batchSize"); value != "" {
+		if opts.BatchSize, err = intParam("batchSize", value); err != nil {
+			return nil, err
+		}
+	}
+	return importViewsRequest{body: r.Body, opts: opts}, nil
+}
+
+func formatFromContentType(contentType string) string {
+	switch {
+	case strings.HasPrefix(contentType, "text/csv"):
+		return FormatCSV
+	case strings.HasPrefix(contentType, "application/x-ndjson"):
+		return FormatNDJSON
+	}
+	return ""
+}
+
+// importViewsBody is the report of an import, with the error which stopped it
+type importViewsBody struct {
+	Report ImportReport    `json:"report"`
+	Error  *apierror.Error `json:"error,omitempty"`
+}
+
+func encodeImportViewsResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(importViewsResponse)
+	body := importViewsBody{Report: resp.Report}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if resp.Err != nil {
+		body.Error = apierror.New(ctx, statusFor(resp.Err), resp.Err)
+		w.WriteHeader(body.Error.Status)
+	}
+	return json.NewEncoder(w).Encode(body)
+}
+
+func decodeExportVideosRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	query := r.URL.Query()
+	req := exportVideosRequest{}
+	switch query.Get("window") {
+	case "", "lifetime":
+		req.isLifeTime = true
+	case "today":
+		req.isLifeTime = false
+	default:
+		return nil, ErrInvalidArgument
+	}
+	//the export is streamed, the json and columnar layouts of the top videos are not supported
+	if req.format = query.Get("format"); req.format != "" {
+		if req.format != FormatCSV && req.format != FormatNDJSON {
+			return nil, validation.NewError("format", validation.RuleFormat, "is not csv or ndjson")
+		}
+		return req, nil
+	}
+	req.format = negotiateFormat(r.Header.Get("Accept"), FormatNDJSON)
+	if req.format != FormatCSV && req.format != FormatNDJSON {
+		return nil, errNotAcceptable
+	}
+	return req, nil
+}
+
+// the export is written while the leaderboard is scanned, an error before the first video
+// is still reported with encodeError, after that the response is already on its way
+func encodeExportVideosResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(exportVideosResponse)
+	writer := newRecordWriter(resp.format, w)
+	started := false
+	start := func() {
+		if !started {
+			started = true
+			w.Header().Set("Content-Type", formatContentTypes[resp.format])
+		}
+	}
+	err := resp.stream(func(record model.ResultRedis) error {
+		start()
+		return writer.Write(record)
+	})
+	if err != nil && !started {
+		encodeError(ctx, err, w)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	start()
+	return writer.Flush()
+}
+
+type contextKey int
+
+const (
+	ifNoneMatchKey contextKey = iota
+	lastEventIDKey
+	flusherKey
+)
+
+func populateIfNoneMatch(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, ifNoneMatchKey, r.Header.Get("If-None-Match"))
+}
+
+// cacheableEncoder buffers the response of encode to send it with an ETag and a Cache-Control header,
+// or only a 304 when the client already has it
+func cacheableEncoder(maxAge time.Duration, encode kithttp.EncodeResponseFunc) kithttp.EncodeResponseFunc {
+	cacheControl := "no-cache"
+	if maxAge > 0 {
+		cacheControl = "public, max-age=" + strconv.Itoa(int(math.Ceil(maxAge.Seconds())))
+	}
+	return func(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+		if e, ok := response.(errorer); ok && e.error() != nil {
+			return encode(ctx, w, response)
+		}
+		buffered := &bufferedResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		if err := encode(ctx, buffered, response); err != nil {
+			return err
+		}
+		if buffered.status != http.StatusOK {
+			w.WriteHeader(buffered.status)
+			_, err := w.Write(buffered.body.Bytes())
+			return err
+		}
+		sum := sha256.Sum256(buffered.body.Bytes())
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Header().Add("Vary", "Accept")
+		if ifNoneMatch, _ := ctx.Value(ifNoneMatchKey).(string); etagMatches(ifNoneMatch, etag) {
+			w.Header().Del("Content-Type")
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+		_, err := w.Write(buffered.body.Bytes())
+		return err
+	}
+}
+
+// etagMatches tells if etag is one of the comma separated ones of an If-None-Match header
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedResponseWriter keeps the body and the status, the headers go straight to the wrapped writer
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) WriteHeader(status int) { w.status = status }
+
+func (w *bufferedResponseWriter) Write(p []byte) (int, error) { return w.body.Write(p) }
+
+// top N videos are written in the format asked for in the Accept header, json by default
+func encodeTopNVideosResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if e, ok := response.(errorer); ok && e.error() != nil {
+		encodeError(ctx, e.error(), w)
+		return nil
+	}
+	var topVideos []model.ResultRedis
+	switch resp := response.(type) {
+	case getTopNvideosResponse:
+		topVideos = resp.TopVideos
+	case getTopNVideosTodayResponse:
+		topVideos = resp.TopVideos
+	}
+	accept, _ := ctx.Value(kithttp.ContextKeyRequestAccept).(string)
+	format := negotiateFormat(accept, FormatJSON)
+	switch format {
+	case FormatJSON:
+		return encodeResponse(ctx, w, response)
+	case FormatColumnar:
+		w.Header().Set("Content-Type", contentTypeColumnar)
+		return json.NewEncoder(w).Encode(toColumnar(topVideos))
+	}
+	w.Header().Set("Content-Type", formatContentTypes[format])
+	writer := newRecordWriter(format, w)
+	for _, record := range topVideos {
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// from and to are RFC 3339 times or plain dates, by default the last 30 days or the last 24 hours are returned
+func decodeGetViewHistoryRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	query := r.URL.Query()
+	req := getViewHistoryRequest{
+		videoName:   mux.Vars(r)["id"],
+		granularity: query.Get("granularity"),
+		to:          time.Now(),
+	}
+	if req.videoName == "" {
+		return nil, validation.NewError("id", validation.RuleRequired, "is missing")
+	}
+	if req.granularity == "" {
+		req.granularity = GranularityDay
+	}
+	if value := query.Get("to"); value != "" {
+		if req.to, err = timeParam("to", value); err != nil {
+			return nil, err
+		}
+	}
+	req.from = req.to.AddDate(0, 0, -30)
+	if req.granularity == GranularityHour {
+		req.from = req.to.Add(-24 * time.Hour)
+	}
+	if value := query.Get("from"); value != "" {
+		if req.from, err = timeParam("from", value); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// window defaults to today and limit to 10
+func decodeGetLeaderboardDiffRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	query := r.URL.Query()
+	req := getLeaderboardDiffRequest{window: query.Get("window"), limit: 10}
+	if req.window == "" {
+		req.window = WindowToday
+	}
+	if value := query.Get("limit"); value != "" {
+		if req.limit, err = intParam("limit", value); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// the videos are repeated id parameters, window defaults to lifetime
+func decodeGetVideoStatsRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	query := r.URL.Query()
+	req := getVideoStatsRequest{videoNames: query["id"], window: query.Get("window")}
+	if len(req.videoNames) == 0 {
+		return nil, validation.NewError("id", validation.RuleRequired, "is missing")
+	}
+	if req.window == "" {
+		req.window = WindowLifetime
+	}
+	return req, nil
+}
+
+func decodeGetAuditEntriesRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	query := r.URL.Query()
+	filter := model.AuditFilter{
+		Method:  query.Get("method"),
+		VideoID: query.Get("videoName"),
+		Subject: query.Get("subject"),
+	}
+	if value := query.Get("since"); value != "" {
+		if filter.Since, err = timeParam("since", value); err != nil {
+			return nil, err
+		}
+	}
+	if value := query.Get("until"); value != "" {
+		if filter.Until, err = timeParam("until", value); err != nil {
+			return nil, err
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		if filter.Limit, err = intParam("limit", value); err != nil {
+			return nil, err
+		}
+	}
+	return getAuditEntriesRequest{filter: filter}, nil
+}
+
+// intParam, boolParam and timeParam parse the query parameter field, a malformed one is a validation.Error
+func intParam(field, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, validation.NewError(field, validation.RuleFormat, "is not an integer")
+	}
+	return n, nil
+}
+
+func boolParam(field, value string) (bool, error) {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, validation.NewError(field, validation.RuleFormat, "is not a boolean")
+	}
+	return b, nil
+}
+
+func timeParam(field, value string) (time.Time, error) {
+	t, err := parseTimeParam(value)
+	if err != nil {
+		return time.Time{}, validation.NewError(field, validation.RuleFormat, "is not an RFC 3339 time or a "+importDateLayout+" date")
+	}
+	return t, nil
+}
+
+func parseTimeParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(importDateLayout, value, time.Local)
+}
+
+// MakeHealthHandler reports the health of the database, 503 when it is down
+func MakeHealthHandler(check func(context.Context) model.Health) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health := check(r.Context())
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if health.Status == db.HealthDown {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(health)
+	})
+}
+
 func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	if e, ok := response.(errorer); ok && e.error() != nil {
 		encodeError(ctx, e.error(), w)
@@ -118,7 +688,7 @@ func encodeResponse(ctx context.Context, w http.ResponseWriter, response interfa
 
 // client related
 func _Encode_viewVideo_Request(ctx context.Context, req *http.Request, request interface{}) error {
-	req.URL.Path = "/viewVideo"
+	setPath(req.URL, "viewVideo")
 	request1, ok := request.(viewVideoRequest)
 
 	if ok {
@@ -132,19 +702,22 @@ func _Encode_viewVideo_Request(ctx context.Context, req *http.Request, request i
 }
 
 func _Encode_GetTopNVideosEndpoint_Request(ctx context.Context, req *http.Request, request interface{}) error {
-	req.URL.Path = "/getTopNvideos"
+	setPath(req.URL, "getTopNvideos")
 	request1, ok := request.(getTopNvideosRequest)
 	if ok {
 		queryMap := req.URL.Query()
 		queryMap.Add("limit", strconv.Itoa(request1.limit))
+		if request1.window != "" {
+			queryMap.Add("window", request1.window)
+		}
 		req.URL.RawQuery = queryMap.Encode()
 		return nil
 	}
-	return encodeRequest(ctx, req, request)
+	return errInvalidRequest
 }
 
 func _Encode_GetTopNVideosTodayEndpoint_Request(ctx context.Context, req *http.Request, request interface{}) error {
-	req.URL.Path = "/getTopNvideosToday"
+	setPath(req.URL, "getTopNvideosToday")
 	request1, ok := request.(getTopNVideosTodayRequest)
 	if ok {
 		queryMap := req.URL.Query()
@@ -157,7 +730,7 @@ func _Encode_GetTopNVideosTodayEndpoint_Request(ctx context.Context, req *http.R
 }
 
 func _Encode_GetViewsEndpoint_Request(ctx context.Context, req *http.Request, request interface{}) error {
-	req.URL.Path = "/getViews"
+	setPath(req.URL, "getViews")
 	request1, ok := request.(getViewsRequest)
 	if ok {
 		queryMap := req.URL.Query()
@@ -169,92 +742,356 @@ func _Encode_GetViewsEndpoint_Request(ctx context.Context, req *http.Request, re
 }
 
 func _Encode_PostVideoEndpoint_Request(ctx context.Context, req *http.Request, request interface{}) error {
-	req.URL.Path = "/postVideo"
+	setPath(req.URL, "postVideo")
 	request1, ok := request.(postVideoRequest)
 	if ok {
-		queryMap := req.URL.Query()
-		queryMap.Add("videoName", request1.videoName)
-		req.URL.RawQuery = queryMap.Encode()
-		return nil
+		return encodeRequest(ctx, req, postVideoBody{VideoName: request1.videoName})
 	}
 	return errInvalidRequest
 }
 
-// client's decoding functions
-func _Decode_viewVideo_Response(ctx context.Context, resp *http.Response) (interface{}, error) {
-	type viewVideoResponse1 struct {
-		Response string `json:"reponse,omitempty"`
-		Err      string `json:"error,omitempty"`
+func _Encode_ImportViewsEndpoint_Request(ctx context.Context, req *http.Request, request interface{}) error {
+	setPath(req.URL, "admin", "import")
+	request1, ok := request.(importViewsRequest)
+	if !ok {
+		return errInvalidRequest
 	}
-	var response1 viewVideoResponse1
-	err := json.NewDecoder(resp.Body).Decode(&response1)
-	if err != nil {
-		err = errors.New(response1.Err)
+	queryMap := req.URL.Query()
+	if request1.opts.Format != "" {
+		queryMap.Add("format", request1.opts.Format)
+		req.Header.Set("Content-Type", formatContentTypes[request1.opts.Format])
 	}
+	queryMap.Add("dryRun", strconv.FormatBool(request1.opts.DryRun))
+	queryMap.Add("resumeFrom", strconv.Itoa(request1.opts.ResumeFrom))
+	queryMap.Add("batchSize", strconv.Itoa(request1.opts.BatchSize))
+	req.URL.RawQuery = queryMap.Encode()
+	req.Body = ioutil.NopCloser(request1.body)
+	return nil
+}
 
-	return viewVideoResponse{Response: response1.Response, Err: err}, err
+func _Encode_ExportVideosEndpoint_Request(ctx context.Context, req *http.Request, request interface{}) error {
+	setPath(req.URL, "export")
+	request1, ok := request.(exportVideosRequest)
+	if !ok {
+		return errInvalidRequest
+	}
+	window := "lifetime"
+	if !request1.isLifeTime {
+		window = "today"
+	}
+	queryMap := req.URL.Query()
+	queryMap.Add("window", window)
+	queryMap.Add("format", request1.format)
+	req.URL.RawQuery = queryMap.Encode()
+	req.Header.Set("Accept", formatContentTypes[request1.format])
+	return nil
 }
 
-func _Decode_GetTopNVideosEndpoint_Response(ctx context.Context, resp *http.Response) (interface{}, error) {
-	type getNvideosResponse1 struct {
-		TopVideos []model.ResultRedis `json:"TopVideos,omitempty"`
-		Err       string              `json:"error,omitempty"`
+func _Encode_GetViewHistoryEndpoint_Request(ctx context.Context, req *http.Request, request interface{}) error {
+	request1, ok := request.(getViewHistoryRequest)
+	if !ok {
+		return errInvalidRequest
 	}
-	var response1 getNvideosResponse1
+	setPath(req.URL, "videos", request1.videoName, "history")
+	//the zero times and granularity are left to the defaults of the server
+	queryMap := req.URL.Query()
+	if !request1.from.IsZero() {
+		queryMap.Add("from", request1.from.Format(time.RFC3339))
+	}
+	if !request1.to.IsZero() {
+		queryMap.Add("to", request1.to.Format(time.RFC3339))
+	}
+	if request1.granularity != "" {
+		queryMap.Add("granularity", request1.granularity)
+	}
+	req.URL.RawQuery = queryMap.Encode()
+	return nil
+}
 
-	err := json.NewDecoder(resp.Body).Decode(&response1)
-	if err != nil {
-		err = errors.New(response1.Err)
+func _Encode_GetLeaderboardDiffEndpoint_Request(ctx context.Context, req *http.Request, request interface{}) error {
+	setPath(req.URL, "leaderboard", "changes")
+	request1, ok := request.(getLeaderboardDiffRequest)
+	if !ok {
+		return errInvalidRequest
 	}
+	queryMap := req.URL.Query()
+	queryMap.Add("window", request1.window)
+	queryMap.Add("limit", strconv.Itoa(request1.limit))
+	req.URL.RawQuery = queryMap.Encode()
+	return nil
+}
 
-	return getTopNvideosResponse{TopVideos: response1.TopVideos, Err: err}, err
+func _Encode_GetVideoStatsEndpoint_Request(ctx context.Context, req *http.Request, request interface{}) error {
+	setPath(req.URL, "videos", "stats")
+	request1, ok := request.(getVideoStatsRequest)
+	if !ok {
+		return errInvalidRequest
+	}
+	queryMap := req.URL.Query()
+	for _, videoName := range request1.videoNames {
+		queryMap.Add("id", videoName)
+	}
+	queryMap.Add("window", request1.window)
+	req.URL.RawQuery = queryMap.Encode()
+	return nil
 }
 
-func _Decode_GetTopNVideosTodayEndpoint_Response(ctx context.Context, resp *http.Response) (interface{}, error) {
+func _Encode_GetAuditEntriesEndpoint_Request(ctx context.Context, req *http.Request, request interface{}) error {
+	setPath(req.URL, "admin", "audit")
+	request1, ok := request.(getAuditEntriesRequest)
+	if !ok {
+		return errInvalidRequest
+	}
+	filter := request1.filter
+	queryMap := req.URL.Query()
+	for key, value := range map[string]string{"method": filter.Method, "videoName": filter.VideoID, "subject": filter.Subject} {
+		if value != "" {
+			queryMap.Add(key, value)
+		}
+	}
+	if !filter.Since.IsZero() {
+		queryMap.Add("since", filter.Since.Format(time.RFC3339))
+	}
+	if !filter.Until.IsZero() {
+		queryMap.Add("until", filter.Until.Format(time.RFC3339))
+	}
+	if filter.Limit > 0 {
+		queryMap.Add("limit", strconv.Itoa(filter.Limit))
+	}
+	req.URL.RawQuery = queryMap.Encode()
+	return nil
+}
+
+// client's decoding functions, the failed responses are decoded into the Err of the response
+// so the balancers don't retry them
+func _Decode_viewVideo_Response(ctx context.Context, resp *http.Response) (interface{}, error) {
+	if failed(resp) {
+		return viewVideoResponse{Err: decodeError(resp)}, nil
+	}
+	var response viewVideoResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
 
-	var response getTopNVideosTodayResponse
+func _Decode_GetTopNVideosEndpoint_Response(ctx context.Context, resp *http.Response) (interface{}, error) {
+	if failed(resp) {
+		return getTopNvideosResponse{Err: decodeError(resp)}, nil
+	}
+	var response getTopNvideosResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+// both tops decode to a getTopNvideosResponse as Endpoints.GetTopNVideos expects
+func _Decode_GetTopNVideosTodayEndpoint_Response(ctx context.Context, resp *http.Response) (interface{}, error) {
+	if failed(resp) {
+		return getTopNvideosResponse{Err: decodeError(resp)}, nil
+	}
+	var response getTopNvideosResponse
 	err := json.NewDecoder(resp.Body).Decode(&response)
 	return response, err
 }
 
 func _Decode_GetViewsEndpoint_Response(ctx context.Context, resp *http.Response) (interface{}, error) {
+	if failed(resp) {
+		return getViewsResponse{Err: decodeError(resp)}, nil
+	}
 	var response getViewsResponse
 	err := json.NewDecoder(resp.Body).Decode(&response)
 	return response, err
 }
 
 func _Decode_PostVideoEndpoint_Response(ctx context.Context, resp *http.Response) (interface{}, error) {
+	if failed(resp) {
+		return postVideoResponse{Err: decodeError(resp)}, nil
+	}
 	var response postVideoResponse
 	err := json.NewDecoder(resp.Body).Decode(&response)
 	return response, err
 }
 
+// a failed import still has its report
+func _Decode_ImportViewsEndpoint_Response(ctx context.Context, resp *http.Response) (interface{}, error) {
+	var body importViewsBody
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil && !failed(resp) {
+		return nil, err
+	}
+	response := importViewsResponse{Report: body.Report}
+	if failed(resp) {
+		response.Err = errorFrom(resp, body.Error)
+	}
+	return response, nil
+}
+
+// the body stays open until the stream of the returned response has read it
+func _Decode_ExportVideosEndpoint_Response(ctx context.Context, resp *http.Response) (interface{}, error) {
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, decodeError(resp)
+	}
+	return exportVideosResponse{
+		format: FormatNDJSON,
+		stream: func(each func(model.ResultRedis) error) error {
+			defer resp.Body.Close()
+			decoder := json.NewDecoder(resp.Body)
+			for {
+				var record model.ResultRedis
+				err := decoder.Decode(&record)
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if err := each(record); err != nil {
+					return err
+				}
+			}
+		},
+	}, nil
+}
+
+func _Decode_GetViewHistoryEndpoint_Response(ctx context.Context, resp *http.Response) (interface{}, error) {
+	if failed(resp) {
+		return getViewHistoryResponse{Err: decodeError(resp)}, nil
+	}
+	var response getViewHistoryResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func _Decode_GetLeaderboardDiffEndpoint_Response(ctx context.Context, resp *http.Response) (interface{}, error) {
+	if failed(resp) {
+		return getLeaderboardDiffResponse{Err: decodeError(resp)}, nil
+	}
+	var response getLeaderboardDiffResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func _Decode_GetVideoStatsEndpoint_Response(ctx context.Context, resp *http.Response) (interface{}, error) {
+	if failed(resp) {
+		return getVideoStatsResponse{Err: decodeError(resp)}, nil
+	}
+	var response getVideoStatsResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func _Decode_GetAuditEntriesEndpoint_Response(ctx context.Context, resp *http.Response) (interface{}, error) {
+	if failed(resp) {
+		return getAuditEntriesResponse{Err: decodeError(resp)}, nil
+	}
+	var response getAuditEntriesResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func failed(resp *http.Response) bool {
+	return resp.StatusCode >= http.StatusBadRequest
+}
+
+// knownErrors are the errors of the service the clients decode back from the error messages
+var knownErrors = []error{
+	db.ErrUnknown, db.ErrHourlyBucketsDisabled, db.ErrUnavailable, db.ErrWriteBufferFull,
+	ErrInvalidArgument, ErrUnknownFormat, ErrNoSnapshots, ErrAuditDisabled,
+	errUnknownWindow, errStreamingUnsupported, errBadRoute, errMethodNotAllowed, errNotAcceptable,
+	auth.ErrUnauthenticated, auth.ErrForbidden,
+	idempotency.ErrKeyTooLong, idempotency.ErrInProgress, idempotency.ErrKeyReused,
+}
+
+// decodeError reads the error envelope of a failed response
+func decodeError(resp *http.Response) error {
+	var body apierror.Body
+	json.NewDecoder(resp.Body).Decode(&body)
+	return errorFrom(resp, body.Error)
+}
+
+// errorFrom returns the *apierror.Error of a failed response wrapping the known error it stands for,
+// the 429 wrap a *ratelimit.LimitedError with the Retry-After of the response
+func errorFrom(resp *http.Response, body *apierror.Error) error {
+	err := apierror.FromResponse(resp, body, knownErrors...)
+	if err.Status == http.StatusTooManyRequests {
+		limited := &ratelimit.LimitedError{}
+		fmt.Sscanf(err.Message, "rate limit per %s exceeded", &limited.Scope)
+		seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		limited.RetryAfter = time.Duration(seconds) * time.Second
+		err.Err = limited
+	}
+	return err
+}
+
+// encodeRequest sends request as a JSON body
 func encodeRequest(_ context.Context, req *http.Request, request interface{}) error {
 	var buf bytes.Buffer
 	err := json.NewEncoder(&buf).Encode(request)
 	if err != nil {
 		return err
 	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.ContentLength = int64(buf.Len())
 	req.Body = ioutil.NopCloser(&buf)
 	return nil
 }
 
+// setPath appends the escaped segments of a route to the path of the base URL of the client
+func setPath(u *url.URL, segments ...string) {
+	rawPath := u.EscapedPath()
+	for _, segment := range segments {
+		u.Path += "/" + segment
+		rawPath += "/" + url.PathEscape(segment)
+	}
+	u.RawPath = rawPath
+}
+
 type errorer interface {
 	error() error
 }
 
-// encode errors from business-logic
-func encodeError(_ context.Context, err error, w http.ResponseWriter) {
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+// encode errors from business-logic in the error envelope of every failed response
+func encodeError(ctx context.Context, err error, w http.ResponseWriter) {
+	var limited *ratelimit.LimitedError
+	if errors.As(err, &limited) {
+		ratelimit.WriteLimited(ctx, w, limited)
+		return
+	}
+	if err == auth.ErrUnauthenticated {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="youtube_service"`)
+	}
+	apierror.Write(ctx, w, statusFor(err), err)
+}
+
+// errorHandler answers every request with status and err
+func errorHandler(status int, err error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apierror.Write(r.Context(), w, status, err)
+	})
+}
+
+// mapping the business errors to http status codes
+func statusFor(err error) int {
+	var invalid *validation.Error
+	var limited *ratelimit.LimitedError
+	switch {
+	case errors.As(err, &invalid):
+		return http.StatusBadRequest
+	case errors.As(err, &limited):
+		return http.StatusTooManyRequests
+	}
 	switch err {
-	case db.ErrUnknown:
-		w.WriteHeader(http.StatusNotFound)
-	case ErrInvalidArgument:
-		w.WriteHeader(http.StatusBadRequest)
+	case db.ErrUnknown, ErrNoSnapshots, ErrAuditDisabled, errUnknownWindow:
+		return http.StatusNotFound
+	case ErrInvalidArgument, ErrUnknownFormat, db.ErrHourlyBucketsDisabled:
+		return http.StatusBadRequest
+	case errNotAcceptable:
+		return http.StatusNotAcceptable
+	case auth.ErrUnauthenticated:
+		return http.StatusUnauthorized
+	case auth.ErrForbidden:
+		return http.StatusForbidden
+	case db.ErrUnavailable, db.ErrWriteBufferFull:
+		return http.StatusServiceUnavailable
 	default:
-		w.WriteHeader(http.StatusInternalServerError)
+		return http.StatusInternalServerError
 	}
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"error": err.Error(),
-	})
 }
@@ -0,0 +1,545 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+	"youtube_service/apierror"
+	"youtube_service/auth"
+	model "youtube_service/model"
+	db "youtube_service/repository"
+	"youtube_service/validation"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// size of the largest GraphQL request body accepted
+const maxGraphQLRequestSize = 64 << 10
+
+// deepest field of a GraphQL request, deep enough for the introspection query of the GraphQL tools
+const maxGraphQLDepth = 15
+
+// most fields of a GraphQL request resolved at once, the views and ranks they ask for are read together
+const maxGraphQLParallelism = 100
+
+// errNotRead is the error of the views and leaderboards whose read did not return
+var errNotRead = errors.New("the read did not return")
+
+// graphQLBatchWait is how long the views and ranks asked for are gathered before they are read
+var graphQLBatchWait = 2 * time.Millisecond
+
+// graphQLSDL is the GraphQL schema over the videos, their views and ranks and the leaderboards
+var graphQLSDL = fmt.Sprintf(`schema {
+	query: Query
+}
+
+type Query {
+	"The video with id, null when it is unknown"
+	video(id: ID!): Video
+	"The videos with ids in their order, null for the unknown ones"
+	videos(ids: [ID!]!): [Video]!
+	"The top limit videos of window, at most 500"
+	leaderboard(window: String = %q, limit: Int = %d): Leaderboard!
+}
+
+"A video and its views"
+type Video {
+	id: ID!
+	"Lifetime views"
+	views: Int!
+	"Rank in the leaderboard of window starting at 1, null when the video has no views in it"
+	rank("lifetime, today, 24h or 7d" window: String = %[1]q): Int
+}
+
+"The top videos of a window"
+type Leaderboard {
+	window: String!
+	entries: [LeaderboardEntry!]!
+}
+
+"A video of a leaderboard"
+type LeaderboardEntry {
+	rank: Int!
+	"Views in the window of the leaderboard"
+	views: Int!
+	video: Video!
+}
+`, WindowLifetime, defaultLeaderboardLimit)
+
+// the schema is static, Test_graphQLSchema checks that it builds
+var graphQLSchema, errGraphQLSchema = graphql.ParseSchema(graphQLSDL, &graphQLResolver{},
+	graphql.UseStringDescriptions(),
+	graphql.MaxDepth(maxGraphQLDepth),
+	graphql.MaxParallelism(maxGraphQLParallelism),
+)
+
+// graphQLResolver resolves the query type, the video IDs are normalised with the validator of the context
+// and everything is read through its videoLoader
+type graphQLResolver struct{}
+
+func (*graphQLResolver) Video(ctx context.Context, args struct{ ID graphql.ID }) (*videoNode, error) {
+	id, verr := validatorFromContext(ctx).VideoID("id", string(args.ID))
+	if verr != nil {
+		return nil, graphQLError(verr)
+	}
+	stats, err := videoLoaderFromContext(ctx).load(id, "").wait()
+	if err != nil || stats == nil {
+		return nil, graphQLError(err)
+	}
+	return &videoNode{id: id, views: stats.ViewCount, hasViews: true}, nil
+}
+
+func (*graphQLResolver) Videos(ctx context.Context, args struct{ IDs []graphql.ID }) ([]*videoNode, error) {
+	if len(args.IDs) > maxVideoStats {
+		return nil, graphQLError(validation.NewError("ids", validation.RuleMaxLength, "has more than 500 videos"))
+	}
+	v, loader := validatorFromContext(ctx), videoLoaderFromContext(ctx)
+	ids := make([]string, len(args.IDs))
+	loads := make([]*videoStatsResult, len(args.IDs))
+	for i, id := range args.IDs {
+		var verr *validation.Error
+		if ids[i], verr = v.VideoID("ids", string(id)); verr != nil {
+			return nil, graphQLError(verr)
+		}
+		loads[i] = loader.load(ids[i], "")
+	}
+	videos := make([]*videoNode, len(ids))
+	for i, load := range loads {
+		stats, err := load.wait()
+		if err != nil {
+			return nil, graphQLError(err)
+		}
+		if stats != nil {
+			videos[i] = &videoNode{id: ids[i], views: stats.ViewCount, hasViews: true}
+		}
+	}
+	return videos, nil
+}
+
+func (*graphQLResolver) Leaderboard(ctx context.Context, args struct {
+	Window string
+	Limit  int32
+}) (*leaderboardNode, error) {
+	if !isValidWindow(args.Window) {
+		return nil, graphQLError(errUnknownWindow)
+	}
+	if args.Limit <= 0 || args.Limit > maxVideoStats {
+		return nil, graphQLError(validation.NewError("limit", validation.RuleFormat, "is not between 1 and 500"))
+	}
+	limit := int(args.Limit)
+	videos, err := videoLoaderFromContext(ctx).loadLeaderboard(args.Window, limit).wait(limit)
+	if err != nil {
+		return nil, graphQLError(err)
+	}
+	return &leaderboardNode{window: args.Window, videos: videos}, nil
+}
+
+// videoNode is a Video of the GraphQL schema, the lifetime views are known when hasViews is set and
+// its rank in window when rank is not 0, e.g. for the entries of a leaderboard
+type videoNode struct {
+	id       string
+	views    int
+	hasViews bool
+	window   string
+	rank     int
+}
+
+func (n *videoNode) ID() graphql.ID { return graphql.ID(n.id) }
+
+func (n *videoNode) Views(ctx context.Context) (int32, error) {
+	if n.hasViews {
+		return int32(n.views), nil
+	}
+	stats, err := videoLoaderFromContext(ctx).load(n.id, "").wait()
+	if err != nil {
+		return 0, graphQLError(err)
+	}
+	if stats == nil {
+		return 0, graphQLError(db.ErrUnknown)
+	}
+	return int32(stats.ViewCount), nil
+}
+
+func (n *videoNode) Rank(ctx context.Context, args struct{ Window string }) (*int32, error) {
+	window := args.Window
+	if !isValidWindow(window) {
+		return nil, graphQLError(errUnknownWindow)
+	}
+	rank := n.rank
+	if n.window != window || rank == 0 {
+		stats, err := videoLoaderFromContext(ctx).load(n.id, window).wait()
+		if err != nil || stats == nil || stats.Rank == 0 {
+			return nil, graphQLError(err)
+		}
+		rank = stats.Rank
+	}
+	r := int32(rank)
+	return &r, nil
+}
+
+type leaderboardNode struct {
+	window string
+	videos []model.ResultRedis
+}
+
+func (n *leaderboardNode) Window() string { return n.window }
+
+func (n *leaderboardNode) Entries() []*leaderboardEntryNode {
+	entries := make([]*leaderboardEntryNode, len(n.videos))
+	for i, video := range n.videos {
+		node := &videoNode{id: video.VideoID, window: n.window, rank: i + 1}
+		if n.window == WindowLifetime {
+			node.views, node.hasViews = video.ViewCount, true
+		}
+		entries[i] = &leaderboardEntryNode{rank: i + 1, views: video.ViewCount, video: node}
+	}
+	return entries
+}
+
+type leaderboardEntryNode struct {
+	rank  int
+	views int
+	video *videoNode
+}
+
+func (n *leaderboardEntryNode) Rank() int32 { return int32(n.rank) }
+
+func (n *leaderboardEntryNode) Views() int32 { return int32(n.views) }
+
+func (n *leaderboardEntryNode) Video() *videoNode { return n.video }
+
+// graphQLFieldError is the error of a field with the code of the error envelope in its extensions
+type graphQLFieldError struct{ err error }
+
+func graphQLError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &graphQLFieldError{err: err}
+}
+
+func (e *graphQLFieldError) Error() string { return e.err.Error() }
+
+func (e *graphQLFieldError) Unwrap() error { return e.err }
+
+func (e *graphQLFieldError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"code": apierror.CodeFor(statusFor(e.err))}
+	var invalid *validation.Error
+	if errors.As(e.err, &invalid) {
+		extensions["details"] = invalid.Fields
+	}
+	return extensions
+}
+
+type videoLoaderKey struct{}
+
+func videoLoaderFromContext(ctx context.Context) *videoLoader {
+	return ctx.Value(videoLoaderKey{}).(*videoLoader)
+}
+
+type validatorKey struct{}
+
+func validatorFromContext(ctx context.Context) *validation.Validator {
+	return ctx.Value(validatorKey{}).(*validation.Validator)
+}
+
+// videoStatsKey is a video and the window of the rank asked for, the views alone are asked with no window
+type videoStatsKey struct {
+	id     string
+	window string
+}
+
+// videoStatsResult is closed once the stats are read, they are nil when the video is unknown
+type videoStatsResult struct {
+	stats *model.VideoStats
+	err   error
+	once  sync.Once
+	done  chan struct{}
+}
+
+// finish sets the stats of the first read of the result
+func (r *videoStatsResult) finish(stats *model.VideoStats, err error) {
+	r.once.Do(func() {
+		r.stats, r.err = stats, err
+		close(r.done)
+	})
+}
+
+func (r *videoStatsResult) wait() (*model.VideoStats, error) {
+	<-r.done
+	return r.stats, r.err
+}
+
+// leaderboardResult is the top limit videos of a window, the limit grows until it is dispatched
+type leaderboardResult struct {
+	limit      int
+	dispatched bool
+	videos     []model.ResultRedis
+	err        error
+	once       sync.Once
+	done       chan struct{}
+}
+
+func (r *leaderboardResult) finish(videos []model.ResultRedis, err error) {
+	r.once.Do(func() {
+		r.videos, r.err = videos, err
+		close(r.done)
+	})
+}
+
+func (r *leaderboardResult) wait(limit int) ([]model.ResultRedis, error) {
+	<-r.done
+	videos := r.videos
+	if len(videos) > limit {
+		videos = videos[:limit]
+	}
+	return videos, r.err
+}
+
+// loaderBatch is what was asked for during a wait of the videoLoader
+type loaderBatch struct {
+	dispatched   bool
+	stats        map[videoStatsKey]*videoStatsResult
+	leaderboards map[string]*leaderboardResult
+}
+
+// videoLoader gathers the views and ranks asked for by the fields of a GraphQL query resolved at the same
+// time and reads them with one GetVideoStats call per window, i.e. one Redis pipeline, once wait is over
+// or maxVideoStats of them are asked for. The leaderboards of a window are read once with the largest limit
+// asked for. It is used by the resolvers of a request concurrently.
+type videoLoader struct {
+	ctx  context.Context
+	s    Service
+	wait time.Duration
+
+	mu           sync.Mutex
+	batch        *loaderBatch
+	results      map[videoStatsKey]*videoStatsResult
+	leaderboards map[string]*leaderboardResult
+}
+
+func newVideoLoader(ctx context.Context, s Service, wait time.Duration) *videoLoader {
+	return &videoLoader{
+		ctx:          ctx,
+		s:            s,
+		wait:         wait,
+		results:      map[videoStatsKey]*videoStatsResult{},
+		leaderboards: map[string]*leaderboardResult{},
+	}
+}
+
+// loadLeaderboard asks for the top limit videos of window, a leaderboard already dispatched with a smaller
+// limit is read again
+func (l *videoLoader) loadLeaderboard(window string, limit int) *leaderboardResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	result := l.leaderboards[window]
+	if result != nil && (result.limit >= limit || !result.dispatched) {
+		if result.limit < limit {
+			result.limit = limit
+		}
+		return result
+	}
+	result = &leaderboardResult{limit: limit, done: make(chan struct{})}
+	l.leaderboards[window] = result
+	l.pending().leaderboards[window] = result
+	l.dispatchIfFull()
+	return result
+}
+
+// load asks for the stats of the video id in window, or for its views alone when window is empty
+func (l *videoLoader) load(id, window string) *videoStatsResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := videoStatsKey{id: id, window: window}
+	if result := l.results[key]; result != nil {
+		return result
+	}
+	if window == "" {
+		//the views come with the stats of any window
+		for _, w := range windows {
+			if result := l.results[videoStatsKey{id: id, window: w}]; result != nil {
+				return result
+			}
+		}
+	}
+	result := &videoStatsResult{done: make(chan struct{})}
+	l.results[key] = result
+	l.pending().stats[key] = result
+	l.dispatchIfFull()
+	return result
+}
+
+// pending is the batch being gathered, a new one is dispatched after wait, l.mu is held
+func (l *videoLoader) pending() *loaderBatch {
+	if l.batch == nil {
+		batch := &loaderBatch{stats: map[videoStatsKey]*videoStatsResult{}, leaderboards: map[string]*leaderboardResult{}}
+		l.batch = batch
+		time.AfterFunc(l.wait, func() { l.dispatch(batch) })
+	}
+	return l.batch
+}
+
+// dispatchIfFull dispatches the pending batch right away once it has as many stats as a read takes, l.mu is held
+func (l *videoLoader) dispatchIfFull() {
+	if batch := l.batch; len(batch.stats) >= maxVideoStats {
+		l.batch = nil
+		go l.dispatch(batch)
+	}
+}
+
+// dispatch reads the leaderboards and stats of batch, the views alone are read with the ranks of another
+// window of the video when there are some, in the lifetime window otherwise
+func (l *videoLoader) dispatch(batch *loaderBatch) {
+	l.mu.Lock()
+	if batch.dispatched {
+		l.mu.Unlock()
+		return
+	}
+	batch.dispatched = true
+	if l.batch == batch {
+		l.batch = nil
+	}
+	for _, result := range batch.leaderboards {
+		result.dispatched = true
+	}
+	ranked := map[string]bool{}
+	for key := range batch.stats {
+		if key.window != "" {
+			ranked[key.id] = true
+		}
+	}
+	pending := map[string][]string{}
+	for key := range batch.stats {
+		switch {
+		case key.window != "":
+			pending[key.window] = append(pending[key.window], key.id)
+		case !ranked[key.id]:
+			//the lifetime stats are the views with the lifetime rank
+			pending[WindowLifetime] = append(pending[WindowLifetime], key.id)
+			lifetime := videoStatsKey{id: key.id, window: WindowLifetime}
+			if l.results[lifetime] == nil {
+				l.results[lifetime] = batch.stats[key]
+			}
+		}
+	}
+	l.mu.Unlock()
+
+	//the waiting resolvers are released even when a read does not return
+	defer func() {
+		for _, result := range batch.leaderboards {
+			result.finish(nil, errNotRead)
+		}
+		for _, result := range batch.stats {
+			result.finish(nil, errNotRead)
+		}
+	}()
+
+	boards := make([]string, 0, len(batch.leaderboards))
+	for window := range batch.leaderboards {
+		boards = append(boards, window)
+	}
+	sort.Strings(boards)
+	for _, window := range boards {
+		result := batch.leaderboards[window]
+		result.finish(l.s.GetTopNVideosInWindow(l.ctx, result.limit, window))
+	}
+
+	batches := make([]string, 0, len(pending))
+	for window := range pending {
+		batches = append(batches, window)
+	}
+	sort.Strings(batches)
+	for _, window := range batches {
+		ids := pending[window]
+		sort.Strings(ids)
+		stats, err := l.s.GetVideoStats(l.ctx, ids, window)
+		found := make(map[string]*model.VideoStats, len(stats))
+		for i := range stats {
+			found[stats[i].VideoID] = &stats[i]
+		}
+		for _, id := range ids {
+			for _, key := range []videoStatsKey{{id: id, window: window}, {id: id}} {
+				if result := batch.stats[key]; result != nil {
+					result.finish(found[id], err)
+				}
+			}
+		}
+	}
+}
+
+// graphQLRequest is the body of the POST requests and the query parameters of the GET requests
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// makeGraphQLEndpoint executes the GraphQL requests against schema with a new videoLoader over s,
+// the video IDs are normalised with v
+func makeGraphQLEndpoint(schema *graphql.Schema, s Service, v *validation.Validator) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(graphQLRequest)
+		ctx = context.WithValue(ctx, videoLoaderKey{}, newVideoLoader(ctx, s, graphQLBatchWait))
+		ctx = context.WithValue(ctx, validatorKey{}, v)
+		return schema.Exec(ctx, req.Query, req.OperationName, req.Variables), nil
+	}
+}
+
+// the query, operationName and variables are query parameters of GET requests and a JSON body of POST requests
+func decodeGraphQLRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	var req graphQLRequest
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		req.Query, req.OperationName = query.Get("query"), query.Get("operationName")
+		if value := query.Get("variables"); value != "" {
+			if err := json.Unmarshal([]byte(value), &req.Variables); err != nil {
+				return nil, validation.NewError("variables", validation.RuleFormat, "is not a JSON object")
+			}
+		}
+	} else if err := json.NewDecoder(io.LimitReader(r.Body, maxGraphQLRequestSize)).Decode(&req); err != nil {
+		return nil, validation.NewError("body", validation.RuleFormat, "is not a JSON object")
+	}
+	if req.Query == "" {
+		return nil, validation.NewError("query", validation.RuleRequired, "is missing")
+	}
+	return req, nil
+}
+
+// encodeGraphQLResponse answers 400 to the requests rejected before their execution, 200 otherwise
+// even when some fields failed, their errors are in the response
+func encodeGraphQLResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(*graphql.Response)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if resp.Data == nil {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	return json.NewEncoder(w).Encode(resp)
+}
+
+// makeGraphQLHandler serves the GraphQL queries of the read API
+func makeGraphQLHandler(schema *graphql.Schema, s Service, ho handlerOptions, opts []kithttp.ServerOption) http.Handler {
+	return kithttp.NewServer(
+		ho.authorize(auth.ScopeRead, makeGraphQLEndpoint(schema, s, ho.validator)),
+		decodeGraphQLRequest,
+		encodeGraphQLResponse,
+		opts...,
+	)
+}
+
+// makeGraphQLSchemaHandler serves the SDL of the schema
+func makeGraphQLSchemaHandler() http.Handler {
+	sdl := []byte(graphQLSDL)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(sdl)
+	})
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	model "youtube_service/model"
+	db "youtube_service/repository"
+	mockDb "youtube_service/repository/mock"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/golang/mock/gomock"
+)
+
+func Test_graphQLRoute(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		mock       func(m *mockDb.MockDatabase)
+		wantStatus int
+		want       string
+	}{
+		{
+			name:   "leaderboard, views and ranks are read in one request",
+			method: "POST",
+			target: "/graphql",
+			body: `{"query": "{ leaderboard(window: \"today\", limit: 2) { window entries { rank views video { id views rank(window: \"today\") weekly: rank(window: \"7d\") } } } ` +
+				`video(id: \"video3\") { views today: rank(window: \"today\") } }"}`,
+			mock: func(m *mockDb.MockDatabase) {
+				//the leaderboard and the video are read together, then the fields of their videos
+				leaderboard := m.EXPECT().GetSortedRecords(gomock.Any(), 2, false).Return([]model.ResultRedis{{VideoID: "video1", ViewCount: 5}, {VideoID: "video2", ViewCount: 3}}, nil)
+				video := m.EXPECT().GetScoresAndRanks(gomock.Any(), []string{"video3"}, WindowLifetime).Return([]model.VideoStats{{VideoID: "video3", ViewCount: 40, Rank: 1}}, nil)
+				m.EXPECT().GetScoresAndRanks(gomock.Any(), []string{"video3"}, WindowToday).After(video).Return([]model.VideoStats{{VideoID: "video3", ViewCount: 40}}, nil)
+				//the lifetime views come with the weekly ranks
+				m.EXPECT().GetScoresAndRanks(gomock.Any(), []string{"video1", "video2"}, Window7d).After(leaderboard).Return([]model.VideoStats{
+					{VideoID: "video1", ViewCount: 12, Rank: 2},
+					{VideoID: "video2", ViewCount: 30, Rank: 1},
+				}, nil)
+			},
+			wantStatus: http.StatusOK,
+			want: `{"data":{"leaderboard":{"window":"today","entries":[` +
+				`{"rank":1,"views":5,"video":{"id":"video1","views":12,"rank":1,"weekly":2}},` +
+				`{"rank":2,"views":3,"video":{"id":"video2","views":30,"rank":2,"weekly":1}}]},` +
+				`"video":{"views":40,"today":null}}}`,
+		},
+		{
+			name:   "leaderboards of a window are read once",
+			method: "POST",
+			target: "/graphql",
+			body:   `{"query": "{ top: leaderboard(window: \"today\", limit: 1) { entries { views } } more: leaderboard(window: \"today\", limit: 3) { entries { views } } }"}`,
+			mock: func(m *mockDb.MockDatabase) {
+				m.EXPECT().GetSortedRecords(gomock.Any(), 3, false).Return([]model.ResultRedis{{VideoID: "video1", ViewCount: 5}, {VideoID: "video2", ViewCount: 3}}, nil)
+			},
+			wantStatus: http.StatusOK,
+			want:       `{"data":{"top":{"entries":[{"views":5}]},"more":{"entries":[{"views":5},{"views":3}]}}}`,
+		},
+		{
+			name:       "introspection",
+			method:     "POST",
+			target:     "/graphql",
+			body:       `{"query": "{ __type(name: \"LeaderboardEntry\") { fields { name } } }"}`,
+			wantStatus: http.StatusOK,
+			want:       `{"data":{"__type":{"fields":[{"name":"rank"},{"name":"views"},{"name":"video"}]}}}`,
+		},
+		{
+			name:       "too deep",
+			method:     "POST",
+			target:     "/graphql",
+			body:       `{"query": "{ __schema { types { fields { type ` + strings.Repeat("{ ofType ", 12) + `{ name }` + strings.Repeat(" }", 12) + ` } } } }"}`,
+			wantStatus: http.StatusBadRequest,
+			want:       `{"errors":[{"message":"Field \"ofType\" has depth 16 that exceeds max depth 15","locations":[{"line":1,"column":137}]}]}`,
+		},
+		{
+			name:   "videos are read in one batch",
+			method: "POST",
+			target: "/graphql",
+			body:   `{"query": "{ videos(ids: [\"video1\", \"video2\", \"video1\"]) { id views rank } }"}`,
+			mock: func(m *mockDb.MockDatabase) {
+				m.EXPECT().GetScoresAndRanks(gomock.Any(), []string{"video1", "video2"}, WindowLifetime).Return([]model.VideoStats{{VideoID: "video1", ViewCount: 5, Rank: 3}}, nil)
+			},
+			wantStatus: http.StatusOK,
+			want:       `{"data":{"videos":[{"id":"video1","views":5,"rank":3},null,{"id":"video1","views":5,"rank":3}]}}`,
+		},
+		{
+			name:   "query parameters",
+			method: "GET",
+			target: "/graphql?" + url.Values{"query": {`query Views($id: ID!) { video(id: $id) { views } }`}, "variables": {`{"id": "video1"}`}}.Encode(),
+			mock: func(m *mockDb.MockDatabase) {
+				m.EXPECT().GetScoresAndRanks(gomock.Any(), []string{"video1"}, WindowLifetime).Return([]model.VideoStats{{VideoID: "video1", ViewCount: 5, Rank: 1}}, nil)
+			},
+			wantStatus: http.StatusOK,
+			want:       `{"data":{"video":{"views":5}}}`,
+		},
+		{
+			name:   "failed reads have the code of the error envelope",
+			method: "POST",
+			target: "/graphql",
+			body:   `{"query": "{ video(id: \"video1\") { views } }"}`,
+			mock: func(m *mockDb.MockDatabase) {
+				m.EXPECT().GetScoresAndRanks(gomock.Any(), []string{"video1"}, WindowLifetime).Return(nil, db.ErrUnavailable)
+			},
+			wantStatus: http.StatusOK,
+			want:       `{"errors":[{"message":"redis is unavailable","path":["video"],"extensions":{"code":"unavailable"}}],"data":{"video":null}}`,
+		},
+		{
+			name:       "unknown window",
+			method:     "POST",
+			target:     "/graphql",
+			body:       `{"query": "{ leaderboard(window: \"year\") { window } }"}`,
+			wantStatus: http.StatusOK,
+			want:       `{"errors":[{"message":"unknown leaderboard window","path":["leaderboard"],"extensions":{"code":"not_found"}}],"data":null}`,
+		},
+		{
+			name:       "invalid video ID",
+			method:     "POST",
+			target:     "/graphql",
+			body:       `{"query": "{ video(id: \"\") { id } }"}`,
+			wantStatus: http.StatusOK,
+			want: `{"errors":[{"message":"invalid argument: id: is empty","path":["video"],` +
+				`"extensions":{"code":"invalid_argument","details":[{"field":"id","rule":"required","message":"is empty"}]}}],"data":{"video":null}}`,
+		},
+		{
+			name:       "invalid query",
+			method:     "POST",
+			target:     "/graphql",
+			body:       `{"query": "{ video { id } }"}`,
+			wantStatus: http.StatusBadRequest,
+			want:       `{"errors":[{"message":"Field \"video\" argument \"id\" of type \"ID!\" is required but not provided.","locations":[{"line":1,"column":3}]}]}`,
+		},
+		{
+			name:       "bad body",
+			method:     "POST",
+			target:     "/graphql",
+			body:       `[`,
+			wantStatus: http.StatusBadRequest,
+			want:       `{"error":{"code":"invalid_argument","message":"invalid argument: body: is not a JSON object","details":[{"field":"body","rule":"format","message":"is not a JSON object"}]}}`,
+		},
+	}
+	//long enough for the fields resolved at the same time to be read together on a busy machine
+	defer func(wait time.Duration) { graphQLBatchWait = wait }(graphQLBatchWait)
+	graphQLBatchWait = 50 * time.Millisecond
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctr := gomock.NewController(t)
+			newMockDB := mockDb.NewMockDatabase(ctr)
+			if tt.mock != nil {
+				tt.mock(newMockDB)
+			}
+			handler := makeRouter(NewService(newMockDB), kitlog.NewNopLogger())
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != tt.want {
+				t.Errorf("body = %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_graphQLSchema(t *testing.T) {
+	if errGraphQLSchema != nil {
+		t.Fatalf("newGraphQLSchema() error = %v", errGraphQLSchema)
+	}
+	w := httptest.NewRecorder()
+	makeRouter(nil, kitlog.NewNopLogger()).ServeHTTP(w, httptest.NewRequest("GET", "/graphql/schema", nil))
+	if got := w.Header().Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	for _, want := range []string{"type Query {", "leaderboard(window: String = \"lifetime\", limit: Int = 10): Leaderboard!", "type Video {"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("schema does not contain %q:\n%s", want, w.Body)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+	"youtube_service/auth"
+	"youtube_service/logging"
+	model "youtube_service/model"
+	"youtube_service/pb"
+	"youtube_service/ratelimit"
+	"youtube_service/validation"
+
+	"github.com/go-kit/kit/endpoint"
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-kit/kit/transport"
+	kitgrpc "github.com/go-kit/kit/transport/grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const grpcServiceName = "youtube_service.v1.Leaderboard"
+
+// the leaderboard of a watch is checked every defaultWatchInterval, never more often than minWatchInterval
+const (
+	defaultWatchInterval = time.Second
+	minWatchInterval     = 100 * time.Millisecond
+)
+
+var errNotOverGRPC = errors.New("not available over gRPC")
+
+type grpcServer struct {
+	pb.UnimplementedLeaderboardServer
+	viewVideo          kitgrpc.Handler
+	getViews           kitgrpc.Handler
+	getTopNVideos      kitgrpc.Handler
+	getTopNVideosToday kitgrpc.Handler
+	postVideo          kitgrpc.Handler
+	//the streams are not served by go-kit, they call the endpoint themselves after the same before funcs
+	watchTopNVideos endpoint.Endpoint
+	before          []kitgrpc.ServerRequestFunc
+}
+
+// MakeGRPCServer serves the endpoints over gRPC with the same authentication, video ID validation
+// and per API key, per client IP and per video rate limits as MakeHandler
+func MakeGRPCServer(s Service, logger kitlog.Logger, options ...HandlerOption) pb.LeaderboardServer {
+	ho := newHandlerOptions(options)
+	before := []kitgrpc.ServerRequestFunc{logging.GRPCToRequestID, auth.GRPCToContext()}
+	opts := []kitgrpc.ServerOption{
+		kitgrpc.ServerErrorHandler(transport.ErrorHandlerFunc(func(ctx context.Context, err error) {
+			level.Error(logging.WithContext(ctx, logger)).Log("err", err)
+		})),
+		kitgrpc.ServerBefore(before...),
+	}
+	viewVideoEndpoint := MakeViewVideoEndpoint(s)
+	if ho.limiter != nil {
+		viewVideoEndpoint = ho.limiter.EndpointMiddleware(videoOfViewRequest)(viewVideoEndpoint)
+		viewVideoEndpoint = ho.limiter.GRPCMiddleware()(viewVideoEndpoint)
+	}
+	return &grpcServer{
+		viewVideo: kitgrpc.NewServer(
+			ho.chain(auth.ScopeIngest, viewVideoEndpoint),
+			decodeGRPCViewVideoRequest,
+			encodeGRPCViewVideoResponse,
+			opts...,
+		),
+		getViews: kitgrpc.NewServer(
+			ho.chain(auth.ScopeRead, MakeGetViewsEndpoint(s)),
+			decodeGRPCGetViewsRequest,
+			encodeGRPCGetViewsResponse,
+			opts...,
+		),
+		getTopNVideos: kitgrpc.NewServer(
+			ho.chain(auth.ScopeRead, MakeGetTopNVideosEndpoint(s)),
+			decodeGRPCGetTopNVideosRequest,
+			encodeGRPCGetTopNVideosResponse,
+			opts...,
+		),
+		getTopNVideosToday: kitgrpc.NewServer(
+			ho.chain(auth.ScopeRead, MakeGetTopNVideosTodayEndpoint(s)),
+			decodeGRPCGetTopNVideosTodayRequest,
+			encodeGRPCGetTopNVideosResponse,
+			opts...,
+		),
+		postVideo: kitgrpc.NewServer(
+			ho.chain(auth.ScopeAdmin, MakePostVideoEndpoint(s)),
+			decodeGRPCPostVideoRequest,
+			encodeGRPCPostVideoResponse,
+			opts...,
+		),
+		watchTopNVideos: ho.chain(auth.ScopeRead, MakeGetTopNVideosEndpoint(s)),
+		before:          before,
+	}
+}
+
+func (s *grpcServer) ViewVideo(ctx context.Context, req *pb.ViewVideoRequest) (*pb.ViewVideoReply, error) {
+	_, resp, err := s.viewVideo.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return resp.(*pb.ViewVideoReply), nil
+}
+
+func (s *grpcServer) GetViews(ctx context.Context, req *pb.GetViewsRequest) (*pb.GetViewsReply, error) {
+	_, resp, err := s.getViews.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return resp.(*pb.GetViewsReply), nil
+}
+
+func (s *grpcServer) GetTopNVideos(ctx context.Context, req *pb.GetTopNVideosRequest) (*pb.GetTopNVideosReply, error) {
+	_, resp, err := s.getTopNVideos.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return resp.(*pb.GetTopNVideosReply), nil
+}
+
+func (s *grpcServer) GetTopNVideosToday(ctx context.Context, req *pb.GetTopNVideosRequest) (*pb.GetTopNVideosReply, error) {
+	_, resp, err := s.getTopNVideosToday.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return resp.(*pb.GetTopNVideosReply), nil
+}
+
+func (s *grpcServer) PostVideo(ctx context.Context, req *pb.PostVideoRequest) (*pb.PostVideoReply, error) {
+	_, resp, err := s.postVideo.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return resp.(*pb.PostVideoReply), nil
+}
+
+// WatchTopNVideos sends the top of the window and then checks it every interval, sending it again
+// when it changed. The credentials are checked on every check so the stream ends once they expire.
+func (s *grpcServer) WatchTopNVideos(req *pb.WatchTopNVideosRequest, stream pb.Leaderboard_WatchTopNVideosServer) error {
+	ctx := stream.Context()
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, f := range s.before {
+		ctx = f(ctx, md)
+	}
+	interval := time.Duration(req.IntervalMillis) * time.Millisecond
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	if interval < minWatchInterval {
+		interval = minWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last *pb.GetTopNVideosReply
+	for {
+		response, err := s.watchTopNVideos(ctx, getTopNvideosRequest{limit: int(req.Limit), window: req.Window})
+		if err == nil {
+			err = response.(getTopNvideosResponse).Err
+		}
+		if err != nil {
+			return grpcError(err)
+		}
+		reply := toPBVideos(response.(getTopNvideosResponse).TopVideos)
+		if last == nil || !proto.Equal(last, reply) {
+			if err := stream.Send(reply); err != nil {
+				return err
+			}
+			last = reply
+		}
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// grpcError returns the status of err, with the code of its HTTP status
+func grpcError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	var invalid *validation.Error
+	var limited *ratelimit.LimitedError
+	code := codes.Internal
+	switch {
+	case errors.As(err, &invalid):
+		code = codes.InvalidArgument
+	case errors.As(err, &limited):
+		code = codes.ResourceExhausted
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	default:
+		switch statusFor(err) {
+		case http.StatusNotFound:
+			code = codes.NotFound
+		case http.StatusBadRequest:
+			code = codes.InvalidArgument
+		case http.StatusUnauthorized:
+			code = codes.Unauthenticated
+		case http.StatusForbidden:
+			code = codes.PermissionDenied
+		case http.StatusServiceUnavailable:
+			code = codes.Unavailable
+		}
+	}
+	return status.Error(code, err.Error())
+}
+
+//server related
+
+func decodeGRPCViewVideoRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.ViewVideoRequest)
+	return viewVideoRequest{videoName: req.VideoName}, nil
+}
+
+func encodeGRPCViewVideoResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(viewVideoResponse)
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	return &pb.ViewVideoReply{}, nil
+}
+
+func decodeGRPCGetViewsRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.GetViewsRequest)
+	return getViewsRequest{videoName: req.VideoName}, nil
+}
+
+func encodeGRPCGetViewsResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(getViewsResponse)
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	return &pb.GetViewsReply{Views: int64(resp.Views)}, nil
+}
+
+func decodeGRPCGetTopNVideosRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.GetTopNVideosRequest)
+	return getTopNvideosRequest{limit: int(req.Limit), window: req.Window}, nil
+}
+
+func decodeGRPCGetTopNVideosTodayRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.GetTopNVideosRequest)
+	return getTopNVideosTodayRequest{limit: int(req.Limit)}, nil
+}
+
+func encodeGRPCGetTopNVideosResponse(_ context.Context, response interface{}) (interface{}, error) {
+	var topVideos []model.ResultRedis
+	var err error
+	switch resp := response.(type) {
+	case getTopNvideosResponse:
+		topVideos, err = resp.TopVideos, resp.Err
+	case getTopNVideosTodayResponse:
+		topVideos, err = resp.TopVideos, resp.Err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return toPBVideos(topVideos), nil
+}
+
+func decodeGRPCPostVideoRequest(_ context.Context, grpcReq interface{}) (interface{}, error) {
+	req := grpcReq.(*pb.PostVideoRequest)
+	return postVideoRequest{videoName: req.VideoName}, nil
+}
+
+func encodeGRPCPostVideoResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(postVideoResponse)
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	return &pb.PostVideoReply{}, nil
+}
+
+func toPBVideos(topVideos []model.ResultRedis) *pb.GetTopNVideosReply {
+	reply := &pb.GetTopNVideosReply{Videos: make([]*pb.Video, len(topVideos))}
+	for i, video := range topVideos {
+		reply.Videos[i] = &pb.Video{VideoId: video.VideoID, ViewCount: int64(video.ViewCount)}
+	}
+	return reply
+}
+
+func fromPBVideos(reply *pb.GetTopNVideosReply) []model.ResultRedis {
+	topVideos := make([]model.ResultRedis, len(reply.Videos))
+	for i, video := range reply.Videos {
+		topVideos[i] = model.ResultRedis{VideoID: video.VideoId, ViewCount: int(video.ViewCount)}
+	}
+	return topVideos
+}
+
+//client related
+
+// MakeGRPCClientEndpoints returns the endpoints of the gRPC server at the other end of conn, like
+// MakeClientEndpoints the calls carry the request id and the bearer token of their context.
+// The imports, exports, history, leaderboard changes, video stats and audit log are only served over HTTP.
+func MakeGRPCClientEndpoints(conn *grpc.ClientConn, clientOptions ...kitgrpc.ClientOption) Endpoints {
+	options := []kitgrpc.ClientOption{
+		kitgrpc.ClientBefore(logging.InjectGRPCRequestID, auth.ContextToGRPC()),
+	}
+	options = append(options, clientOptions...)
+
+	return Endpoints{
+		ViewVideoEndpoint:          kitgrpc.NewClient(conn, grpcServiceName, "ViewVideo", encodeGRPCViewVideoRequest, decodeGRPCViewVideoResponse, &pb.ViewVideoReply{}, options...).Endpoint(),
+		GetTopNVideosEndpoint:      kitgrpc.NewClient(conn, grpcServiceName, "GetTopNVideos", encodeGRPCGetTopNVideosRequest, decodeGRPCGetTopNVideosResponse, &pb.GetTopNVideosReply{}, options...).Endpoint(),
+		GetTopNVideosTodayEndpoint: kitgrpc.NewClient(conn, grpcServiceName, "GetTopNVideosToday", encodeGRPCGetTopNVideosTodayRequest, decodeGRPCGetTopNVideosResponse, &pb.GetTopNVideosReply{}, options...).Endpoint(),
+		GetViewsEndpoint:           kitgrpc.NewClient(conn, grpcServiceName, "GetViews", encodeGRPCGetViewsRequest, decodeGRPCGetViewsResponse, &pb.GetViewsReply{}, options...).Endpoint(),
+		PostVideoEndpoint:          kitgrpc.NewClient(conn, grpcServiceName, "PostVideo", encodeGRPCPostVideoRequest, decodeGRPCPostVideoResponse, &pb.PostVideoReply{}, options...).Endpoint(),
+		ImportViewsEndpoint:        notOverGRPC,
+		ExportVideosEndpoint:       notOverGRPC,
+		GetViewHistoryEndpoint:     notOverGRPC,
+		GetLeaderboardDiffEndpoint: notOverGRPC,
+		GetAuditEntriesEndpoint:    notOverGRPC,
+		GetVideoStatsEndpoint:      notOverGRPC,
+	}
+}
+
+func notOverGRPC(context.Context, interface{}) (interface{}, error) {
+	return nil, errNotOverGRPC
+}
+
+func encodeGRPCViewVideoRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(viewVideoRequest)
+	return &pb.ViewVideoRequest{VideoName: req.videoName}, nil
+}
+
+func decodeGRPCViewVideoResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	return viewVideoResponse{Response: "success"}, nil
+}
+
+func encodeGRPCGetViewsRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(getViewsRequest)
+	return &pb.GetViewsRequest{VideoName: req.videoName}, nil
+}
+
+func decodeGRPCGetViewsResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.GetViewsReply)
+	return getViewsResponse{Views: int(reply.Views)}, nil
+}
+
+func encodeGRPCGetTopNVideosRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(getTopNvideosRequest)
+	return &pb.GetTopNVideosRequest{Limit: int32(req.limit), Window: req.window}, nil
+}
+
+func encodeGRPCGetTopNVideosTodayRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(getTopNVideosTodayRequest)
+	return &pb.GetTopNVideosRequest{Limit: int32(req.limit)}, nil
+}
+
+// both tops decode to a getTopNvideosResponse as Endpoints.GetTopNVideos expects
+func decodeGRPCGetTopNVideosResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	reply := grpcReply.(*pb.GetTopNVideosReply)
+	return getTopNvideosResponse{TopVideos: fromPBVideos(reply)}, nil
+}
+
+func encodeGRPCPostVideoRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(postVideoRequest)
+	return &pb.PostVideoRequest{VideoName: req.videoName}, nil
+}
+
+func decodeGRPCPostVideoResponse(_ context.Context, grpcReply interface{}) (interface{}, error) {
+	return postVideoResponse{}, nil
+}
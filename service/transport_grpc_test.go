@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+	model "youtube_service/model"
+	"youtube_service/pb"
+	"youtube_service/ratelimit"
+	mockDb "youtube_service/repository/mock"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/golang/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dialGRPC serves s over an in-memory listener and returns a connection to it
+func dialGRPC(t *testing.T, s Service, options ...HandlerOption) *grpc.ClientConn {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pb.RegisterLeaderboardServer(server, MakeGRPCServer(s, kitlog.NewNopLogger(), options...))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func Test_grpcTransport(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	top := []model.ResultRedis{{VideoID: "video1", ViewCount: 5}, {VideoID: "video2", ViewCount: 3}}
+	newMockDB.EXPECT().GetScore(gomock.Any(), "video1").Return(float64(5), nil)
+	newMockDB.EXPECT().IncreaseScore(gomock.Any(), "video1", float64(1)).Return(nil)
+	newMockDB.EXPECT().GetSortedRecords(gomock.Any(), 2, true).Return(top, nil)
+	newMockDB.EXPECT().GetSortedRecords(gomock.Any(), 2, false).Return(top[:1], nil)
+
+	endpoints := MakeGRPCClientEndpoints(dialGRPC(t, NewService(newMockDB)))
+	ctx := context.Background()
+
+	if views, err := endpoints.GetViews(ctx, "video1"); err != nil || views != 5 {
+		t.Errorf("GetViews() = %d, %v, want 5", views, err)
+	}
+	if err := endpoints.ViewVideo(ctx, "video1"); err != nil {
+		t.Errorf("ViewVideo() error = %v", err)
+	}
+	if got, err := endpoints.GetTopNVideos(ctx, 2, true); err != nil || !reflect.DeepEqual(got, top) {
+		t.Errorf("GetTopNVideos() = %v, %v, want %v", got, err, top)
+	}
+	if got, err := endpoints.GetTopNVideos(ctx, 2, false); err != nil || !reflect.DeepEqual(got, top[:1]) {
+		t.Errorf("GetTopNVideos(today) = %v, %v, want %v", got, err, top[:1])
+	}
+	if err := endpoints.ViewVideo(ctx, ""); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ViewVideo(\"\") error = %v, want %v", err, codes.InvalidArgument)
+	}
+	if _, err := endpoints.GetTopNVideosInWindow(ctx, 2, "year"); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("GetTopNVideosInWindow(year) error = %v, want %v", err, codes.InvalidArgument)
+	}
+	if _, err := endpoints.GetViewHistory(ctx, "video1", time.Time{}, time.Time{}, GranularityDay); err != errNotOverGRPC {
+		t.Errorf("GetViewHistory() error = %v, want %v", err, errNotOverGRPC)
+	}
+}
+
+func Test_grpcTransport_rateLimits(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	newMockDB.EXPECT().IncreaseScore(gomock.Any(), gomock.Any(), float64(1)).Times(3).Return(nil)
+
+	tests := []struct {
+		name   string
+		limits ratelimit.Limits
+		//call i views videos[i] with apiKeys[i] in the metadata
+		apiKeys  []string
+		videos   []string
+		wantCode []codes.Code
+	}{
+		{
+			name:     "per API key",
+			limits:   ratelimit.Limits{PerAPIKey: ratelimit.Limit{Rate: 0.001, Burst: 1}},
+			apiKeys:  []string{"key1", "key1", "key2"},
+			videos:   []string{"video1", "video2", "video3"},
+			wantCode: []codes.Code{codes.OK, codes.ResourceExhausted, codes.OK},
+		},
+		{
+			name:     "per client IP",
+			limits:   ratelimit.Limits{PerIP: ratelimit.Limit{Rate: 0.001, Burst: 1}},
+			apiKeys:  []string{"key1", "key2"},
+			videos:   []string{"video1", "video2"},
+			wantCode: []codes.Code{codes.OK, codes.ResourceExhausted},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), tt.limits)
+			client := pb.NewLeaderboardClient(dialGRPC(t, NewService(newMockDB), WithRateLimiter(limiter)))
+			for i, apiKey := range tt.apiKeys {
+				ctx := metadata.AppendToOutgoingContext(context.Background(), ratelimit.APIKeyHeader, apiKey)
+				_, err := client.ViewVideo(ctx, &pb.ViewVideoRequest{VideoName: tt.videos[i]})
+				if status.Code(err) != tt.wantCode[i] {
+					t.Errorf("ViewVideo() call %d error = %v, want %v", i, err, tt.wantCode[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_grpcServer_WatchTopNVideos(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	first := []model.ResultRedis{{VideoID: "video1", ViewCount: 5}}
+	second := []model.ResultRedis{{VideoID: "video2", ViewCount: 6}, {VideoID: "video1", ViewCount: 5}}
+	gomock.InOrder(
+		newMockDB.EXPECT().GetSortedRecords(gomock.Any(), 2, false).Return(first, nil).Times(2),
+		newMockDB.EXPECT().GetSortedRecords(gomock.Any(), 2, false).Return(second, nil).AnyTimes(),
+	)
+
+	client := pb.NewLeaderboardClient(dialGRPC(t, NewService(newMockDB)))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.WatchTopNVideos(ctx, &pb.WatchTopNVideosRequest{Limit: 2, Window: WindowToday, IntervalMillis: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the unchanged leaderboard of the second check is not sent again
+	for _, want := range [][]model.ResultRedis{first, second} {
+		reply, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fromPBVideos(reply); !reflect.DeepEqual(got, want) {
+			t.Errorf("Recv() = %v, want %v", got, want)
+		}
+	}
+}
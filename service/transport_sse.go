@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"time"
+	"youtube_service/apierror"
+	model "youtube_service/model"
+	"youtube_service/notify"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+const (
+	// a stream re-reads its leaderboard at most once per minStreamInterval, or per cache max age when it is longer
+	minStreamInterval = 250 * time.Millisecond
+	// comments keeping the idle connections open through the proxies, the leaderboard is also re-read with them
+	heartbeatInterval = 15 * time.Second
+	// reconnection delay asked to the EventSource clients
+	streamRetry = 2 * time.Second
+)
+
+var errStreamingUnsupported = errors.New("streaming unsupported")
+
+// read returns the current top of the stream, the first one is read before the stream starts
+// so an unauthorised or invalid request is answered with an error status
+type streamTopNVideosResponse struct {
+	window string
+	first  getTopNvideosResponse
+	read   func() ([]model.ResultRedis, error)
+}
+
+// makeStreamTopNVideosEndpoint reads the leaderboards of a stream through e, which checks the credentials of every read
+func makeStreamTopNVideosEndpoint(e endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getTopNvideosRequest)
+		first, err := e(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return streamTopNVideosResponse{
+			window: req.window,
+			first:  first.(getTopNvideosResponse),
+			read: func() ([]model.ResultRedis, error) {
+				response, err := e(ctx, req)
+				if err != nil {
+					return nil, err
+				}
+				resp := response.(getTopNvideosResponse)
+				return resp.TopVideos, resp.Err
+			},
+		}, nil
+	}
+}
+
+// flushable keeps the flusher of the response writer in the request context, the kit servers
+// with a finalizer hide it behind their own writer
+func flushable(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if flusher, ok := w.(http.Flusher); ok {
+			r = r.WithContext(context.WithValue(r.Context(), flusherKey, flusher))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func populateLastEventID(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, lastEventIDKey, r.Header.Get("Last-Event-ID"))
+}
+
+// leaderboardEventID identifies the content of a leaderboard, a client resuming with it
+// only gets the leaderboard again once it has changed, on any instance
+func leaderboardEventID(videos []model.ResultRedis) string {
+	h := fnv.New64a()
+	json.NewEncoder(h).Encode(videos)
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// encodeStreamTopNVideosResponse sends the top of the window as a leaderboard event and then again
+// after every change, the changes arriving while a client is slow are merged so only the last top is sent
+func encodeStreamTopNVideosResponse(notifier *notify.Notifier, interval time.Duration) kithttp.EncodeResponseFunc {
+	if interval < minStreamInterval {
+		interval = minStreamInterval
+	}
+	return func(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+		resp := response.(streamTopNVideosResponse)
+		if resp.first.Err != nil {
+			encodeError(ctx, resp.first.Err, w)
+			return nil
+		}
+		flusher, ok := ctx.Value(flusherKey).(http.Flusher)
+		if !ok {
+			encodeError(ctx, errStreamingUnsupported, w)
+			return nil
+		}
+		var changes <-chan struct{}
+		if notifier != nil {
+			var cancel func()
+			changes, cancel = notifier.Subscribe(resp.window)
+			defer cancel()
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		lastID, _ := ctx.Value(lastEventIDKey).(string)
+		write := func(format string, a ...interface{}) error {
+			if _, err := fmt.Fprintf(w, format, a...); err != nil {
+				return err
+			}
+			flusher.Flush()
+			return nil
+		}
+		send := func(videos []model.ResultRedis) error {
+			id := leaderboardEventID(videos)
+			if id == lastID {
+				return nil
+			}
+			lastID = id
+			data, err := json.Marshal(leaderboardResource{Window: resp.window, Videos: videos})
+			if err != nil {
+				return err
+			}
+			return write("id: %s\nevent: leaderboard\ndata: %s\n\n", id, data)
+		}
+		if err := write("retry: %d\n\n", streamRetry.Milliseconds()); err != nil {
+			return nil
+		}
+		if err := send(resp.first.TopVideos); err != nil {
+			return nil
+		}
+
+		//a change is read on the next tick and once more on the one after, the first read can still hit the cache
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+		changed, recheck := false, false
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-changes:
+				changed = true
+			case <-heartbeat.C:
+				if err := write(": heartbeat\n\n"); err != nil {
+					return nil
+				}
+				changed = true
+			case <-ticker.C:
+				if notifier != nil && !changed && !recheck {
+					continue
+				}
+				changed, recheck = false, changed
+				videos, err := resp.read()
+				if err != nil {
+					data, _ := json.Marshal(apierror.Body{Error: apierror.New(ctx, statusFor(err), err)})
+					write("event: error\ndata: %s\n\n", data)
+					return nil
+				}
+				if err := send(videos); err != nil {
+					return nil
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	model "youtube_service/model"
+	"youtube_service/notify"
+	mockDb "youtube_service/repository/mock"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/golang/mock/gomock"
+)
+
+type leaderboardEvent struct {
+	id          string
+	leaderboard leaderboardResource
+}
+
+// nextEvent reads the next leaderboard event of a stream, skipping the retry and heartbeat lines
+func nextEvent(t *testing.T, r *bufio.Reader) leaderboardEvent {
+	var event leaderboardEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			event.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.leaderboard); err != nil {
+				t.Fatal(err)
+			}
+		case line == "" && event.id != "":
+			return event
+		}
+	}
+}
+
+func Test_streamTopNVideos(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	first := []model.ResultRedis{{VideoID: "video1", ViewCount: 5}}
+	second := []model.ResultRedis{{VideoID: "video2", ViewCount: 6}, {VideoID: "video1", ViewCount: 5}}
+	var records atomic.Value
+	records.Store(first)
+	newMockDB.EXPECT().GetSortedRecords(gomock.Any(), 2, false).DoAndReturn(func(interface{}, int, bool) ([]model.ResultRedis, error) {
+		return records.Load().([]model.ResultRedis), nil
+	}).AnyTimes()
+
+	notifier := notify.New(nil)
+	server := httptest.NewServer(MakeHandler(NewService(newMockDB), kitlog.NewNopLogger(), WithNotifier(notifier)))
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/leaderboards/today/stream?limit=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if got := response.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", got)
+	}
+	stream := bufio.NewReader(response.Body)
+	event := nextEvent(t, stream)
+	if !reflect.DeepEqual(event.leaderboard.Videos, first) || event.leaderboard.Window != WindowToday {
+		t.Errorf("first event = %+v, want %v", event.leaderboard, first)
+	}
+	firstID := event.id
+
+	records.Store(second)
+	notifier.Notify(WindowToday)
+	if event := nextEvent(t, stream); !reflect.DeepEqual(event.leaderboard.Videos, second) {
+		t.Errorf("event after the change = %+v, want %v", event.leaderboard, second)
+	}
+
+	//a client resuming from the current leaderboard only gets the next change
+	records.Store(first)
+	request, _ := http.NewRequest(http.MethodGet, server.URL+"/leaderboards/today/stream?limit=2", nil)
+	request.Header.Set("Last-Event-ID", firstID)
+	resumed, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Body.Close()
+	records.Store(second)
+	notifier.Notify(WindowToday)
+	if event := nextEvent(t, bufio.NewReader(resumed.Body)); !reflect.DeepEqual(event.leaderboard.Videos, second) {
+		t.Errorf("resumed event = %+v, want %v", event.leaderboard, second)
+	}
+}
+
+func Test_streamTopNVideos_unknownWindow(t *testing.T) {
+	ctr := gomock.NewController(t)
+	w := httptest.NewRecorder()
+	MakeHandler(NewService(mockDb.NewMockDatabase(ctr)), kitlog.NewNopLogger()).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/leaderboards/year/stream", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,360 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+	"unicode/utf8"
+	"youtube_service/apierror"
+	"youtube_service/auth"
+	"youtube_service/logging"
+	model "youtube_service/model"
+	"youtube_service/ratelimit"
+	db "youtube_service/repository"
+	mockDb "youtube_service/repository/mock"
+	"youtube_service/validation"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+)
+
+// adminKey is the API key of testAuthenticator, it is granted every scope
+const adminKey = "admin-key"
+
+func testAuthenticator(t *testing.T) HandlerOption {
+	authenticator, err := auth.NewAuthenticator(auth.Config{
+		Enabled: true,
+		APIKeys: []auth.APIKey{{Name: "admin", Key: adminKey, Scopes: []string{auth.ScopeAdmin}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return WithAuthenticator(authenticator)
+}
+
+// decoded checks that a decoder either succeeded or rejected the request with a validation.Error
+func decoded(t *testing.T, request interface{}, err error) {
+	var invalid *validation.Error
+	if err != nil && !errors.As(err, &invalid) {
+		t.Fatalf("decoder error %v is not a validation.Error", err)
+	}
+	if err == nil && request == nil {
+		t.Fatal("decoder returned neither a request nor an error")
+	}
+}
+
+// normalized checks that the video IDs let through by the default rules are non-empty valid UTF-8 without control characters
+func normalized(t *testing.T, request interface{}) {
+	request, err := normalizeRequest(context.Background(), defaultValidator(t), request)
+	if err != nil {
+		return
+	}
+	var id string
+	switch req := request.(type) {
+	case viewVideoRequest:
+		id = req.videoName
+	case getViewsRequest:
+		id = req.videoName
+	case postVideoRequest:
+		id = req.videoName
+	case getViewHistoryRequest:
+		id = req.videoName
+	default:
+		return
+	}
+	if id == "" || !utf8.ValidString(id) || strings.IndexFunc(id, unicode.IsControl) >= 0 {
+		t.Fatalf("normalizeRequest let %q through", id)
+	}
+}
+
+func defaultValidator(t *testing.T) *validation.Validator {
+	v, err := validation.New(validation.Rules{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func FuzzDecodeQuery(f *testing.F) {
+	for _, query := range []string{
+		"videoName=video1",
+		"videoName=",
+		"videoName=%00",
+		"videoName=%FF%FE",
+		"limit=10",
+		"limit=-1",
+		"limit=abc",
+		"dryRun=maybe&resumeFrom=2&batchSize=x",
+		"since=2023-01-02&until=2023-01-03T00:00:00Z&limit=1",
+		"window=week&limit=99999999999999999999",
+	} {
+		f.Add(query)
+	}
+	decoders := map[string]func(context.Context, *http.Request) (interface{}, error){
+		"viewVideo":       decodeViewVideoRequest,
+		"getViews":        decodeGetViewsRequest,
+		"getNvideos":      decodeGetNvideosRequest,
+		"getNvideosToday": decodeGetNvideosTodayRequest,
+		"importViews":     decodeImportViewsRequest,
+		"leaderboardDiff": decodeGetLeaderboardDiffRequest,
+		"auditEntries":    decodeGetAuditEntriesRequest,
+	}
+	f.Fuzz(func(t *testing.T, query string) {
+		for name, decode := range decoders {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.URL.RawQuery = query
+			request, err := decode(context.Background(), r)
+			decoded(t, request, err)
+			if err != nil {
+				continue
+			}
+			if name != "importViews" {
+				normalized(t, request)
+			}
+		}
+	})
+}
+
+func FuzzDecodePostVideoRequest(f *testing.F) {
+	for _, body := range []string{`{"videoName":"video1"}`, `{"videoName":""}`, `{"videoName":"\u0000"}`, `[]`, `{`, ``} {
+		f.Add(body)
+	}
+	f.Fuzz(func(t *testing.T, body string) {
+		r := httptest.NewRequest(http.MethodPost, "/videos", strings.NewReader(body))
+		request, err := decodePostVideoRequest(context.Background(), r)
+		decoded(t, request, err)
+		if err == nil {
+			normalized(t, request)
+		}
+	})
+}
+
+func FuzzDecodeGetViewHistoryRequest(f *testing.F) {
+	f.Add("video1", "2023-01-01", "2023-01-31T00:00:00Z")
+	f.Add("", "", "")
+	f.Add("video\x7f", "yesterday", "2023-13-01")
+	f.Fuzz(func(t *testing.T, id, from, to string) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.URL.RawQuery = url.Values{"from": {from}, "to": {to}}.Encode()
+		r = mux.SetURLVars(r, map[string]string{"id": id})
+		request, err := decodeGetViewHistoryRequest(context.Background(), r)
+		decoded(t, request, err)
+		if err == nil {
+			normalized(t, request)
+		}
+	})
+}
+
+func Test_validateVideoIDs(t *testing.T) {
+	v, err := validation.New(validation.Rules{MaxLength: 8, Pattern: "[a-z0-9_-]+", FoldCase: true, Trim: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got interface{}
+	e := validateVideoIDs(v)(func(ctx context.Context, request interface{}) (interface{}, error) {
+		got = request
+		return nil, nil
+	})
+	tests := []struct {
+		name     string
+		request  interface{}
+		want     interface{}
+		wantRule string
+	}{
+		{name: "normalised", request: viewVideoRequest{videoName: " Video1 "}, want: viewVideoRequest{videoName: "video1"}},
+		{name: "history id", request: getViewHistoryRequest{videoName: "VIDEO2"}, want: getViewHistoryRequest{videoName: "video2"}},
+		{name: "empty after trimming", request: getViewsRequest{videoName: "  "}, wantRule: validation.RuleRequired},
+		{name: "too long", request: postVideoRequest{videoName: "video123456"}, wantRule: validation.RuleMaxLength},
+		{name: "outside the pattern", request: viewVideoRequest{videoName: "vidéo"}, wantRule: validation.RulePattern},
+		{name: "control characters", request: viewVideoRequest{videoName: "a\x00b"}, wantRule: validation.RuleCharset},
+		{name: "other requests", request: getTopNvideosRequest{limit: 3}, want: getTopNvideosRequest{limit: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			_, err := e(context.Background(), tt.request)
+			var invalid *validation.Error
+			if tt.wantRule != "" {
+				if !errors.As(err, &invalid) || invalid.Fields[0].Rule != tt.wantRule {
+					t.Fatalf("error = %v, want the %s rule", err, tt.wantRule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("request = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_error_roundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "known", err: db.ErrUnknown, wantStatus: http.StatusNotFound, wantCode: apierror.CodeNotFound},
+		{name: "auth", err: auth.ErrUnauthenticated, wantStatus: http.StatusUnauthorized, wantCode: apierror.CodeUnauthenticated},
+		{name: "invalid", err: validation.NewError("limit", validation.RuleFormat, "is not an integer"), wantStatus: http.StatusBadRequest, wantCode: apierror.CodeInvalidArgument},
+		{name: "limited", err: &ratelimit.LimitedError{Scope: "video", RetryAfter: 2 * time.Second}, wantStatus: http.StatusTooManyRequests, wantCode: apierror.CodeRateLimited},
+		{name: "unknown", err: errors.New("boom"), wantStatus: http.StatusInternalServerError, wantCode: apierror.CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			encodeError(logging.ContextWithRequestID(context.Background(), "req1"), tt.err, w)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			err := decodeError(w.Result())
+			var got *apierror.Error
+			if !errors.As(err, &got) {
+				t.Fatalf("err = %#v, want an *apierror.Error", err)
+			}
+			if got.Code != tt.wantCode || got.Status != tt.wantStatus || got.RequestID != "req1" || got.Message != tt.err.Error() {
+				t.Errorf("err = %+v, want code %s, status %d and request id req1", got, tt.wantCode, tt.wantStatus)
+			}
+			var invalid *validation.Error
+			var limited *ratelimit.LimitedError
+			switch {
+			case errors.As(tt.err, &invalid):
+				var gotInvalid *validation.Error
+				if !errors.As(err, &gotInvalid) || !reflect.DeepEqual(gotInvalid.Fields, invalid.Fields) {
+					t.Errorf("fields = %+v, want %+v", gotInvalid, invalid.Fields)
+				}
+			case errors.As(tt.err, &limited):
+				var gotLimited *ratelimit.LimitedError
+				if !errors.As(err, &gotLimited) || *gotLimited != *limited {
+					t.Errorf("limited = %+v, want %+v", gotLimited, limited)
+				}
+			case statusFor(tt.err) != http.StatusInternalServerError:
+				if !errors.Is(err, tt.err) {
+					t.Errorf("err = %v, want it to wrap %v", err, tt.err)
+				}
+			default:
+				if got.Err != nil {
+					t.Errorf("unwrapped = %v, want nil", got.Err)
+				}
+			}
+		})
+	}
+}
+
+// the admin routes and the v2 writes are only served with an authenticator
+func Test_makeRouter_adminRoutes(t *testing.T) {
+	ctr := gomock.NewController(t)
+	s := NewService(mockDb.NewMockDatabase(ctr))
+	tests := []struct {
+		method string
+		target string
+		body   string
+	}{
+		{method: "POST", target: "/admin/import?format=csv", body: "video1,5\n"},
+		{method: "GET", target: "/admin/audit"},
+		{method: "POST", target: "/v2/videos", body: `{"id": "video1"}`},
+		{method: "POST", target: "/v2/videos/video1/views"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			makeRouter(s, kitlog.NewNopLogger()).ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+			if w.Code != http.StatusNotFound && w.Code != http.StatusMethodNotAllowed {
+				t.Errorf("status without authentication = %d, want the route not served", w.Code)
+			}
+			w = httptest.NewRecorder()
+			makeRouter(s, kitlog.NewNopLogger(), testAuthenticator(t)).ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("status without credentials = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+// the errors answered to the client endpoints are the typed errors of the service
+func Test_client_errors(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	newMockDB.EXPECT().GetScore(gomock.Any(), "video2").Return(float64(0), db.ErrUnknown)
+	server := httptest.NewServer(MakeHandler(NewService(newMockDB), kitlog.NewNopLogger()))
+	defer server.Close()
+	client, err := MakeClientEndpoints(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.GetViews(context.Background(), "video2")
+	var apiErr *apierror.Error
+	if !errors.Is(err, db.ErrUnknown) || !errors.As(err, &apiErr) || apiErr.RequestID == "" {
+		t.Errorf("err = %#v, want db.ErrUnknown with a request id", err)
+	}
+	_, err = client.GetLeaderboardDiff(context.Background(), "year", 10)
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("err = %#v, want ErrInvalidArgument", err)
+	}
+	_, err = client.GetViews(context.Background(), "")
+	var invalid *validation.Error
+	if !errors.As(err, &invalid) || invalid.Fields[0].Field != "videoName" {
+		t.Errorf("err = %#v, want a validation.Error of the videoName", err)
+	}
+}
+
+// the load balanced client wraps the server endpoints in Endpoints
+func Test_Endpoints_serverEndpoints(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	top := []model.ResultRedis{{VideoID: "video1", ViewCount: 5}}
+	newMockDB.EXPECT().GetSortedRecords(gomock.Any(), 1, false).Return(top, nil)
+	endpoints := Endpoints{GetTopNVideosTodayEndpoint: MakeGetTopNVideosTodayEndpoint(NewService(newMockDB))}
+	got, err := endpoints.GetTopNVideos(context.Background(), 1, false)
+	if err != nil || !reflect.DeepEqual(got, top) {
+		t.Errorf("GetTopNVideos() = %v, %v, want %v", got, err, top)
+	}
+}
+
+func Test_decodeExportVideosRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		accept     string
+		wantFormat string
+		wantStatus int
+	}{
+		{name: "default", target: "/export", wantFormat: FormatNDJSON},
+		{name: "format parameter", target: "/export?format=csv", accept: "application/x-ndjson", wantFormat: FormatCSV},
+		{name: "accept header", target: "/export", accept: "text/csv", wantFormat: FormatCSV},
+		{name: "any media type", target: "/export", accept: "*/*", wantFormat: FormatNDJSON},
+		{name: "columnar format", target: "/export?format=columnar", wantStatus: http.StatusBadRequest},
+		{name: "json accepted", target: "/export", accept: "application/json", wantStatus: http.StatusNotAcceptable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+			r.Header.Set("Accept", tt.accept)
+			request, err := decodeExportVideosRequest(context.Background(), r)
+			if tt.wantStatus != 0 {
+				if err == nil || statusFor(err) != tt.wantStatus {
+					t.Fatalf("decodeExportVideosRequest() error = %v, want status %d", err, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeExportVideosRequest() error = %v", err)
+			}
+			if got := request.(exportVideosRequest).format; got != tt.wantFormat {
+				t.Errorf("format = %q, want %q", got, tt.wantFormat)
+			}
+		})
+	}
+}
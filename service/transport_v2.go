@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	model "youtube_service/model"
+	"youtube_service/validation"
+
+	"github.com/gorilla/mux"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// the top of a leaderboard has defaultLeaderboardLimit videos when the limit is not set
+const defaultLeaderboardLimit = 10
+
+var errUnknownWindow = errors.New("unknown leaderboard window")
+
+// v2Envelope wraps every successful v2 response
+type v2Envelope struct {
+	Data interface{} `json:"data"`
+}
+
+type v2PostVideoBody struct {
+	ID string `json:"id"`
+}
+
+type videoResource struct {
+	ID    string `json:"id"`
+	Views int    `json:"views"`
+}
+
+type viewResource struct {
+	VideoID string `json:"videoId"`
+}
+
+type leaderboardResource struct {
+	Window string              `json:"window"`
+	Videos []model.ResultRedis `json:"videos"`
+}
+
+// addV2Routes serves the resources of e under router, e are the endpoints of MakeHandler with their
+// authentication, validation and per video rate limits
+func addV2Routes(router *mux.Router, e Endpoints, ho handlerOptions, opts []kithttp.ServerOption) {
+	opts = append(opts[:len(opts):len(opts)], kithttp.ServerBefore(withVideoIDField("id")))
+
+	postVideoHandler := kithttp.NewServer(
+		e.PostVideoEndpoint,
+		decodeV2PostVideoRequest,
+		encodeV2PostVideoResponse,
+		opts...,
+	)
+	viewVideoHandler := kithttp.NewServer(
+		e.ViewVideoEndpoint,
+		decodeV2ViewVideoRequest,
+		encodeV2Response(http.StatusOK, func(response interface{}) interface{} {
+			return viewResource{VideoID: response.(viewVideoResponse).videoName}
+		}),
+		opts...,
+	)
+	getVideoHandler := kithttp.NewServer(
+		e.GetViewsEndpoint,
+		decodeV2GetVideoRequest,
+		encodeV2Response(http.StatusOK, func(response interface{}) interface{} {
+			resp := response.(getViewsResponse)
+			return videoResource{ID: resp.videoName, Views: resp.Views}
+		}),
+		opts...,
+	)
+	getLeaderboardHandler := kithttp.NewServer(
+		e.GetTopNVideosEndpoint,
+		decodeV2GetLeaderboardRequest,
+		cacheableEncoder(ho.cacheMaxAge, encodeV2Response(http.StatusOK, func(response interface{}) interface{} {
+			resp := response.(getTopNvideosResponse)
+			return leaderboardResource{Window: resp.window, Videos: resp.TopVideos}
+		})),
+		opts...,
+	)
+
+	if ho.authenticator != nil {
+		router.Handle("/videos", ho.idempotent(postVideoHandler)).Methods("POST")
+		router.Handle("/videos/{id}/views", ho.idempotent(ho.limitV2(viewVideoHandler))).Methods("POST")
+	}
+	router.Handle("/videos/{id}", getVideoHandler).Methods("GET")
+	router.Handle("/leaderboards/{window}", getLeaderboardHandler).Methods("GET")
+}
+
+// limitV2 limits the requests per API key and per client IP like the legacy routes
+func (o handlerOptions) limitV2(h http.Handler) http.Handler {
+	if o.limiter == nil {
+		return h
+	}
+	return o.limiter.HTTPMiddleware(h)
+}
+
+// deprecated marks a legacy route, successor is the v2 route replacing it
+func deprecated(successor string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		h.ServeHTTP(w, r)
+	})
+}
+
+func decodeV2PostVideoRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	var body v2PostVideoBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, validation.NewError("body", validation.RuleFormat, "is not a JSON object")
+	}
+	return postVideoRequest{videoName: body.ID}, nil
+}
+
+func decodeV2ViewVideoRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	return viewVideoRequest{videoName: mux.Vars(r)["id"]}, nil
+}
+
+func decodeV2GetVideoRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	return getViewsRequest{videoName: mux.Vars(r)["id"]}, nil
+}
+
+// the window is one of the leaderboards, the limit defaults to defaultLeaderboardLimit
+func decodeV2GetLeaderboardRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	req := getTopNvideosRequest{window: mux.Vars(r)["window"], limit: defaultLeaderboardLimit}
+	if !isValidWindow(req.window) {
+		return nil, errUnknownWindow
+	}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if req.limit, err = intParam("limit", value); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// encodeV2PostVideoResponse answers 201 with the location of the new video
+func encodeV2PostVideoResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(postVideoResponse)
+	if resp.Err == nil {
+		w.Header().Set("Location", "/v2/videos/"+url.PathEscape(resp.videoName))
+	}
+	return encodeV2Response(http.StatusCreated, func(response interface{}) interface{} {
+		return videoResource{ID: resp.videoName}
+	})(ctx, w, response)
+}
+
+// encodeV2Response writes the resource of a successful response in the data envelope with status
+func encodeV2Response(status int, resource func(response interface{}) interface{}) kithttp.EncodeResponseFunc {
+	return func(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+		if e, ok := response.(errorer); ok && e.error() != nil {
+			encodeError(ctx, e.error(), w)
+			return nil
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(status)
+		return json.NewEncoder(w).Encode(v2Envelope{Data: resource(response)})
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"youtube_service/apierror"
+	"youtube_service/auth"
+	model "youtube_service/model"
+	mockDb "youtube_service/repository/mock"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/golang/mock/gomock"
+)
+
+func Test_v2Routes(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	top := []model.ResultRedis{{VideoID: "video1", ViewCount: 5}}
+	newMockDB.EXPECT().Set(gomock.Any(), "video1", float64(0)).Return(nil)
+	newMockDB.EXPECT().IncreaseScore(gomock.Any(), "video1", float64(1)).Return(nil)
+	newMockDB.EXPECT().GetScore(gomock.Any(), "video1").Return(float64(5), nil)
+	newMockDB.EXPECT().GetSortedRecords(gomock.Any(), 10, false).Return(top, nil)
+
+	handler := MakeHandler(NewService(newMockDB), kitlog.NewNopLogger(), testAuthenticator(t))
+	tests := []struct {
+		name         string
+		method       string
+		target       string
+		body         string
+		wantStatus   int
+		wantData     interface{}
+		wantError    string
+		wantField    string
+		wantLocation string
+	}{
+		{name: "post video", method: "POST", target: "/v2/videos", body: `{"id": "video1"}`, wantStatus: http.StatusCreated,
+			wantData: map[string]interface{}{"id": "video1", "views": float64(0)}, wantLocation: "/v2/videos/video1"},
+		{name: "post bad body", method: "POST", target: "/v2/videos", body: `[`, wantStatus: http.StatusBadRequest,
+			wantError: "invalid_argument", wantField: "body"},
+		{name: "view video", method: "POST", target: "/v2/videos/video1/views", wantStatus: http.StatusOK,
+			wantData: map[string]interface{}{"videoId": "video1"}},
+		{name: "get video", method: "GET", target: "/v2/videos/video1", wantStatus: http.StatusOK,
+			wantData: map[string]interface{}{"id": "video1", "views": float64(5)}},
+		{name: "invalid id", method: "GET", target: "/v2/videos/a%00b", wantStatus: http.StatusBadRequest,
+			wantError: "invalid_argument", wantField: "id"},
+		{name: "leaderboard", method: "GET", target: "/v2/leaderboards/today", wantStatus: http.StatusOK,
+			wantData: map[string]interface{}{"window": "today", "videos": []interface{}{map[string]interface{}{"videoID": "video1", "viewCount": float64(5)}}}},
+		{name: "unknown window", method: "GET", target: "/v2/leaderboards/year", wantStatus: http.StatusNotFound,
+			wantError: "not_found"},
+		{name: "bad limit", method: "GET", target: "/v2/leaderboards/today?limit=ten", wantStatus: http.StatusBadRequest,
+			wantError: "invalid_argument", wantField: "limit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			r.Header.Set(auth.APIKeyHeader, adminKey)
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if got := w.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+			var body struct {
+				Data  interface{}     `json:"data"`
+				Error *apierror.Error `json:"error"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantError == "" {
+				if body.Error != nil || !reflect.DeepEqual(body.Data, tt.wantData) {
+					t.Errorf("body = %+v, want data %v", body, tt.wantData)
+				}
+				return
+			}
+			if body.Error == nil || body.Error.Code != tt.wantError {
+				t.Fatalf("error = %+v, want code %s", body.Error, tt.wantError)
+			}
+			if tt.wantField != "" && (len(body.Error.Details) != 1 || body.Error.Details[0].Field != tt.wantField) {
+				t.Errorf("details = %+v, want %s", body.Error.Details, tt.wantField)
+			}
+		})
+	}
+}
+
+func Test_legacyRoutes_deprecated(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	newMockDB.EXPECT().GetScore(gomock.Any(), "video1").Return(float64(5), nil)
+
+	w := httptest.NewRecorder()
+	MakeHandler(NewService(newMockDB), kitlog.NewNopLogger()).ServeHTTP(w, httptest.NewRequest("GET", "/getViews?videoName=video1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if w.Header().Get("Deprecation") != "true" || w.Header().Get("Link") != `</v2/videos/{id}>; rel="successor-version"` {
+		t.Errorf("headers = %v, want the deprecation and successor link", w.Header())
+	}
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+	"youtube_service/apierror"
+	"youtube_service/auth"
+	"youtube_service/logging"
+	"youtube_service/notify"
+	db "youtube_service/repository"
+	"youtube_service/validation"
+
+	"github.com/go-kit/kit/endpoint"
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// videos a live counter connection can subscribe to at most
+	maxLiveCountVideos = 100
+	// size of the largest message accepted from a client
+	maxLiveCountsRequestSize = 64 << 10
+	// time allowed to write a message before the client is dropped
+	liveCountsWriteWait = 10 * time.Second
+	// pings keep the idle connections open, every count is also read again with them
+	liveCountsPingPeriod = 30 * time.Second
+	// time allowed to the client to answer a ping
+	liveCountsPongWait = 2 * liveCountsPingPeriod
+)
+
+// liveCountsRequest is a message of a client, the videos are added to or removed from its subscription
+type liveCountsRequest struct {
+	Subscribe   []string `json:"subscribe"`
+	Unsubscribe []string `json:"unsubscribe"`
+}
+
+// liveCountsMessage is a message of the server with the views of the videos changed since the last one
+// or the error of a request
+type liveCountsMessage struct {
+	Counts map[string]int  `json:"counts,omitempty"`
+	Error  *apierror.Error `json:"error,omitempty"`
+}
+
+// makeLiveCountsHandler serves the live view counters over a WebSocket, the counts are read through getViews
+// when the videos notifier is told about their views, at most maxRate times per second
+func makeLiveCountsHandler(getViews endpoint.Endpoint, ho handlerOptions, logger kitlog.Logger) http.Handler {
+	upgrader := websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+	check := ho.authorize(auth.ScopeRead, func(ctx context.Context, request interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := auth.HTTPToContext()(r.Context(), r)
+		if _, err := check(ctx, nil); err != nil {
+			encodeError(ctx, err, w)
+			return
+		}
+		rate := ho.liveCountsMaxRate
+		if value := r.URL.Query().Get("maxRate"); value != "" {
+			asked, err := strconv.ParseFloat(value, 64)
+			if err != nil || asked <= 0 {
+				encodeError(ctx, validation.NewError("maxRate", validation.RuleFormat, "is not a positive number"), w)
+				return
+			}
+			if asked < rate {
+				rate = asked
+			}
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			//the upgrader already answered with an error status
+			return
+		}
+		lc := &liveCounts{
+			conn:      conn,
+			getViews:  getViews,
+			validator: ho.validator,
+			sub:       ho.liveCounts.NewSubscription(),
+			interval:  time.Duration(float64(time.Second) / rate),
+			added:     make(chan []string, 1),
+			messages:  make(chan liveCountsMessage, 1),
+			done:      make(chan struct{}),
+		}
+		if err := lc.run(ctx); err != nil {
+			level.Debug(logging.WithContext(ctx, logger)).Log("method", "LiveCounts", "err", err)
+		}
+	})
+}
+
+// liveCounts is a live counter connection, only run writes to conn
+type liveCounts struct {
+	conn      *websocket.Conn
+	getViews  endpoint.Endpoint
+	validator *validation.Validator
+	sub       *notify.Subscription
+	interval  time.Duration
+	// the videos just subscribed to, their counts are sent with the next message
+	added    chan []string
+	messages chan liveCountsMessage
+	// closed once run returns so read stops handing it anything
+	done chan struct{}
+}
+
+// run sends the counts changed since the last message every interval until the client goes away
+func (lc *liveCounts) run(ctx context.Context) error {
+	defer lc.conn.Close()
+	defer lc.sub.Close()
+	defer close(lc.done)
+	read := make(chan error, 1)
+	go func() { read <- lc.read(ctx) }()
+
+	ticker := time.NewTicker(lc.interval)
+	defer ticker.Stop()
+	ping := time.NewTicker(liveCountsPingPeriod)
+	defer ping.Stop()
+	pending := map[string]struct{}{}
+	for {
+		select {
+		case err := <-read:
+			return err
+		case videos := <-lc.added:
+			for _, video := range videos {
+				pending[video] = struct{}{}
+			}
+		case message := <-lc.messages:
+			if err := lc.write(message); err != nil {
+				return err
+			}
+		case <-ping.C:
+			lc.conn.SetWriteDeadline(time.Now().Add(liveCountsWriteWait))
+			if err := lc.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return err
+			}
+			for _, video := range lc.sub.Topics() {
+				pending[video] = struct{}{}
+			}
+		case <-ticker.C:
+			for _, video := range lc.sub.Changed() {
+				pending[video] = struct{}{}
+			}
+			if len(pending) == 0 {
+				continue
+			}
+			message := lc.counts(ctx, pending)
+			pending = map[string]struct{}{}
+			if err := lc.write(message); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// counts reads the views of videos, the videos without views yet count zero
+func (lc *liveCounts) counts(ctx context.Context, videos map[string]struct{}) liveCountsMessage {
+	message := liveCountsMessage{Counts: map[string]int{}}
+	for video := range videos {
+		response, err := lc.getViews(ctx, getViewsRequest{videoName: video})
+		if err == nil {
+			err = response.(getViewsResponse).Err
+		}
+		switch {
+		case err == nil:
+			message.Counts[video] = response.(getViewsResponse).Views
+		case err == db.ErrUnknown:
+			message.Counts[video] = 0
+		default:
+			message.Error = apierror.New(ctx, statusFor(err), err)
+		}
+	}
+	return message
+}
+
+func (lc *liveCounts) write(message liveCountsMessage) error {
+	lc.conn.SetWriteDeadline(time.Now().Add(liveCountsWriteWait))
+	return lc.conn.WriteJSON(message)
+}
+
+// read applies the requests of the client until it goes away, a client which stops reading its
+// messages holds up this loop and is dropped once a write times out
+func (lc *liveCounts) read(ctx context.Context) error {
+	lc.conn.SetReadLimit(maxLiveCountsRequestSize)
+	lc.conn.SetReadDeadline(time.Now().Add(liveCountsPongWait))
+	lc.conn.SetPongHandler(func(string) error {
+		return lc.conn.SetReadDeadline(time.Now().Add(liveCountsPongWait))
+	})
+	for {
+		_, data, err := lc.conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		var req liveCountsRequest
+		if json.Unmarshal(data, &req) != nil {
+			err = validation.NewError("request", validation.RuleFormat, "is not a JSON object")
+		} else {
+			err = lc.apply(req)
+		}
+		if err == nil {
+			continue
+		}
+		message := liveCountsMessage{Error: apierror.New(ctx, statusFor(err), err)}
+		select {
+		case lc.messages <- message:
+		case <-lc.done:
+			return nil
+		}
+	}
+}
+
+// apply normalises the video IDs of req and changes the subscription, nothing is changed when one of
+// them is invalid and only the unsubscriptions when there would be too many videos
+func (lc *liveCounts) apply(req liveCountsRequest) error {
+	subscribe, err := lc.normalize("subscribe", req.Subscribe)
+	if err != nil {
+		return err
+	}
+	unsubscribe, err := lc.normalize("unsubscribe", req.Unsubscribe)
+	if err != nil {
+		return err
+	}
+	lc.sub.Remove(unsubscribe...)
+	videos := map[string]struct{}{}
+	for _, video := range append(lc.sub.Topics(), subscribe...) {
+		videos[video] = struct{}{}
+	}
+	if len(videos) > maxLiveCountVideos {
+		return validation.NewError("subscribe", validation.RuleMaxLength, "has more than "+strconv.Itoa(maxLiveCountVideos)+" videos")
+	}
+	lc.sub.Add(subscribe...)
+	if len(subscribe) > 0 {
+		select {
+		case lc.added <- subscribe:
+		case <-lc.done:
+		}
+	}
+	return nil
+}
+
+func (lc *liveCounts) normalize(field string, ids []string) ([]string, error) {
+	normalized := make([]string, 0, len(ids))
+	var fields []validation.FieldError
+	for _, id := range ids {
+		id, invalid := lc.validator.VideoID(field, id)
+		if invalid != nil {
+			fields = append(fields, invalid.Fields...)
+			continue
+		}
+		normalized = append(normalized, id)
+	}
+	if len(fields) > 0 {
+		return nil, &validation.Error{Fields: fields}
+	}
+	return normalized, nil
+}
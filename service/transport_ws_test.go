@@ -0,0 +1,80 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"youtube_service/notify"
+	db "youtube_service/repository"
+	mockDb "youtube_service/repository/mock"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/websocket"
+)
+
+func Test_liveCounts(t *testing.T) {
+	ctr := gomock.NewController(t)
+	newMockDB := mockDb.NewMockDatabase(ctr)
+	gomock.InOrder(
+		newMockDB.EXPECT().GetScore(gomock.Any(), "video1").Return(float64(5), nil),
+		newMockDB.EXPECT().GetScore(gomock.Any(), "video1").Return(float64(7), nil).AnyTimes(),
+	)
+	newMockDB.EXPECT().GetScore(gomock.Any(), "video2").Return(float64(0), db.ErrUnknown)
+
+	videos := notify.New(nil)
+	server := httptest.NewServer(MakeHandler(NewService(newMockDB), kitlog.NewNopLogger(), WithLiveCounts(videos, 50)))
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/videos/live", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	//the counts of the new subscriptions are sent right away, the unknown videos count zero
+	if err := conn.WriteJSON(liveCountsRequest{Subscribe: []string{"video1", "video2"}}); err != nil {
+		t.Fatal(err)
+	}
+	var message liveCountsMessage
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatal(err)
+	}
+	if message.Counts["video1"] != 5 || message.Counts["video2"] != 0 || len(message.Counts) != 2 {
+		t.Errorf("counts = %v, want video1 5 and video2 0", message.Counts)
+	}
+
+	//the views of video1 are merged into one update
+	videos.Notify("video1")
+	videos.Notify("video1")
+	message = liveCountsMessage{}
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatal(err)
+	}
+	if len(message.Counts) != 1 || message.Counts["video1"] != 7 {
+		t.Errorf("counts = %v, want video1 7", message.Counts)
+	}
+
+	if err := conn.WriteJSON(liveCountsRequest{Subscribe: []string{"a\x00b"}}); err != nil {
+		t.Fatal(err)
+	}
+	message = liveCountsMessage{}
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatal(err)
+	}
+	if message.Error == nil || len(message.Error.Details) != 1 || message.Error.Details[0].Field != "subscribe" {
+		t.Errorf("message = %+v, want an error on the subscribe field", message)
+	}
+}
+
+func Test_liveCounts_maxRate(t *testing.T) {
+	ctr := gomock.NewController(t)
+	handler := MakeHandler(NewService(mockDb.NewMockDatabase(ctr)), kitlog.NewNopLogger(), WithLiveCounts(notify.New(nil), 4))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/videos/live?maxRate=-1", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"youtube_service/validation"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// validateVideoIDs normalises the video IDs of the requests with v, the invalid ones are rejected with a validation.Error
+func validateVideoIDs(v *validation.Validator) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			request, err := normalizeRequest(ctx, v, request)
+			if err != nil {
+				return nil, err
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+type videoIDFieldKey struct{}
+
+// withVideoIDField names the video ID field of the requests in their field errors, videoName by default
+func withVideoIDField(field string) kithttp.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		return context.WithValue(ctx, videoIDFieldKey{}, field)
+	}
+}
+
+func normalizeRequest(ctx context.Context, v *validation.Validator, request interface{}) (interface{}, error) {
+	field, ok := ctx.Value(videoIDFieldKey{}).(string)
+	if !ok {
+		field = "videoName"
+	}
+	var verr *validation.Error
+	switch req := request.(type) {
+	case viewVideoRequest:
+		req.videoName, verr = v.VideoID(field, req.videoName)
+		request = req
+	case getViewsRequest:
+		req.videoName, verr = v.VideoID(field, req.videoName)
+		request = req
+	case postVideoRequest:
+		req.videoName, verr = v.VideoID(field, req.videoName)
+		request = req
+	case getViewHistoryRequest:
+		req.videoName, verr = v.VideoID("id", req.videoName)
+		request = req
+	case getVideoStatsRequest:
+		videoNames := make([]string, len(req.videoNames))
+		for i, videoName := range req.videoNames {
+			if videoNames[i], verr = v.VideoID("id", videoName); verr != nil {
+				break
+			}
+		}
+		req.videoNames = videoNames
+		request = req
+	case getAuditEntriesRequest:
+		if req.filter.VideoID != "" {
+			req.filter.VideoID, verr = v.VideoID("videoName", req.filter.VideoID)
+		}
+		request = req
+	case importViewsRequest:
+		req.opts.NormalizeVideoID = ImportVideoIDs(v)
+		request = req
+	}
+	if verr != nil {
+		return nil, verr
+	}
+	return request, nil
+}
+
+// ImportVideoIDs normalises the video IDs of an import with v, to be used as ImportOptions.NormalizeVideoID,
+// the errors read like the other line errors
+func ImportVideoIDs(v *validation.Validator) func(string) (string, error) {
+	return func(id string) (string, error) {
+		id, verr := v.VideoID("videoID", id)
+		if verr != nil {
+			return "", errors.New(verr.Fields[0].Field + " " + verr.Fields[0].Message)
+		}
+		return id, nil
+	}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"time"
+	model "youtube_service/model"
+	"youtube_service/notify"
+	db "youtube_service/repository"
+
+	log1 "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// leaderboard windows, lifetime and today are calendar based, 24h and 7d roll over the hourly buckets
+const (
+	WindowLifetime = "lifetime"
+	WindowToday    = "today"
+	Window24h      = "24h"
+	Window7d       = "7d"
+)
+
+// number of hourly buckets in every rolling window
+var rollingWindowHours = map[string]int{
+	Window24h: 24,
+	Window7d:  7 * 24,
+}
+
+func (s *service) GetTopNVideosInWindow(ctx context.Context, n int, window string) ([]model.ResultRedis, error) {
+	if n <= 0 {
+		return nil, ErrInvalidArgument
+	}
+	switch window {
+	case WindowLifetime:
+		return s.database.GetSortedRecords(ctx, n, true)
+	case WindowToday:
+		return s.database.GetSortedRecords(ctx, n, false)
+	}
+	if _, ok := rollingWindowHours[window]; !ok {
+		return nil, ErrInvalidArgument
+	}
+	return s.database.GetRollingRecords(ctx, window, n)
+}
+
+// windows in the order they are listed to clients
+var windows = []string{WindowLifetime, WindowToday, Window24h, Window7d}
+
+func isValidWindow(window string) bool {
+	for _, w := range windows {
+		if w == window {
+			return true
+		}
+	}
+	return false
+}
+
+// RefreshRollingWindows rebuilds the rolling window leaderboards right away and then every interval
+// until ctx is done, drops them from cache and tells notifier when they are not nil, the hourly buckets have to be enabled in the database
+func RefreshRollingWindows(ctx context.Context, database db.Database, cache *Cache, notifier *notify.Notifier, interval time.Duration, logger log1.Logger) {
+	runEvery(ctx, interval, func() {
+		for window, hours := range rollingWindowHours {
+			if err := database.RefreshRollingRecords(ctx, window, hours); err != nil {
+				level.Error(logger).Log("method", "RefreshRollingWindows", "window", window, "err", err)
+				continue
+			}
+			if cache != nil {
+				cache.Invalidate(window)
+			}
+			if notifier != nil {
+				notifier.Notify(window)
+			}
+		}
+	})
+}
+
+// runEvery calls job right away and then every interval until ctx is done
+func runEvery(ctx context.Context, interval time.Duration, job func()) {
+	job()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			job()
+		}
+	}
+}
@@ -1,36 +1,96 @@
 package setup
 
 import (
-	"log"
+	"context"
 	"net/http"
 	"os"
+	"time"
+	"youtube_service/audit"
+	"youtube_service/auth"
 	config "youtube_service/config"
+	"youtube_service/events"
+	"youtube_service/idempotency"
+	"youtube_service/logging"
+	model "youtube_service/model"
+	"youtube_service/notify"
+	"youtube_service/ratelimit"
 	db "youtube_service/repository"
 	service "youtube_service/service"
+	"youtube_service/tracing"
+	"youtube_service/validation"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/hashicorp/consul/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	log1 "github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 )
 
-func SetUp() (http.Handler, *config.Config) {
+// App is the service wired from the consul configs, shared by the server, the consumer and the import
+type App struct {
+	Configs *config.Config
+	Logger  log1.Logger
+	Client  *redis.Client
+	// Database is redis behind the timeouts and the circuit breaker
+	Database db.Database
+	Health   func(context.Context) model.Health
+	Service  service.Service
+	// VideoIDs normalises and checks the video IDs of the requests, the imports and the events
+	VideoIDs *validation.Validator
+	// HandlerOptions are the layers of the HTTP and the gRPC transports
+	HandlerOptions []service.HandlerOption
+	// ShutDownTracing flushes the spans which are not exported yet
+	ShutDownTracing func(context.Context) error
+
+	kv               *api.KV
+	key              string
+	waitIndex        uint64
+	leaderboardCache *service.Cache
+	notifier         *notify.Notifier
+	videoNotifier    *notify.Notifier
+	publisher        *events.Publisher
+	limiter          *ratelimit.Limiter
+}
+
+// New reads the configs from consul and wires the service, its metrics are registered with registerer.
+// Nothing runs in the background until Start.
+func New(registerer prometheus.Registerer) *App {
+	//logging with the defaults until the configs are loaded
+	logger, _ := logging.NewLogger(os.Stderr, logging.FormatLogfmt, "info")
+
+	//using consul for configs
 	config_consul := api.DefaultConfig()
 	client_consul, err := api.NewClient(config_consul)
 	if err != nil {
-		log.Fatalf("Failed to create Consul client: %v", err)
+		fatal(logger, "Failed to create Consul client", err)
 	}
-	key, kv := "youtube_service_configs", client_consul.KV()
+	app := &App{key: "youtube_service_configs", kv: client_consul.KV()}
 
-	pair, _, err := kv.Get(key, nil)
+	pair, meta, err := app.kv.Get(app.key, nil)
 	if err != nil {
-		log.Printf("Failed to get key-value pair: %v\n setting up default configs", err)
+		level.Warn(logger).Log("msg", "Failed to get key-value pair, setting default configs", "err", err)
 	}
 	if pair == nil {
-		log.Printf("Key '%s' not found in Consul", key)
+		level.Warn(logger).Log("msg", "Key not found in Consul, setting default configs", "key", app.key)
+	}
+	if meta != nil {
+		app.waitIndex = meta.LastIndex
 	}
 	//setting up configs from consul
-	configs := config.SetConfigs(pair)
+	configs, rejected, err := config.SetConfigs(pair)
+	if err != nil {
+		fatal(logger, "Failed to unmarshal configs", err)
+	}
+
+	logger, err = logging.NewLogger(os.Stderr, configs.LogFormat, configs.LogLevel)
+	if err != nil {
+		logger, _ = logging.NewLogger(os.Stderr, logging.FormatLogfmt, "info")
+		fatal(logger, "Failed to create logger", err)
+	}
+	logRejections(logger, rejected)
+	app.Configs, app.Logger = configs, logger
 
 	// Create a new Redis client
 	var rdb = redis.NewClient(&redis.Options{
@@ -38,19 +98,154 @@ func SetUp() (http.Handler, *config.Config) {
 		Password: "",
 		DB:       0,
 	})
+	rdb.AddHook(db.NewTracingHook())
+	rdb.AddHook(db.NewLoggingHook(logger))
+	app.Client = rdb
 
-	redis := db.NewRedis(rdb, configs.RedisKey)
+	//timeouts and a circuit breaker around redis, serving the last leaderboards and buffering the writes while it is down
+	redis := db.NewResilientDatabase(db.NewRedis(rdb, configs.RedisKey, configs.HourlyBuckets), db.ResilienceOptions{
+		Timeout:     time.Duration(configs.RedisTimeoutMillis) * time.Millisecond,
+		MaxFailures: uint32(configs.BreakerFailures),
+		OpenTimeout: time.Duration(configs.BreakerOpenSeconds) * time.Second,
+		BufferSize:  configs.WriteBufferSize,
+	})
+	app.Database, app.Health = redis, redis.Health
 
-	var logger log1.Logger
-	logger = log1.NewLogfmtLogger(log1.NewSyncWriter(os.Stderr))
-	logger = log1.With(logger, "ts", log1.DefaultTimestampUTC)
+	app.ShutDownTracing, err = tracing.SetUp(configs.TraceExporter, configs.TraceEndpoint, "youtube_service")
+	if err != nil {
+		fatal(logger, "Failed to set up tracing", err)
+	}
 
-	//creating a new service and wrapping it with logging layer
+	//creating a new service and wrapping it with caching, publishing, auditing, tracing, logging and instrumenting layers
+	registerer.MustRegister(db.NewPoolStatsCollector(rdb))
+	registerer.MustRegister(db.NewBreakerCollector(redis))
+	cacheTTL := time.Duration(configs.CacheTTLMillis) * time.Millisecond
+	app.leaderboardCache = service.NewCache(cacheTTL)
 	yt_service := service.NewService(redis)
+	yt_service = service.NewCachingService(app.leaderboardCache, yt_service)
+	//the live leaderboards and view counters of every instance are told about the changes through redis pub/sub
+	app.notifier = notify.New(notify.NewRedisRelay(rdb, configs.RedisKey+":changes"))
+	app.videoNotifier = notify.New(notify.NewRedisRelay(rdb, configs.RedisKey+":views"))
+	yt_service = service.NewNotifyingService(app.notifier, app.videoNotifier, yt_service)
+	//the views and the new videos are published to the event broker in batches, the batches which fail are kept
+	//in a redis list (in memory while redis is down) and sent again
+	eventSender, err := events.NewSender(configs.EventBroker, rdb, configs.EventTopic, int64(configs.EventMaxEntries),
+		configs.EventBrokerAddr, time.Duration(configs.EventTimeoutMillis)*time.Millisecond)
+	if err != nil {
+		fatal(logger, "Failed to set up the event broker", err)
+	}
+	if eventSender != nil {
+		app.publisher = events.NewPublisher(eventSender, events.NewFallbackOutbox(
+			events.NewRedisOutbox(rdb, configs.RedisKey+":events:outbox"),
+			events.NewMemoryOutbox(configs.EventBufferSize),
+		), events.NewRedisLock(rdb, configs.RedisKey+":events:outbox:lock"), events.PublisherOptions{
+			BatchSize:     configs.EventBatchSize,
+			FlushInterval: time.Duration(configs.EventFlushMillis) * time.Millisecond,
+			BufferSize:    configs.EventBufferSize,
+			RetryInterval: time.Duration(configs.EventRetrySeconds) * time.Second,
+			Timeout:       time.Duration(configs.EventTimeoutMillis) * time.Millisecond,
+		}, logger)
+		yt_service = service.NewPublishingService(app.publisher, yt_service)
+	}
+	auditLog, err := audit.NewLog(configs.AuditSink, rdb, configs.RedisKey+":audit", int64(configs.AuditMaxEntries), configs.AuditFile)
+	if err != nil {
+		fatal(logger, "Failed to set up the audit log", err)
+	}
+	if auditLog != nil {
+		yt_service = service.NewAuditingService(auditLog, redis, configs.AuditViewSampleRate, logger, yt_service)
+	}
+	yt_service = service.NewTracingService(yt_service)
 	yt_service = service.NewLoggingService(log1.With(logger), yt_service)
+	yt_service = service.NewPrometheusInstrumentingService(registerer, yt_service)
+	app.Service = yt_service
+
+	//normalising and checking the video IDs of the requests and of the imports
+	app.VideoIDs, err = validation.New(configs.VideoIDRules)
+	if err != nil {
+		fatal(logger, "Failed to set up the video ID rules", err)
+	}
+
+	//limiting the view ingestion, the buckets are shared through redis and kept in memory while it is down
+	app.limiter = ratelimit.NewLimiter(ratelimit.NewFallbackStore(
+		ratelimit.NewRedisStore(rdb, configs.RedisKey+":ratelimit:", time.Duration(configs.RedisTimeoutMillis)*time.Millisecond),
+		ratelimit.NewMemoryStore(),
+	), configs.RateLimits)
+
+	//authenticating every route but the health and the metrics when it is enabled
+	app.HandlerOptions = []service.HandlerOption{
+		service.WithRateLimiter(app.limiter),
+		service.WithCacheMaxAge(cacheTTL),
+		service.WithVideoIDValidator(app.VideoIDs),
+		service.WithNotifier(app.notifier),
+		service.WithLiveCounts(app.videoNotifier, configs.LiveCountsMaxRate),
+		service.WithIdempotency(idempotency.NewFallbackStore(
+			idempotency.NewRedisStore(rdb, configs.RedisKey+":idempotency:"),
+			idempotency.NewMemoryStore(),
+		), time.Duration(configs.IdempotencyTTLSeconds)*time.Second),
+	}
+	if configs.Auth.Enabled {
+		authenticator, err := auth.NewAuthenticator(configs.Auth)
+		if err != nil {
+			fatal(logger, "Failed to set up authentication", err)
+		}
+		app.HandlerOptions = append(app.HandlerOptions, service.WithAuthenticator(authenticator))
+	}
+	return app
+}
+
+// Start rebuilds the rolling window leaderboards, saves the snapshots of every window, relays the changes
+// and reloads the rate limits in the background until ctx is done
+func (a *App) Start(ctx context.Context) {
+	if a.Configs.HourlyBuckets {
+		go service.RefreshRollingWindows(ctx, a.Database, a.leaderboardCache, a.notifier, time.Duration(a.Configs.RollingRefreshSeconds)*time.Second, a.Logger)
+	}
+	go service.SnapshotLeaderboards(ctx, a.Database, time.Duration(a.Configs.SnapshotSeconds)*time.Second, a.Logger)
+	go a.notifier.Run(ctx)
+	go a.videoNotifier.Run(ctx)
+	go config.WatchConfigs(ctx, a.kv, a.key, a.waitIndex, a.Configs, func(configs *config.Config, rejected []config.Rejection) {
+		logRejections(a.Logger, rejected)
+		a.limiter.SetLimits(configs.RateLimits)
+		level.Info(a.Logger).Log("msg", "Rate limits reloaded")
+	}, func(err error) {
+		level.Warn(a.Logger).Log("msg", "Failed to watch configs", "err", err)
+	})
+}
 
+// Publish sends the events of the service until ctx is done, it returns right away without an event broker
+func (a *App) Publish(ctx context.Context) {
+	if a.publisher != nil {
+		a.publisher.Run(ctx)
+	}
+}
+
+// Handler serves the API with the health and the metrics
+func (a *App) Handler(metrics http.Handler) http.Handler {
 	mux := http.NewServeMux()
-	mux.Handle("/", service.MakeHandler(yt_service, logger))
-	return mux, configs
+	mux.Handle("/health", service.MakeHealthHandler(a.Health))
+	mux.Handle("/metrics", metrics)
+	mux.Handle("/", service.MakeHandler(a.Service, a.Logger, a.HandlerOptions...))
+	return mux
+}
+
+// SetUp wires the service, the background jobs it starts run until ctx is done,
+// every setup gets its own registry so it can be called more than once
+func SetUp(ctx context.Context) (http.Handler, *config.Config) {
+	registry := prometheus.NewRegistry()
+	app := New(registry)
+	app.Start(ctx)
+	go app.Publish(ctx)
+	return app.Handler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{})), app.Configs
+}
+
+// logRejections warns about the config fields which kept their previous value
+func logRejections(logger log1.Logger, rejected []config.Rejection) {
+	for _, r := range rejected {
+		level.Warn(logger).Log("msg", "Config field rejected, keeping its previous value", "field", r.Field, "err", r.Err)
+	}
+}
 
+// fatal logs err at error level and exits
+func fatal(logger log1.Logger, msg string, err error) {
+	level.Error(logger).Log("msg", msg, "err", err)
+	os.Exit(1)
 }
@@ -0,0 +1,104 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultMaxLength is the longest video ID when the rules have no MaxLength
+const DefaultMaxLength = 256
+
+// rules reported in the field errors
+const (
+	RuleRequired  = "required"
+	RuleMaxLength = "maxLength"
+	RuleCharset   = "charset"
+	RulePattern   = "pattern"
+	RuleFormat    = "format"
+)
+
+// Rules normalise and restrict the video IDs, the IDs are always non-empty valid UTF-8
+// without control characters
+type Rules struct {
+	// MaxLength in characters
+	MaxLength int `json:"maxLength"`
+	// Pattern is a regular expression the whole ID has to match, e.g. [A-Za-z0-9_-]+
+	Pattern string `json:"pattern"`
+	// FoldCase lower-cases the IDs so they are case insensitive
+	FoldCase bool `json:"foldCase"`
+	// Trim removes the leading and trailing white space
+	Trim bool `json:"trim"`
+}
+
+// FieldError is a rule broken by a request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Error lists the fields of a rejected request
+type Error struct {
+	Fields []FieldError
+}
+
+func (e *Error) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Field + ": " + field.Message
+	}
+	return "invalid argument: " + strings.Join(messages, ", ")
+}
+
+// NewError returns the Error of a single field
+func NewError(field, rule, message string) *Error {
+	return &Error{Fields: []FieldError{{Field: field, Rule: rule, Message: message}}}
+}
+
+// Validator applies Rules to the video IDs
+type Validator struct {
+	rules   Rules
+	pattern *regexp.Regexp
+}
+
+// New returns the Validator of rules, failing when the pattern does not compile
+func New(rules Rules) (*Validator, error) {
+	if rules.MaxLength <= 0 {
+		rules.MaxLength = DefaultMaxLength
+	}
+	v := &Validator{rules: rules}
+	if rules.Pattern != "" {
+		pattern, err := regexp.Compile("^(?:" + rules.Pattern + ")$")
+		if err != nil {
+			return nil, err
+		}
+		v.pattern = pattern
+	}
+	return v, nil
+}
+
+// VideoID returns the normalised id of field or the rule it breaks
+func (v *Validator) VideoID(field, id string) (string, *Error) {
+	if v.rules.Trim {
+		id = strings.TrimSpace(id)
+	}
+	if v.rules.FoldCase {
+		id = strings.ToLower(id)
+	}
+	switch {
+	case id == "":
+		return "", NewError(field, RuleRequired, "is empty")
+	case !utf8.ValidString(id):
+		return "", NewError(field, RuleCharset, "is not valid UTF-8")
+	case strings.IndexFunc(id, unicode.IsControl) >= 0:
+		return "", NewError(field, RuleCharset, "has control characters")
+	case utf8.RuneCountInString(id) > v.rules.MaxLength:
+		return "", NewError(field, RuleMaxLength, fmt.Sprintf("is longer than %d characters", v.rules.MaxLength))
+	case v.pattern != nil && !v.pattern.MatchString(id):
+		return "", NewError(field, RulePattern, fmt.Sprintf("does not match %s", v.rules.Pattern))
+	}
+	return id, nil
+}
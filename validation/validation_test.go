@@ -0,0 +1,55 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidator_VideoID(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    Rules
+		id       string
+		want     string
+		wantRule string
+	}{
+		{name: "kept as it is", id: " Video1 ", want: " Video1 "},
+		{name: "trimmed and folded", rules: Rules{Trim: true, FoldCase: true}, id: " Video1\t", want: "video1"},
+		{name: "empty", id: "", wantRule: RuleRequired},
+		{name: "blank once trimmed", rules: Rules{Trim: true}, id: "   ", wantRule: RuleRequired},
+		{name: "invalid UTF-8", id: "video\xff", wantRule: RuleCharset},
+		{name: "control characters", id: "video\n1", wantRule: RuleCharset},
+		{name: "default max length", id: strings.Repeat("a", DefaultMaxLength+1), wantRule: RuleMaxLength},
+		{name: "max length in characters", rules: Rules{MaxLength: 5}, id: "vidéo", want: "vidéo"},
+		{name: "too long", rules: Rules{MaxLength: 5}, id: "video1", wantRule: RuleMaxLength},
+		{name: "whole ID matches", rules: Rules{Pattern: "[a-z0-9]+"}, id: "video1", want: "video1"},
+		{name: "partial match", rules: Rules{Pattern: "[a-z]+|[0-9]+"}, id: "video1", wantRule: RulePattern},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := New(tt.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, verr := v.VideoID("videoName", tt.id)
+			if tt.wantRule != "" {
+				if verr == nil || verr.Fields[0].Rule != tt.wantRule || verr.Fields[0].Field != "videoName" {
+					t.Fatalf("VideoID() error = %v, want the %s rule", verr, tt.wantRule)
+				}
+				return
+			}
+			if verr != nil {
+				t.Fatal(verr)
+			}
+			if got != tt.want {
+				t.Errorf("VideoID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew_badPattern(t *testing.T) {
+	if _, err := New(Rules{Pattern: "[a-z"}); err == nil {
+		t.Error("New() accepted a pattern which does not compile")
+	}
+}